@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// githubOutput writes name=value step outputs to the file named by
+// $GITHUB_OUTPUT, in the order given. It does nothing outside GitHub Actions.
+func githubOutput(pairs ...[2]string) error {
+	path := os.Getenv("GITHUB_OUTPUT")
+	if path == "" {
+		return nil
+	}
+	var sb strings.Builder
+	for _, p := range pairs {
+		if strings.ContainsAny(p[1], "\r\n") {
+			return fmt.Errorf("step output %s must be a single line", p[0])
+		}
+		fmt.Fprintf(&sb, "%s=%s\n", p[0], p[1])
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("writing GitHub Actions outputs: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(sb.String()); err != nil {
+		return fmt.Errorf("writing GitHub Actions outputs: %w", err)
+	}
+	return f.Close()
+}
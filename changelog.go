@@ -0,0 +1,479 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/nealwashere/ai-changelog-generator/internal/ai"
+)
+
+// defaultChangelogHeader is the preamble of a newly created CHANGELOG.md.
+const defaultChangelogHeader = "# Changelog\n\nAll notable changes to this project will be documented in this file.\n\nThe format is based on [Keep a Changelog](https://keepachangelog.com/en/1.1.0/),\nand this project adheres to [Semantic Versioning](https://semver.org/spec/v2.0.0.html).\n"
+
+// defaultInsertMarker marks where new entries go in a file that embeds the
+// changelog inside other content, such as a documentation page.
+const defaultInsertMarker = "<!-- changelog:insert -->"
+
+// changelogOptions controls how entries are merged into a changelog file.
+type changelogOptions struct {
+	Header string // preamble for a newly created file
+	Marker string // insertion marker line; empty disables marker detection
+	Entry  string // line prefix of release headings; entries go before the first one. Defaults to "## ["
+	TOC    bool   // keep a table of contents of the release headings at the top
+
+	// Unreleased is the label of the section collecting unreleased changes,
+	// e.g. "Unreleased" for "## [Unreleased]". New releases go below that
+	// section rather than above it. Empty disables the special case.
+	Unreleased string
+
+	// Drop is the heading prefix of existing entries to remove before the
+	// new one is inserted, such as pre-releases it supersedes; empty keeps all.
+	Drop string
+
+	// Promote moves the bullets of the Unreleased section into the new entry,
+	// dropping those the entry already has, and removes the section.
+	Promote bool
+
+	// OldestFirst is set for changelogs that list releases from the oldest
+	// to the newest, so new entries go at the end; see appendEntry.
+	OldestFirst bool
+}
+
+// newsEntryPrefix starts the heading of each release in a NEWS file.
+const newsEntryPrefix = "Version "
+
+// versionHeader returns the heading of the entry for version in the given
+// style, or of the unreleased changes, labelled unreleased, when version is
+// empty.
+func versionHeader(style ai.Style, version, unreleased string, date time.Time) string {
+	if style == ai.StyleNews {
+		if version == "" {
+			if unreleased == defaultUnreleasedLabel {
+				return "Unreleased changes"
+			}
+			return unreleased
+		}
+		return fmt.Sprintf("%s%s (%s)", newsEntryPrefix, strings.TrimPrefix(version, "v"), date.Format("2006-01-02"))
+	}
+	if version == "" {
+		return unreleasedHeader(unreleased)
+	}
+	return fmt.Sprintf("## [%s] - %s", version, date.Format("2006-01-02"))
+}
+
+// updateChangelogFile inserts entry into the changelog file at path, creating
+// the file with opts.Header if it does not yet exist. The header of an
+// existing file is left untouched.
+func updateChangelogFile(path, entry string, opts changelogOptions) error {
+	_, content, err := updatedChangelog(path, entry, opts)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(content), 0644)
+}
+
+// updatedChangelog returns the current content of the changelog file at path
+// ("" when it does not exist yet) and the content updateChangelogFile would
+// write, without writing it.
+func updatedChangelog(path, entry string, opts changelogOptions) (before, after string, err error) {
+	existing, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", "", err
+	}
+	after = string(existing)
+	if opts.Drop != "" {
+		after = dropEntries(after, opts)
+	}
+	if opts.Promote && opts.Unreleased != "" {
+		after, entry = promoteUnreleased(after, entry, opts.Unreleased)
+	}
+	after = insertEntry(after, entry, opts)
+	if opts.TOC {
+		after = updateTOC(after)
+	}
+	return string(existing), after, nil
+}
+
+// insertEntry returns content with entry added as the newest release.
+//
+// If content contains the marker, the entry goes directly below the marker
+// line, which is kept for the next release. Otherwise it goes before the
+// first release heading (see opts.Entry), skipping an opts.Unreleased section
+// at the top, or at the end when there is none. Empty content becomes
+// opts.Header followed by the entry.
+func insertEntry(content, entry string, opts changelogOptions) string {
+	entry = strings.TrimRight(entry, "\n")
+	prefix := opts.Entry
+	if prefix == "" {
+		prefix = "## ["
+	}
+
+	if content == "" {
+		if opts.Header == "" {
+			return entry + "\n"
+		}
+		return strings.TrimRight(opts.Header, "\n") + "\n\n" + entry + "\n"
+	}
+	if opts.OldestFirst {
+		return appendEntry(content, entry, opts)
+	}
+
+	var result string
+	if idx := markerIndex(content, opts.Marker); idx != -1 {
+		lineEnd := idx + len(opts.Marker)
+		before := content[:lineEnd]
+		after := strings.TrimLeft(content[lineEnd:], "\n")
+		result = before + "\n\n" + entry + "\n"
+		if after != "" {
+			result += "\n" + after
+		}
+	} else if at := headingIndex(content, prefix); at != -1 {
+		// Insert before the first release heading, keeping the unreleased
+		// changes on top.
+		if opts.Unreleased != "" {
+			header := unreleasedHeader(opts.Unreleased)
+			if start, end, ok := sectionBounds(content, header); ok && start == at && !strings.HasPrefix(entry, header) {
+				at = end
+			}
+		}
+		before := strings.TrimRight(content[:at], "\n")
+		after := content[at:] // starts at the heading
+		switch {
+		case after == "":
+			result = before + "\n\n" + entry + "\n"
+		case before == "":
+			// No preamble: the file starts with the latest release.
+			result = entry + "\n\n" + after
+		default:
+			result = before + "\n\n" + entry + "\n\n" + after
+		}
+	} else {
+		result = strings.TrimRight(content, "\n") + "\n\n" + entry + "\n"
+	}
+
+	if !strings.HasSuffix(result, "\n") {
+		result += "\n"
+	}
+	return result
+}
+
+// appendEntry is insertEntry for an oldest-first changelog. If content
+// contains the marker, the entry goes directly above the marker line, which
+// stays below the newest release. Otherwise it goes after the last entry:
+// before an opts.Unreleased section that comes last, since its changes are
+// newer still, and before the link reference definitions, such as
+// "[1.0.0]: https://...", that Keep a Changelog files end with.
+func appendEntry(content, entry string, opts changelogOptions) string {
+	at := trailingLinkRefs(content)
+	if idx := markerIndex(content, opts.Marker); idx != -1 {
+		at = idx
+	} else if opts.Unreleased != "" {
+		header := unreleasedHeader(opts.Unreleased)
+		if start, end, ok := sectionBounds(content, header); ok && !strings.HasPrefix(entry, header) && headingIndex(content[end:], "## ") == -1 {
+			at = start
+		}
+	}
+
+	before := strings.TrimRight(content[:at], "\n")
+	after := strings.TrimLeft(content[at:], "\n")
+	result := entry + "\n"
+	if before != "" {
+		result = before + "\n\n" + result
+	}
+	if after != "" {
+		result += "\n" + strings.TrimRight(after, "\n") + "\n"
+	}
+	return result
+}
+
+// linkRefRe matches a markdown link reference definition line.
+var linkRefRe = regexp.MustCompile(`^\[[^\]]+\]: +\S`)
+
+// trailingLinkRefs returns the offset of the block of link reference
+// definitions, and blank lines, that ends content, or len(content) when
+// content does not end with one.
+func trailingLinkRefs(content string) int {
+	at := len(content)
+	lines := strings.SplitAfter(content, "\n")
+	off := len(content)
+	for i := len(lines) - 1; i >= 0; i-- {
+		off -= len(lines[i])
+		line := strings.TrimRight(lines[i], "\n")
+		switch {
+		case strings.TrimSpace(line) == "":
+		case linkRefRe.MatchString(line):
+			at = off
+		default:
+			return at
+		}
+	}
+	return at
+}
+
+// promoteUnreleased removes the section labelled unreleased from content and
+// merges its bullets into entry, section by section, after the generated
+// ones. Bullets that then appear twice in entry, ignoring case, punctuation,
+// and spacing, are kept only once.
+func promoteUnreleased(content, entry, unreleased string) (string, string) {
+	start, end, ok := sectionBounds(content, unreleasedHeader(unreleased))
+	if !ok {
+		return content, entry
+	}
+	merged := ai.ParseChangelog(entry)
+	for _, s := range ai.ParseChangelog(content[start:end]).Sections {
+		if existing := merged.Section(s.Title); existing != nil {
+			existing.Bullets = append(existing.Bullets, s.Bullets...)
+			existing.Prose = append(existing.Prose, s.Prose...)
+		} else {
+			merged.Sections = append(merged.Sections, s)
+		}
+	}
+	merged, removed := ai.DedupeBullets(merged)
+	for _, b := range removed {
+		verbosef("dropped duplicate bullet while promoting [%s]: %s", unreleased, b)
+	}
+	fmt.Fprintf(os.Stderr, "info: promoted the [%s] section into the new entry (%d duplicate bullet(s) dropped)\n", unreleased, len(removed))
+	return content[:start] + content[end:], merged.String()
+}
+
+// dropEntries removes from content every release entry whose heading starts
+// with opts.Drop, up to the next release heading.
+func dropEntries(content string, opts changelogOptions) string {
+	prefix := opts.Entry
+	if prefix == "" {
+		prefix = "## ["
+	}
+	var kept []string
+	dropping := false
+	for _, line := range strings.SplitAfter(content, "\n") {
+		if strings.HasPrefix(line, prefix) {
+			dropping = strings.HasPrefix(line, opts.Drop)
+		}
+		if !dropping {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "")
+}
+
+// headingIndex returns the offset of the first line of content starting with
+// prefix, or -1 when there is none.
+func headingIndex(content, prefix string) int {
+	if strings.HasPrefix(content, prefix) {
+		return 0
+	}
+	if idx := strings.Index(content, "\n"+prefix); idx != -1 {
+		return idx + 1
+	}
+	return -1
+}
+
+// previousEntries returns the first n release entries of content, from the
+// first line starting with prefix up to the (n+1)th, or "" when there are
+// none. Each entry, including an Unreleased section, counts once.
+func previousEntries(content string, n int, prefix string) string {
+	start, count := -1, 0
+	for off := 0; off < len(content); {
+		lineEnd := strings.IndexByte(content[off:], '\n')
+		if lineEnd == -1 {
+			lineEnd = len(content)
+		} else {
+			lineEnd += off
+		}
+		if strings.HasPrefix(content[off:lineEnd], prefix) {
+			if count == n {
+				return strings.TrimSpace(content[start:off])
+			}
+			if start == -1 {
+				start = off
+			}
+			count++
+		}
+		off = lineEnd + 1
+	}
+	if start == -1 {
+		return ""
+	}
+	return strings.TrimSpace(content[start:])
+}
+
+// lastEntries is previousEntries for an oldest-first changelog: it returns
+// the last n entries, without the link reference definitions after them.
+func lastEntries(content string, n int, prefix string) string {
+	var starts []int
+	for off := 0; off < len(content); {
+		if strings.HasPrefix(content[off:], prefix) {
+			starts = append(starts, off)
+		}
+		lineEnd := strings.IndexByte(content[off:], '\n')
+		if lineEnd == -1 {
+			break
+		}
+		off += lineEnd + 1
+	}
+	if len(starts) == 0 {
+		return ""
+	}
+	start := starts[max(len(starts)-n, 0)]
+	return strings.TrimSpace(content[start:max(trailingLinkRefs(content), start)])
+}
+
+// TOC delimiters: the lines between them are regenerated on every update.
+const (
+	tocStart = "<!-- toc -->"
+	tocEnd   = "<!-- /toc -->"
+)
+
+// updateTOC returns content with its table of contents listing every
+// "## [" release heading, linked by GitHub anchor slug. An existing TOC is
+// replaced in place; otherwise one is added before the first release.
+func updateTOC(content string) string {
+	var items []string
+	slugs := map[string]int{}
+	for _, line := range strings.Split(content, "\n") {
+		if !strings.HasPrefix(line, "## [") {
+			continue
+		}
+		heading := strings.TrimSpace(line[3:])
+		label := heading[1:]
+		if end := strings.IndexByte(label, ']'); end != -1 {
+			label = label[:end]
+		}
+		slug := githubSlug(heading)
+		if n := slugs[slug]; n > 0 {
+			slugs[slug]++
+			slug = fmt.Sprintf("%s-%d", slug, n)
+		} else {
+			slugs[slug] = 1
+		}
+		items = append(items, fmt.Sprintf("- [%s](#%s)", label, slug))
+	}
+	if len(items) == 0 {
+		return content
+	}
+	toc := tocStart + "\n" + strings.Join(items, "\n") + "\n" + tocEnd
+
+	if start := markerIndex(content, tocStart); start != -1 {
+		if end := markerIndex(content[start:], tocEnd); end != -1 {
+			return content[:start] + toc + content[start+end+len(tocEnd):]
+		}
+	}
+	if strings.HasPrefix(content, "## [") {
+		return toc + "\n\n" + content
+	}
+	idx := strings.Index(content, "\n## [")
+	return strings.TrimRight(content[:idx], "\n") + "\n\n" + toc + "\n\n" + content[idx+1:]
+}
+
+// githubSlug returns the anchor GitHub generates for a markdown heading:
+// lower case, punctuation other than "-" and "_" removed, spaces as hyphens.
+func githubSlug(heading string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToLower(heading) {
+		switch {
+		case r == ' ':
+			sb.WriteByte('-')
+		case r == '-' || r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r):
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// markerIndex returns the offset of marker when it appears on a line of its
+// own in content, or -1.
+func markerIndex(content, marker string) int {
+	if marker == "" {
+		return -1
+	}
+	for off := 0; off < len(content); {
+		i := strings.Index(content[off:], marker)
+		if i == -1 {
+			return -1
+		}
+		start := off + i
+		end := start + len(marker)
+		lineStart := start == 0 || content[start-1] == '\n'
+		lineEnd := end == len(content) || content[end] == '\n'
+		if lineStart && lineEnd {
+			return start
+		}
+		off = end
+	}
+	return -1
+}
+
+// defaultUnreleasedLabel names the section that collects changes not yet
+// part of a release.
+const defaultUnreleasedLabel = "Unreleased"
+
+// unreleasedHeader returns the heading of the unreleased section named label.
+func unreleasedHeader(label string) string {
+	return "## [" + label + "]"
+}
+
+// commitMarker returns the comment recording that sha's notes have been
+// accumulated into the Unreleased section.
+func commitMarker(sha string) string {
+	return "<!-- changelog:commit " + sha + " -->"
+}
+
+// sectionBounds returns the byte range of the "## " section whose heading line
+// starts with header, running up to the next "## " heading or the end of
+// content. ok is false when there is no such section.
+func sectionBounds(content, header string) (start, end int, ok bool) {
+	for off := 0; off < len(content); {
+		lineEnd := strings.IndexByte(content[off:], '\n')
+		if lineEnd == -1 {
+			lineEnd = len(content)
+		} else {
+			lineEnd += off
+		}
+		if strings.HasPrefix(content[off:lineEnd], header) {
+			start = off
+			end = len(content)
+			if next := strings.Index(content[lineEnd:], "\n## "); next != -1 {
+				end = lineEnd + next + 1
+			}
+			return start, end, true
+		}
+		off = lineEnd + 1
+	}
+	return 0, 0, false
+}
+
+// accumulateEntry merges fragment (### sections without a version header) into
+// the opts.Unreleased section of content, creating the section if needed, and
+// records marker beneath its heading. Bullets are appended to sections of the
+// same name; new sections are added after the existing ones.
+func accumulateEntry(content, fragment, marker string, opts changelogOptions) string {
+	add := ai.ParseChangelog(fragment)
+
+	header := unreleasedHeader(opts.Unreleased)
+	start, end, ok := sectionBounds(content, header)
+	if !ok {
+		add.Preamble = []string{header, marker}
+		return insertEntry(content, add.String(), opts)
+	}
+
+	cur := ai.ParseChangelog(content[start:end])
+	cur.Preamble = append(cur.Preamble, marker)
+	for _, s := range add.Sections {
+		if existing := cur.Section(s.Title); existing != nil {
+			existing.Bullets = append(existing.Bullets, s.Bullets...)
+		} else {
+			cur.Sections = append(cur.Sections, ai.Section{Title: s.Title, Bullets: s.Bullets})
+		}
+	}
+
+	merged := cur.String()
+	if end < len(content) {
+		merged += "\n"
+	}
+	return content[:start] + merged + content[end:]
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testHeader = "# Widget changelog\n\nReleased under the MIT license.\n"
+
+func TestUpdateChangelogFileHeader(t *testing.T) {
+	entry := "## [1.1.0] - 2024-05-01\n\n### Added\n\n- Paging cursor\n"
+	for _, tc := range []struct {
+		name     string
+		existing string // no file when empty
+		want     string
+	}{
+		{
+			name: "new file gets the header",
+			want: testHeader + "\n" + entry,
+		},
+		{
+			name:     "existing file keeps its own header",
+			existing: "# Changelog\n\nOld preamble.\n\n## [1.0.0] - 2024-01-01\n\n- First\n",
+			want:     "# Changelog\n\nOld preamble.\n\n" + entry + "\n## [1.0.0] - 2024-01-01\n\n- First\n",
+		},
+		{
+			name:     "header already present is not repeated",
+			existing: testHeader,
+			want:     testHeader + "\n" + entry,
+		},
+		{
+			name:     "header already present above releases is not repeated",
+			existing: testHeader + "\n## [1.0.0] - 2024-01-01\n\n- First\n",
+			want:     testHeader + "\n" + entry + "\n## [1.0.0] - 2024-01-01\n\n- First\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "CHANGELOG.md")
+			if tc.existing != "" {
+				if err := os.WriteFile(path, []byte(tc.existing), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := updateChangelogFile(path, entry, changelogOptions{Header: testHeader, Unreleased: defaultUnreleasedLabel}); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(data); got != tc.want {
+				t.Errorf("CHANGELOG.md:\n%s\nwant:\n%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestUpdateChangelogFileTwice(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "CHANGELOG.md")
+	opts := changelogOptions{Header: testHeader}
+	for _, entry := range []string{"## [1.0.0] - 2024-01-01\n\n- First\n", "## [1.1.0] - 2024-05-01\n\n- Second\n"} {
+		if err := updateChangelogFile(path, entry, opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := testHeader + "\n## [1.1.0] - 2024-05-01\n\n- Second\n\n## [1.0.0] - 2024-01-01\n\n- First\n"
+	if got := string(data); got != want {
+		t.Errorf("CHANGELOG.md after two releases:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestPromoteUnreleasedDropsNearDuplicates(t *testing.T) {
+	content := "# Changelog\n\n## [Unreleased]\n\n### Added\n\n- Paging cursor for list endpoints.\n- Retry with backoff\n\n### Fixed\n\n- handle empty input\n\n## [1.0.0] - 2024-01-01\n\n- First\n"
+	entry := "## [1.1.0] - 2024-05-01\n\n### Added\n\n- Paging cursor for list endpoints\n\n### Fixed\n\n- Handle empty input.\n- Handle a closed connection\n"
+	gotContent, gotEntry := promoteUnreleased(content, entry, defaultUnreleasedLabel)
+	if want := "# Changelog\n\n## [1.0.0] - 2024-01-01\n\n- First\n"; gotContent != want {
+		t.Errorf("content:\n%s\nwant:\n%s", gotContent, want)
+	}
+	want := "## [1.1.0] - 2024-05-01\n\n### Added\n\n- Paging cursor for list endpoints\n- Retry with backoff\n\n### Fixed\n\n- Handle empty input.\n- Handle a closed connection\n"
+	if gotEntry != want {
+		t.Errorf("entry:\n%s\nwant:\n%s", gotEntry, want)
+	}
+}
+
+func TestInsertEntryOrder(t *testing.T) {
+	const (
+		head       = "# Changelog\n\n"
+		unreleased = "## [Unreleased]\n\n- Pending\n\n"
+		v100       = "## [1.0.0] - 2024-01-01\n\n- First\n\n"
+		v110       = "## [1.1.0] - 2024-03-01\n\n- Second\n\n"
+		entry      = "## [1.2.0] - 2024-05-01\n\n- Third\n"
+		links      = "\n[1.1.0]: https://example.com/compare/1.0.0...1.1.0\n[1.0.0]: https://example.com/releases/1.0.0\n"
+	)
+	for _, tc := range []struct {
+		name        string
+		oldestFirst bool
+		content     string
+		want        string
+	}{
+		{"newest first", false, head + v110 + v100, head + entry + "\n" + v110 + v100},
+		{"newest first, below unreleased", false, head + unreleased + v110 + v100, head + unreleased + entry + "\n" + v110 + v100},
+		{"oldest first", true, head + v100 + v110, head + v100 + v110 + entry},
+		{"oldest first, above unreleased", true, head + v100 + v110 + unreleased, head + v100 + v110 + entry + "\n" + unreleased},
+		{"oldest first, above link references", true, head + v100 + strings.TrimSuffix(v110, "\n") + links, head + v100 + v110 + entry + links},
+		{"oldest first, unreleased not last", true, head + unreleased + v100 + v110, head + unreleased + v100 + v110 + entry},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			content := strings.TrimRight(tc.content, "\n") + "\n"
+			got := insertEntry(content, entry, changelogOptions{Unreleased: defaultUnreleasedLabel, OldestFirst: tc.oldestFirst})
+			tc.want = strings.TrimRight(tc.want, "\n") + "\n"
+			if got != tc.want {
+				t.Errorf("insertEntry:\n%s\nwant:\n%s", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	const changelog = "# Changelog\n\n## [1.0.0] - 2024-01-01\n\n### Added\n\n- Paging\n- Sorting\n- Filters\n\n### Fixed\n\n- Crash on exit\n"
+	for _, tc := range []struct {
+		name          string
+		before, after string
+		want          string
+	}{
+		{
+			name:   "equal",
+			before: changelog,
+			after:  changelog,
+			want:   "",
+		},
+		{
+			name:  "new file",
+			after: "# Changelog\n\n- First\n",
+			want:  "--- /dev/null\n+++ b/CHANGELOG.md\n@@ -0,0 +1,3 @@\n+# Changelog\n+\n+- First\n",
+		},
+		{
+			name:   "insertion at the top",
+			before: changelog,
+			after:  "## [1.1.0] - 2024-05-01\n\n- Export\n\n" + changelog,
+			want: "--- a/CHANGELOG.md\n+++ b/CHANGELOG.md\n@@ -1,3 +1,7 @@\n" +
+				"+## [1.1.0] - 2024-05-01\n+\n+- Export\n+\n # Changelog\n \n ## [1.0.0] - 2024-01-01\n",
+		},
+		{
+			name:   "change in the middle",
+			before: changelog,
+			after:  strings.Replace(changelog, "- Sorting\n", "- Sorting by date\n", 1),
+			want: "--- a/CHANGELOG.md\n+++ b/CHANGELOG.md\n@@ -5,7 +5,7 @@\n" +
+				" ### Added\n \n - Paging\n-- Sorting\n+- Sorting by date\n - Filters\n \n ### Fixed\n",
+		},
+		{
+			name:   "newline removed at the end",
+			before: "- Paging\n- Sorting\n",
+			after:  "- Paging\n- Sorting",
+			want: "--- a/CHANGELOG.md\n+++ b/CHANGELOG.md\n@@ -1,2 +1,2 @@\n" +
+				" - Paging\n-- Sorting\n+- Sorting\n\\ No newline at end of file\n",
+		},
+		{
+			name:   "line added after a last line without newline",
+			before: "- Paging\n- Sorting",
+			after:  "- Paging\n- Sorting\n- Filters\n",
+			want: "--- a/CHANGELOG.md\n+++ b/CHANGELOG.md\n@@ -1,2 +1,3 @@\n" +
+				" - Paging\n-- Sorting\n\\ No newline at end of file\n+- Sorting\n+- Filters\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := unifiedDiff("CHANGELOG.md", tc.before, tc.after); got != tc.want {
+				t.Errorf("unifiedDiff() =\n%s\nwant:\n%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestUnifiedDiffLargeMiddle(t *testing.T) {
+	// 1500 changed lines on each side exceed maxDiffCells, so the common
+	// line among them is not matched.
+	var before, after strings.Builder
+	for i := range 1500 {
+		if i == 700 {
+			before.WriteString("- Common\n")
+			after.WriteString("- Common\n")
+			continue
+		}
+		fmt.Fprintf(&before, "- Old %d\n", i)
+		fmt.Fprintf(&after, "- New %d\n", i)
+	}
+
+	got := unifiedDiff("CHANGELOG.md", before.String(), after.String())
+	lines := strings.Split(strings.TrimSuffix(got, "\n"), "\n")
+	if len(lines) != 3+3000 || lines[2] != "@@ -1,1500 +1,1500 @@" {
+		t.Fatalf("got %d lines with hunk header %q, want one hunk of 3000 lines", len(lines), lines[2])
+	}
+	for i, l := range lines[3:] {
+		want := "-"
+		if i >= 1500 {
+			want = "+"
+		}
+		if !strings.HasPrefix(l, want) {
+			t.Fatalf("hunk line %d is %q, want all removals before all additions", i, l)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/nealwashere/ai-changelog-generator/internal/forge"
+	"github.com/nealwashere/ai-changelog-generator/internal/git"
+)
+
+// fullChangelogLink returns the "**Full Changelog**: <url>" line for
+// --full-changelog-link, linking origin's GitHub compare page for the range
+// from..to. In release mode to is the new version's tag; a preview of HEAD
+// links the current branch, or the commit when HEAD is detached.
+func fullChangelogLink(cfg config, from, to string) (string, error) {
+	url, err := git.RemoteURL(cfg.Repo, "origin")
+	if err != nil {
+		return "", fmt.Errorf("--full-changelog-link: %w", err)
+	}
+	owner, name, ok := forge.ParseGitHubRemote(url)
+	if !ok {
+		return "", invalid(fmt.Errorf("--full-changelog-link: origin %s is not a GitHub remote", url))
+	}
+
+	switch {
+	case cfg.Version != "":
+		to = cfg.Version
+	case to == "HEAD":
+		branch, err := git.CurrentBranch(cfg.Repo)
+		if err != nil {
+			return "", err
+		}
+		if branch != "" {
+			to = branch
+		} else if to, err = git.ResolveCommit(cfg.Repo, "HEAD"); err != nil {
+			return "", err
+		}
+	}
+	return "**Full Changelog**: " + forge.CompareURL(owner, name, from, to), nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/nealwashere/ai-changelog-generator/internal/ai"
+	"github.com/nealwashere/ai-changelog-generator/internal/git"
+)
+
+// maxSummaryCommits bounds the commit list shown when confirming a release.
+const maxSummaryCommits = 10
+
+// isTerminal reports whether f is attached to a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// interactive reports whether the user can be prompted: both stdin and stderr
+// must be terminals, so piped and CI runs never block waiting for input.
+func interactive() bool {
+	return isTerminal(os.Stdin) && isTerminal(os.Stderr)
+}
+
+// confirmRelease returns the version to release with cfg: the one confirmed
+// at the terminal when tty is true, or cfg.Version as given with --yes. A
+// release that would make changes without a terminal to confirm it at and
+// without --yes is refused, so that a release script run in the wrong place
+// cannot tag a release nobody looked at. --plan, --release-dry-run, and
+// --changelog-diff change nothing and are not asked about.
+func confirmRelease(cfg config, tty bool, in io.Reader, out io.Writer, scheme versionScheme, lastTag, to string, changes ai.Changes) (string, error) {
+	if !needsConfirmation(cfg) {
+		return cfg.Version, nil
+	}
+	if err := checkConfirmable(cfg, tty); err != nil {
+		return "", err
+	}
+	return confirmVersion(in, out, scheme, cfg.Version, lastTag, to, changes)
+}
+
+// needsConfirmation reports whether the release cfg describes is confirmed
+// before it goes ahead.
+func needsConfirmation(cfg config) bool {
+	return !cfg.Yes && !cfg.Plan && !cfg.ReleaseDryRun && !cfg.ChangelogDiff
+}
+
+// checkConfirmable refuses a release that needs confirmation when there is
+// no terminal to confirm it at. run calls it before reading any history, so
+// that such a run fails at once instead of after the gather.
+func checkConfirmable(cfg config, tty bool) error {
+	if needsConfirmation(cfg) && !tty {
+		return invalid(fmt.Errorf("releasing %s needs a terminal to confirm it at; pass --yes to release without confirmation", cfg.Version))
+	}
+	return nil
+}
+
+// confirmVersion shows the range and commits going into the release and asks
+// the user to accept version, type a different one, or abort. It returns the
+// version to release; a replacement is checked with validateNewVersion
+// against lastTag.
+func confirmVersion(in io.Reader, out io.Writer, scheme versionScheme, version, lastTag, to string, changes ai.Changes) (string, error) {
+	mode := "stat-only"
+	if changes.FullDiff != "" {
+		mode = "full-diff"
+	}
+	lines := git.ParseTotalChangedLines(changes.DiffStat)
+	commits := changes.Commits
+	if lastTag != "" {
+		fmt.Fprintf(out, "Release %s covering %s..%s (%d commit(s), %s lines, %s mode):\n", version, lastTag, to, len(commits), shortCount(lines), mode)
+	} else {
+		fmt.Fprintf(out, "Release %s covering the history up to %s (%d commit(s), %s lines, %s mode):\n", version, to, len(commits), shortCount(lines), mode)
+	}
+	for i, c := range commits {
+		if i == maxSummaryCommits {
+			fmt.Fprintf(out, "  … and %d more\n", len(commits)-maxSummaryCommits)
+			break
+		}
+		fmt.Fprintf(out, "  %s %s\n", c.SHA, c.Subject)
+	}
+
+	r := bufio.NewReader(in)
+	for {
+		fmt.Fprintf(out, "Proceed with %s? [Y/n/other version] ", version)
+		line, err := r.ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("release cancelled: no answer")
+		}
+		switch answer := strings.TrimSpace(line); strings.ToLower(answer) {
+		case "", "y", "yes":
+			return version, nil
+		case "n", "no":
+			return "", fmt.Errorf("release cancelled")
+		default:
+			if err := validateNewVersion(scheme, answer, lastTag); err != nil {
+				fmt.Fprintf(out, "%v\n", err)
+				continue
+			}
+			version = answer
+		}
+	}
+}
+
+// shortCount formats n for a one-line summary: 950, 1.2k, 34.5k.
+func shortCount(n int) string {
+	if n < 1000 {
+		return fmt.Sprint(n)
+	}
+	return fmt.Sprintf("%.1fk", float64(n)/1000)
+}
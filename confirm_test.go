@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nealwashere/ai-changelog-generator/internal/ai"
+	"github.com/nealwashere/ai-changelog-generator/internal/git"
+)
+
+var confirmChanges = ai.Changes{
+	Commits:  []git.Commit{{SHA: "a1b2c3d", Subject: "feat: add the paging cursor"}},
+	DiffStat: " api.go | 12 ++++++------\n 1 file changed, 6 insertions(+), 6 deletions(-)\n",
+	FullDiff: "diff --git a/api.go b/api.go\n",
+}
+
+func TestConfirmVersion(t *testing.T) {
+	for _, tc := range []struct {
+		name, answers, want string
+		wantErr             bool
+	}{
+		{"enter accepts", "\n", "1.2.0", false},
+		{"yes accepts", "y\n", "1.2.0", false},
+		{"no aborts", "n\n", "", true},
+		{"no answer aborts", "", "", true},
+		{"other version is asked about", "1.3.0\n\n", "1.3.0", false},
+		{"invalid version is asked again", "1.0.0\n2.0.0\n\n", "2.0.0", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var out strings.Builder
+			got, err := confirmVersion(strings.NewReader(tc.answers), &out, schemeSemver, "1.2.0", "1.1.3", "HEAD", confirmChanges)
+			if (err != nil) != tc.wantErr || got != tc.want {
+				t.Errorf("confirmVersion = %q, %v; want %q, error %v", got, err, tc.want, tc.wantErr)
+			}
+			if summary := "Release 1.2.0 covering 1.1.3..HEAD (1 commit(s), 12 lines, full-diff mode):\n  a1b2c3d feat: add the paging cursor\n"; !strings.HasPrefix(out.String(), summary) {
+				t.Errorf("summary:\n%s\nwant it to start with:\n%s", out.String(), summary)
+			}
+		})
+	}
+}
+
+func TestConfirmReleaseWithoutTerminal(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		cfg     config
+		wantErr bool
+	}{
+		{"refused without --yes", config{Version: "1.2.0"}, true},
+		{"--yes releases", config{Version: "1.2.0", Yes: true}, false},
+		{"--release-dry-run changes nothing", config{Version: "1.2.0", ReleaseDryRun: true}, false},
+		{"--changelog-diff changes nothing", config{Version: "1.2.0", ChangelogDiff: true}, false},
+		{"--plan changes nothing", config{Version: "1.2.0", Plan: true}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var out strings.Builder
+			got, err := confirmRelease(tc.cfg, false, strings.NewReader("y\n"), &out, schemeSemver, "1.1.3", "HEAD", confirmChanges)
+			if tc.wantErr {
+				if err == nil || exitCode(err) != exitValidation {
+					t.Fatalf("confirmRelease = %q, %v; want a validation error", got, err)
+				}
+				return
+			}
+			if err != nil || got != "1.2.0" {
+				t.Errorf("confirmRelease = %q, %v; want 1.2.0", got, err)
+			}
+			if out.Len() > 0 {
+				t.Errorf("asked without a terminal:\n%s", out.String())
+			}
+		})
+	}
+}
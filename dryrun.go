@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nealwashere/ai-changelog-generator/internal/ai"
+)
+
+// releaseDryRun finishes a --release-dry-run: with the entries generated,
+// it prints the changelog diff to stdout, or the note text with --git-note,
+// and lists on stderr the file and git operations the release would perform,
+// in order. Nothing in the repository is changed.
+func releaseDryRun(cfg config, changelogPath string, locales, entries []string, opts changelogOptions, fragments []ai.Fragment, tagMessage string) error {
+	var actions []string
+	if cfg.GitNote != "" {
+		fmt.Print(strings.TrimSpace(entries[0]) + "\n")
+		verb := map[string]string{"error": "add", "append": "append", "overwrite": "add -f"}[cfg.GitNoteExisting]
+		actions = append(actions, fmt.Sprintf("git notes --ref %s %s -F - HEAD   # the entry above", cfg.GitNote, verb))
+	} else {
+		if err := printChangelogDiff(cfg, changelogPath, locales, entries, opts); err != nil {
+			return err
+		}
+		var paths []string
+		for _, locale := range locales {
+			path := repoRelative(cfg.Repo, localizedPath(changelogPath, locale))
+			actions = append(actions, "update "+path+"   # the diff above")
+			paths = append(paths, path)
+			if cfg.signer != nil {
+				actions = append(actions, fmt.Sprintf("%s: sign %s as %s.sig", cfg.signer.Name(), path, path))
+				paths = append(paths, path+".sig")
+			}
+		}
+		if cfg.FromFragments != "" {
+			for _, f := range fragments {
+				actions = append(actions, "rm "+repoRelative(cfg.Repo, filepath.Join(cfg.FromFragments, f.Name)))
+			}
+			paths = append(paths, repoRelative(cfg.Repo, cfg.FromFragments))
+		}
+		actions = append(actions,
+			"git add "+strings.Join(paths, " "),
+			fmt.Sprintf("git commit -m %q", releaseCommitMessage(cfg, time.Now())))
+	}
+	actions = append(actions, fmt.Sprintf("git tag -a %s -F -   # message: %s", cfg.Version, summarizeMessage(tagMessage)))
+	if cfg.GitNote != "" {
+		actions = append(actions, "git push --tags && git push origin "+noteRef(cfg.GitNote)+"   # left to you")
+	} else {
+		actions = append(actions, "git push && git push --tags   # left to you")
+	}
+
+	fmt.Fprintln(os.Stderr, "info: --release-dry-run: a release would run, in "+cfg.Repo+":")
+	for _, a := range actions {
+		fmt.Fprintln(os.Stderr, "  "+a)
+	}
+	fmt.Fprintln(os.Stderr, "info: --release-dry-run: nothing was written, committed, or tagged")
+	return nil
+}
+
+// repoRelative returns path relative to repo when it lies inside it, with
+// forward slashes, and path unchanged otherwise.
+func repoRelative(repo, path string) string {
+	if rel, err := filepath.Rel(repo, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(rel)
+	}
+	return path
+}
+
+// summarizeMessage returns the first line of a tag message, noting how many
+// more lines follow.
+func summarizeMessage(message string) string {
+	lines := strings.Split(strings.TrimSpace(message), "\n")
+	if len(lines) == 1 {
+		return fmt.Sprintf("%q", lines[0])
+	}
+	return fmt.Sprintf("%q and %d more line(s)", lines[0], len(lines)-1)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nealwashere/ai-changelog-generator/internal/ai"
+)
+
+// readFragments loads the changelog fragments in dir in file-name order.
+//
+// A fragment is a markdown file (*.md) holding one or more Keep a Changelog
+// "### Section" headings with bullets beneath them and no version header —
+// the format written by --single. README.md and dotfiles are ignored so the
+// directory can carry its own documentation and a .gitkeep.
+// A missing directory is treated as empty.
+func readFragments(dir string) ([]ai.Fragment, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading fragments: %w", err)
+	}
+
+	var fragments []ai.Fragment
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, ".md") || strings.EqualFold(name, "README.md") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("reading fragment %s: %w", name, err)
+		}
+		if strings.TrimSpace(string(data)) == "" {
+			continue
+		}
+		fragments = append(fragments, ai.Fragment{Name: name, Content: string(data)})
+	}
+	return fragments, nil
+}
+
+// removeFragments deletes the fragment files that were assembled into a
+// release.
+func removeFragments(dir string, fragments []ai.Fragment) error {
+	for _, f := range fragments {
+		if err := os.Remove(filepath.Join(dir, f.Name)); err != nil {
+			return fmt.Errorf("removing fragment %s: %w", f.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nealwashere/ai-changelog-generator/internal/ai"
+)
+
+// runGoldenTest runs every case under the --golden-test directory and prints
+// a unified diff for each whose output differs from its expected.md. A case
+// is a subdirectory holding a saved prompt.md, optionally its system.md, and
+// expected.md; with --golden-mock, its response.md stands in for the model.
+// The prompts are sent as with --replay, and the responses go through the
+// same post-processing as a normal run before they are compared.
+func runGoldenTest(cfg config, style ai.Style) error {
+	conflicts := savedPromptConflicts(cfg)
+	if cfg.Output != "" {
+		conflicts = append(conflicts, "--output")
+	}
+	if cfg.OutputDir != "" {
+		conflicts = append(conflicts, "--output-dir")
+	}
+	if cfg.Clipboard {
+		conflicts = append(conflicts, "--clipboard")
+	}
+	if len(conflicts) > 0 {
+		return invalid(fmt.Errorf("--golden-test sends saved prompts as is and only compares the responses, so it cannot be combined with: %s", strings.Join(conflicts, ", ")))
+	}
+
+	entries, err := os.ReadDir(cfg.GoldenTest)
+	if err != nil {
+		return invalid(fmt.Errorf("reading --golden-test directory: %w", err))
+	}
+	var cases []string
+	for _, e := range entries {
+		if e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+			cases = append(cases, e.Name())
+		}
+	}
+	if len(cases) == 0 {
+		return invalid(fmt.Errorf("--golden-test directory %s has no case subdirectories", cfg.GoldenTest))
+	}
+
+	failed := 0
+	provider := generator.Provider
+	for _, name := range cases {
+		generator.Provider = provider
+		same, err := runGoldenCase(cfg, style, name)
+		if err != nil {
+			return fmt.Errorf("golden case %s: %w", name, err)
+		}
+		if same {
+			fmt.Fprintf(os.Stderr, "info: ok   %s\n", name)
+		} else {
+			fmt.Fprintf(os.Stderr, "info: FAIL %s\n", name)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d golden case(s) differ from expected.md", failed, len(cases))
+	}
+	fmt.Fprintf(os.Stderr, "info: all %d golden case(s) match\n", len(cases))
+	return nil
+}
+
+// runGoldenCase generates the response for the case directory name and
+// reports whether it matches expected.md, printing the diff when it does not.
+// Trailing newlines are ignored in the comparison.
+func runGoldenCase(cfg config, style ai.Style, name string) (bool, error) {
+	dir := filepath.Join(cfg.GoldenTest, name)
+	expected, err := os.ReadFile(filepath.Join(dir, "expected.md"))
+	if err != nil {
+		return false, invalid(fmt.Errorf("reading expected output: %w", err))
+	}
+	req, _, err := savedPromptRequest(cfg, style, filepath.Join(dir, "prompt.md"))
+	if err != nil {
+		return false, err
+	}
+	req.From = "golden case " + name
+
+	if cfg.GoldenMock {
+		response, err := os.ReadFile(filepath.Join(dir, "response.md"))
+		if errors.Is(err, os.ErrNotExist) {
+			return false, invalid(fmt.Errorf("--golden-mock needs a response.md in %s", dir))
+		}
+		if err != nil {
+			return false, fmt.Errorf("reading canned response: %w", err)
+		}
+		generator.Provider = &ai.Mock{Responses: map[string]string{ai.BuildPrompt(req): string(response)}}
+	}
+
+	got, err := generate(cfg, req, io.Discard)
+	if err != nil {
+		return false, err
+	}
+	want := strings.TrimRight(string(expected), "\n") + "\n"
+	got = strings.TrimRight(got, "\n") + "\n"
+	if diff := unifiedDiff(filepath.ToSlash(filepath.Join(name, "expected.md")), want, got); diff != "" {
+		fmt.Print(diff)
+		return false, nil
+	}
+	return true, nil
+}
@@ -4,99 +4,614 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"regexp"
+	"sort"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/anthropics/anthropic-sdk-go"
 	"github.com/anthropics/anthropic-sdk-go/option"
+
+	"github.com/nealwashere/ai-changelog-generator/internal/git"
 )
 
 // Request holds all parameters for changelog generation.
 type Request struct {
 	APIKey        string
 	Model         string
+	APIVersion    string // anthropic-version header override; empty uses the SDK default
 	From          string
 	To            string
-	VersionHeader string // e.g. "## [v1.2.0] - 2026-02-22" or "## [Unreleased]"
-	Commits       []string
+	VersionHeader string // e.g. "## [v1.2.0] - 2026-02-22" or "## [Unreleased]"; empty for a fragment
+	Commits       []git.Commit
+	LogFormat     LogFormat // how commits are rendered in the prompt; defaults to LogOneline
+	MaxSubject    int       // truncate commit subjects longer than this many characters; 0 means no limit
 	DiffStat      string
 	FullDiff      string // empty means stat-only mode
-	Out           io.Writer
+	Fragments     []Fragment
+	Repos         []Changes        // per-repository changes for an aggregated changelog; replaces Commits/DiffStat/FullDiff
+	IssueLabels   map[int][]string // forge labels of issues/PRs referenced as #N
+	Scopes        ScopeStyle       // how conventional-commit scopes are rendered
+
+	PreviousEntries string // newest entries of the existing changelog, which must not be repeated
+	PreviousNotes   string // annotation of the last release tag, for consistent terminology
+
+	APIChanges []string // incompatible changes to the exported Go API, from --go-api-diff
+
+	// UpgradeNotes are upgrade instructions from commit trailers. They are
+	// not given to the model to rewrite: AddUpgradeNotes puts them into the
+	// entry verbatim.
+	UpgradeNotes []string
+
+	Locale            string // BCP-47 language tag to write in; empty means English
+	TranslateHeadings bool   // with Locale, translate the ### section headings as well
+
+	Headline bool  // ask for a one-sentence plain-text summary instead of a changelog
+	Style    Style // output format; defaults to StyleKeepAChangelog
+	Compact  bool  // fold dependency bumps and trivial changes into single bullets
+	Cite     bool  // end each bullet with the SHAs of the commits it describes
+	Explain  bool  // add a rationale line under each bullet; see StripRationales
+	MaxChars int   // ask for an entry of at most this many characters; see TrimToLength
+
+	Repair *Repair // when set, ask the model to fix this earlier response
+
+	// Prompt and System, when set, are sent verbatim in place of BuildPrompt
+	// and SystemPrompt, e.g. to replay a prompt saved by WriteDebug.
+	Prompt string
+	System string
+
+	Out io.Writer
+
+	// OnDelta, when set, is called with each piece of text as it is written
+	// to Out, for embedding UIs that render the response live. The pieces
+	// joined are Result.Text. It runs on the generating goroutine, so it
+	// should return quickly.
+	OnDelta func(text string)
+}
+
+var apiVersionRe = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+
+// ValidateAPIVersion checks that v has the YYYY-MM-DD form the API expects in
+// its anthropic-version header.
+func ValidateAPIVersion(v string) error {
+	if !apiVersionRe.MatchString(v) {
+		return fmt.Errorf("anthropic version %q must be a date in YYYY-MM-DD form (e.g. 2023-06-01)", v)
+	}
+	return nil
+}
+
+var localeRe = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+// ValidateLocale checks that tag looks like a BCP-47 language tag
+// (e.g. "de", "pt-BR", "zh-Hant").
+func ValidateLocale(tag string) error {
+	if !localeRe.MatchString(tag) {
+		return fmt.Errorf("locale %q is not a BCP-47 language tag (e.g. de, pt-BR)", tag)
+	}
+	return nil
+}
+
+// Changes holds the git data gathered for one range.
+type Changes struct {
+	Repo     string // repository label; set only for aggregated changelogs
+	Commits  []git.Commit
+	DiffStat string
+	FullDiff string // empty means stat-only mode
+}
+
+// Fragment is a pre-written changelog fragment (see --single) to be merged
+// into the release entry.
+type Fragment struct {
+	Name    string // file name, for reference only
+	Content string // ### sections with bullets
+}
+
+// LogFormat selects how much per-commit detail is included in the prompt.
+type LogFormat string
+
+const (
+	LogOneline    LogFormat = "oneline"     // SHA and subject
+	LogWithAuthor LogFormat = "with-author" // SHA, subject, and author
+	LogWithDate   LogFormat = "with-date"   // SHA, subject, and date
+	LogFull       LogFormat = "full"        // SHA, subject, author, date, and body
+)
+
+// ParseLogFormat validates a --log-format value.
+func ParseLogFormat(s string) (LogFormat, error) {
+	switch f := LogFormat(s); f {
+	case LogOneline, LogWithAuthor, LogWithDate, LogFull:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown log format %q (want oneline, with-author, with-date, or full)", s)
+}
+
+// Style selects the format of the generated entry.
+type Style string
+
+const (
+	StyleKeepAChangelog Style = "keep-a-changelog" // ## [version] header and ### sections of bullets
+	StyleNews           Style = "news"             // GNU NEWS: "Version x (date)" header and prose
+)
+
+// ParseStyle validates a --style value.
+func ParseStyle(s string) (Style, error) {
+	switch st := Style(s); st {
+	case StyleKeepAChangelog, StyleNews:
+		return st, nil
+	}
+	return "", fmt.Errorf("unknown style %q (want keep-a-changelog or news)", s)
+}
+
+// truncate shortens s to at most max characters, ending with an ellipsis when
+// anything was cut. It counts and cuts on rune boundaries so the result stays
+// valid UTF-8.
+func truncate(s string, max int) string {
+	if max <= 0 || utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:max-1]) + "…"
+}
+
+// writeCommit renders a single commit as a markdown bullet according to f.
+func writeCommit(sb *strings.Builder, c git.Commit, f LogFormat, maxSubject int) {
+	sb.WriteString("- ")
+	sb.WriteString(c.SHA)
+	sb.WriteString(" ")
+	sb.WriteString(truncate(c.Subject, maxSubject))
+	switch f {
+	case LogWithAuthor:
+		fmt.Fprintf(sb, " (%s)", c.Author)
+	case LogWithDate:
+		fmt.Fprintf(sb, " (%s)", c.Date)
+	case LogFull:
+		fmt.Fprintf(sb, " (%s, %s)", c.Author, c.Date)
+	}
+	sb.WriteString("\n")
+	if f == LogFull && c.Body != "" {
+		for _, line := range strings.Split(c.Body, "\n") {
+			sb.WriteString("  ")
+			sb.WriteString(line)
+			sb.WriteString("\n")
+		}
+	}
 }
 
 const systemPrompt = `You are a technical writer that generates git release changelogs in Keep a Changelog format (https://keepachangelog.com/).
 
 Rules:
-- Use the exact version header provided in the request
+- Use the exact version header provided in the request, or none when asked for a fragment
 - Use these H3 sections (only include non-empty ones): ### Added, ### Changed, ### Deprecated, ### Removed, ### Fixed, ### Security
 - Each item is a bullet point written in past tense (e.g., "Added support for X", "Fixed bug in Y")
 - Be concise and factual — do not invent or hallucinate changes not present in the provided information
 - No preamble, commentary, or text outside the changelog structure
 - Output only the changelog markdown, nothing else`
 
-// GenerateChangelog streams a Keep a Changelog formatted entry to req.Out.
-func GenerateChangelog(ctx context.Context, req Request) error {
-	client := anthropic.NewClient(option.WithAPIKey(req.APIKey))
+const headlinePrompt = `You are a technical writer that summarizes software releases for announcements.
+
+Rules:
+- Reply with exactly one sentence summarizing the most important changes in the release
+- Plain text only: no markdown, headings, bullets, or quotes
+- Be concise and factual — do not invent or hallucinate changes not present in the provided information
+- No preamble or commentary`
+
+const newsPrompt = `You are a technical writer that writes release entries for a GNU-style NEWS file.
+
+Rules:
+- Start with the exact version header provided in the request, on a line of its own, followed by a blank line
+- Describe the noteworthy changes in a few short paragraphs of plain prose, most important first
+- No markdown: no headings, bullets, sections such as "Added" or "Fixed", or emphasis
+- Wrap lines at 72 characters
+- Be concise and factual — do not invent or hallucinate changes not present in the provided information
+- No preamble, commentary, or text outside the entry
+- Output only the NEWS entry, nothing else`
+
+// SystemPrompt returns the system prompt used for req.
+func SystemPrompt(req Request) string {
+	switch {
+	case req.System != "":
+		return req.System
+	case req.Headline:
+		return headlinePrompt
+	case req.Style == StyleNews:
+		return newsPrompt
+	}
+	return systemPrompt
+}
+
+// writeFenced writes content as a fenced code block. The fence is one backtick
+// longer than the longest backtick run in content (and at least three), so
+// markdown code blocks inside diffs of documentation cannot close it early.
+func writeFenced(sb *strings.Builder, lang, content string) {
+	longest, run := 0, 0
+	for i := 0; i < len(content); i++ {
+		if content[i] == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	fence := strings.Repeat("`", max(3, longest+1))
+
+	sb.WriteString(fence)
+	sb.WriteString(lang)
+	sb.WriteString("\n")
+	sb.WriteString(content)
+	sb.WriteString("\n")
+	sb.WriteString(fence)
+	sb.WriteString("\n\n")
+}
+
+// writeChanges renders the commit log, diff stat, and full diff of c under
+// headings of the given level.
+func writeChanges(sb *strings.Builder, level string, c Changes, req Request) {
+	commits := c.Commits
+	var bumps []git.Commit
+	if req.Compact {
+		commits, bumps = git.SplitDependencyBumps(c.Commits)
+	}
+	if len(commits) > 0 {
+		sb.WriteString(level + " Commit Messages\n\n")
+		for _, cm := range commits {
+			writeCommit(sb, cm, req.LogFormat, req.MaxSubject)
+		}
+		sb.WriteString("\n")
+	}
+	if len(bumps) > 0 {
+		sb.WriteString(level + " Dependency Updates\n\n")
+		where := " under ### Changed"
+		if req.Style == StyleNews {
+			where = ""
+		}
+		fmt.Fprintf(sb, "%d automated dependency update commit(s) are not listed. Cover them with a single \"Updated dependencies\" item%s that gives the count (%d); do not describe them individually, even where they appear in the diff.\n\n", len(bumps), where, len(bumps))
+	}
+
+	if c.DiffStat != "" {
+		sb.WriteString(level + " Diff Statistics\n\n")
+		writeFenced(sb, "", c.DiffStat)
+	}
+
+	if c.FullDiff != "" {
+		diff, garbled := sanitizeDiff(c.FullDiff)
+		sb.WriteString(level + " Full Diff\n\n")
+		if len(garbled) > 0 {
+			fmt.Fprintf(sb, "These files are not UTF-8 encoded; their undecodable bytes are shown as \uFFFD: %s. Do not mention the replacement characters.\n\n", strings.Join(garbled, ", "))
+		}
+		writeFenced(sb, "diff", diff)
+	}
+}
+
+// APIError is returned when the request to the model API fails, as opposed
+// to a failure writing the output.
+type APIError struct {
+	Op  string // what was being attempted, e.g. "streaming error"
+	Err error
+}
+
+func (e *APIError) Error() string { return e.Op + ": " + e.Err.Error() }
+
+func (e *APIError) Unwrap() error { return e.Err }
+
+// MaxTokens caps the length of the generated changelog.
+const MaxTokens = 4096
 
+// BuildPrompt assembles the user message sent to the model for req.
+func BuildPrompt(req Request) string {
+	if req.Prompt != "" {
+		return req.Prompt
+	}
 	var sb strings.Builder
-	sb.WriteString("Generate a changelog for the changes from `")
+	if req.Headline {
+		sb.WriteString("Summarize the release covering the changes from `")
+	} else if req.Style == StyleNews {
+		sb.WriteString("Write a NEWS entry for the changes from `")
+	} else {
+		sb.WriteString("Generate a changelog for the changes from `")
+	}
 	sb.WriteString(req.From)
 	sb.WriteString("` to `")
 	sb.WriteString(req.To)
-	sb.WriteString("`.\n\nVersion header to use: ")
-	sb.WriteString(req.VersionHeader)
-	sb.WriteString("\n\n")
+	if req.Headline {
+		sb.WriteString("` in a single sentence.\n\n")
+	} else if req.VersionHeader == "" {
+		sb.WriteString("`.\n\nThis is a changelog fragment for a single change: omit the version header and output only the ### sections.\n\n")
+	} else {
+		sb.WriteString("`.\n\nVersion header to use: ")
+		sb.WriteString(req.VersionHeader)
+		sb.WriteString("\n\n")
+	}
 
-	if len(req.Commits) > 0 {
-		sb.WriteString("## Commit Messages\n\n")
-		for _, c := range req.Commits {
-			sb.WriteString("- ")
-			sb.WriteString(c)
-			sb.WriteString("\n")
+	if req.Compact && !req.Headline {
+		sb.WriteString("Keep the changelog compact: summarize trivial changes such as typo fixes, formatting, and comment or whitespace edits in a single item instead of listing each one.\n\n")
+	}
+
+	if req.MaxChars > 0 {
+		fmt.Fprintf(&sb, "Keep the entire entry, including the version header, under %d characters: it is published where longer text is cut off. Describe breaking changes, additions, and fixes first, and leave out minor changes rather than shortening every item.\n\n", req.MaxChars)
+	}
+
+	if req.Cite && !req.Headline {
+		sb.WriteString("End each bullet with the abbreviated SHAs of the commits it describes, exactly as listed under Commit Messages, in parentheses: (abc1234) or (abc1234, def5678).\n\n")
+	}
+
+	if req.Explain && !req.Headline {
+		sb.WriteString(explainInstruction)
+	}
+
+	if req.Locale != "" {
+		fmt.Fprintf(&sb, "Write the changelog in the language identified by the BCP-47 tag %q. ", req.Locale)
+		if req.Headline {
+			sb.WriteString("\n\n")
+		} else if req.Style == StyleNews {
+			sb.WriteString("Keep the version header exactly as given.\n\n")
+		} else if req.TranslateHeadings {
+			sb.WriteString("Translate the ### section headings into that language too, but keep the version header exactly as given.\n\n")
+		} else {
+			sb.WriteString("Keep the version header and the ### section headings exactly as given in English; translate only the bullet text.\n\n")
+		}
+	}
+
+	if len(req.Repos) == 0 {
+		writeChanges(&sb, "##", Changes{Commits: req.Commits, DiffStat: req.DiffStat, FullDiff: req.FullDiff}, req)
+	} else {
+		sb.WriteString("The changes span several repositories. Start each bullet with the repository name in bold (e.g. **api:**).\n\n")
+		for _, r := range req.Repos {
+			sb.WriteString("## Repository `")
+			sb.WriteString(r.Repo)
+			sb.WriteString("`\n\n")
+			writeChanges(&sb, "###", r, req)
+		}
+	}
+
+	commits := req.Commits
+	for _, r := range req.Repos {
+		commits = append(commits, r.Commits...)
+	}
+	sb.WriteString(scopeInstructions(req.Scopes, commits))
+
+	if len(req.IssueLabels) > 0 {
+		sb.WriteString("## Issue Labels\n\n")
+		sb.WriteString("Labels of the issues and pull requests referenced in the commits. Within each section, group bullets by their area/kind label, keeping bullets with the same label together and ordered by label.\n\n")
+		nums := make([]int, 0, len(req.IssueLabels))
+		for n := range req.IssueLabels {
+			nums = append(nums, n)
+		}
+		sort.Ints(nums)
+		for _, n := range nums {
+			fmt.Fprintf(&sb, "- #%d: %s\n", n, strings.Join(req.IssueLabels[n], ", "))
 		}
 		sb.WriteString("\n")
 	}
 
-	if req.DiffStat != "" {
-		sb.WriteString("## Diff Statistics\n\n```\n")
-		sb.WriteString(req.DiffStat)
-		sb.WriteString("\n```\n\n")
+	if len(req.APIChanges) > 0 {
+		sb.WriteString("## Go API Changes\n\n")
+		sb.WriteString("These incompatible changes to the exported Go API were found by comparing the parsed source of both versions, so they are authoritative. Each one breaks code that uses the package: describe all of them as breaking changes, under Removed or Changed, even where the commit messages do not mention them.\n\n")
+		for _, c := range req.APIChanges {
+			sb.WriteString("- " + c + "\n")
+		}
+		sb.WriteString("\n")
 	}
 
-	if req.FullDiff != "" {
-		sb.WriteString("## Full Diff\n\n```diff\n")
-		sb.WriteString(req.FullDiff)
-		sb.WriteString("\n```\n")
+	if len(req.UpgradeNotes) > 0 {
+		sb.WriteString("## Upgrade Notes\n\n")
+		fmt.Fprintf(&sb, "%d upgrade instruction(s) from the commits will be added to the entry word for word as its ### %s section. Do not write that section yourself or repeat the instructions; describe the changes they belong to under the usual sections as always.\n\n", len(req.UpgradeNotes), UpgradeNotesTitle)
 	}
 
-	stream := client.Messages.NewStreaming(ctx, anthropic.MessageNewParams{
-		Model:     anthropic.Model(req.Model),
-		MaxTokens: 4096,
-		System: []anthropic.TextBlockParam{
-			{Text: systemPrompt},
+	if len(req.Fragments) > 0 {
+		sb.WriteString("## Changelog Fragments\n\n")
+		sb.WriteString("Merge these fragments into the single entry: combine duplicate items and place each item under the appropriate section.\n\n")
+		for _, f := range req.Fragments {
+			sb.WriteString("Fragment `")
+			sb.WriteString(f.Name)
+			sb.WriteString("`:\n\n")
+			writeFenced(&sb, "markdown", strings.TrimSpace(f.Content))
+		}
+	}
+
+	if req.PreviousNotes != "" {
+		sb.WriteString("## Previous Release Notes\n\n")
+		sb.WriteString("These are the notes of the previous release, from its tag. Use the same terminology and names for features, components, and options where the changes touch them, but do not repeat their content.\n\n")
+		writeFenced(&sb, "text", req.PreviousNotes)
+	}
+
+	if req.PreviousEntries != "" {
+		sb.WriteString("## Already Documented\n\n")
+		sb.WriteString("These entries are already in the changelog. Do not repeat changes they describe; include only items that are not covered there, and leave out any section that would then be empty.\n\n")
+		writeFenced(&sb, "markdown", req.PreviousEntries)
+	}
+
+	if req.Repair != nil {
+		writeRepair(&sb, req.Repair)
+	}
+	// Commit messages and paths can carry legacy-encoded bytes too.
+	return strings.ToValidUTF8(sb.String(), "\uFFFD")
+}
+
+// newClient returns an API client configured from req.
+func newClient(req Request) anthropic.Client {
+	opts := []option.RequestOption{option.WithAPIKey(req.APIKey)}
+	if req.APIVersion != "" {
+		opts = append(opts, option.WithHeader("anthropic-version", req.APIVersion))
+	}
+	return anthropic.NewClient(opts...)
+}
+
+// CountTokens returns the number of input tokens the prompt for req uses, as
+// counted by the API with req.Model's tokenizer.
+func CountTokens(ctx context.Context, req Request) (int, error) {
+	client := newClient(req)
+	res, err := client.Messages.CountTokens(ctx, anthropic.MessageCountTokensParams{
+		Model: anthropic.Model(req.Model),
+		System: anthropic.MessageCountTokensParamsSystemUnion{
+			OfTextBlockArray: []anthropic.TextBlockParam{{Text: SystemPrompt(req)}},
 		},
 		Messages: []anthropic.MessageParam{
-			anthropic.NewUserMessage(anthropic.NewTextBlock(sb.String())),
+			anthropic.NewUserMessage(anthropic.NewTextBlock(BuildPrompt(req))),
 		},
 	})
+	if err != nil {
+		return 0, &APIError{Op: "counting tokens", Err: err}
+	}
+	return int(res.InputTokens), nil
+}
+
+// EstimateTokens approximates the input tokens of the prompt for req without
+// calling the API. It assumes about three bytes per token, which overstates
+// typical English and code, so it errs towards rejecting borderline prompts.
+func EstimateTokens(req Request) int {
+	n := len(SystemPrompt(req)) + len(BuildPrompt(req))
+	return (n + 2) / 3
+}
+
+// Result describes a completed generation.
+type Result struct {
+	Text         string // everything written to Request.Out, including the final newline
+	Model        string // the model that answered, as reported by the API
+	StopReason   string // e.g. "end_turn", or "max_tokens" when the output was cut off
+	InputTokens  int
+	OutputTokens int
+}
+
+// GenerateChangelog streams a Keep a Changelog formatted entry to req.Out and
+// returns it with the usage of the request. It is shorthand for a one-off
+// Generator.
+func GenerateChangelog(ctx context.Context, req Request) (Result, error) {
+	var g Generator
+	return g.Generate(ctx, req)
+}
+
+// Generator runs successive generations, pacing them by the rate limits the
+// API reports so that batch runs slow down before they are throttled.
+type Generator struct {
+	Logf func(format string, args ...any) // verbose diagnostics, one line per call; nil discards them
+
+	// Keys, when set, replace Request.APIKey: requests rotate through them
+	// round-robin, skipping keys whose last response showed them throttled.
+	Keys []string
+
+	// MaxRetryWait caps how long a retry waits for the delay a 429 response
+	// asks for in its retry-after header; longer delays fail the request.
+	// Zero means DefaultMaxRetryWait.
+	MaxRetryWait time.Duration
+
+	// NoStream requests each response whole with a non-streaming call and
+	// writes it to Request.Out at once, for proxies and gateways that buffer
+	// or break server-sent events. The text is the same as when streaming.
+	NoStream bool
+
+	// Provider, when set, answers every request in place of the Anthropic
+	// API; see Mock and Fake.
+	Provider Provider
+
+	limits map[string]*RateLimits // from the most recent response for each key
+	next   int                    // index in Keys where the next rotation starts
+}
+
+// Generate streams a Keep a Changelog formatted entry to req.Out, first
+// waiting for the rate limit to reset if the previous responses showed too
+// little headroom for this request with any key. On an error after streaming
+// began, the Result holds the partial text.
+func (g *Generator) Generate(ctx context.Context, req Request) (Result, error) {
+	if g.Provider != nil {
+		return g.Provider.Generate(req)
+	}
+	var res Result
+	if err := g.pace(ctx, req); err != nil {
+		return res, err
+	}
+
+	client := newClient(req)
+	opts := []option.RequestOption{
+		option.WithMiddleware(g.observe(EstimateTokens(req))),
+		option.WithMaxRetries(g.maxRetries()),
+	}
+	params := messageParams(req)
+	if g.NoStream {
+		return generateWhole(ctx, client, params, opts, req)
+	}
+	stream := client.Messages.NewStreaming(ctx, params, opts...)
 
+	var text strings.Builder
+	out := io.MultiWriter(req.Out, &text)
 	for stream.Next() {
 		event := stream.Current()
 		switch ev := event.AsAny().(type) {
+		case anthropic.MessageStartEvent:
+			res.Model = string(ev.Message.Model)
+			res.InputTokens = int(ev.Message.Usage.InputTokens)
 		case anthropic.ContentBlockDeltaEvent:
 			switch d := ev.Delta.AsAny().(type) {
 			case anthropic.TextDelta:
-				if _, err := fmt.Fprint(req.Out, d.Text); err != nil {
-					return err
+				if _, err := fmt.Fprint(out, d.Text); err != nil {
+					res.Text = text.String()
+					return res, err
 				}
+				onDelta(req, d.Text)
 			}
+		case anthropic.MessageDeltaEvent:
+			res.StopReason = string(ev.Delta.StopReason)
+			res.OutputTokens = int(ev.Usage.OutputTokens)
 		}
 	}
 
 	if err := stream.Err(); err != nil {
-		return fmt.Errorf("streaming error: %w", err)
+		res.Text = text.String()
+		return res, &APIError{Op: "streaming error", Err: err}
 	}
 
 	// Ensure trailing newline.
-	_, _ = fmt.Fprintln(req.Out)
-	return nil
+	_, _ = fmt.Fprintln(out)
+	onDelta(req, "\n")
+	res.Text = text.String()
+	return res, nil
+}
+
+// messageParams is the body of the Messages API request for req.
+func messageParams(req Request) anthropic.MessageNewParams {
+	return anthropic.MessageNewParams{
+		Model:     anthropic.Model(req.Model),
+		MaxTokens: MaxTokens,
+		System: []anthropic.TextBlockParam{
+			{Text: SystemPrompt(req)},
+		},
+		Messages: []anthropic.MessageParam{
+			anthropic.NewUserMessage(anthropic.NewTextBlock(BuildPrompt(req))),
+		},
+	}
+}
+
+// generateWhole answers req with a single non-streaming request, for
+// Generator.NoStream, and writes the text to req.Out once it is complete.
+func generateWhole(ctx context.Context, client anthropic.Client, params anthropic.MessageNewParams, opts []option.RequestOption, req Request) (Result, error) {
+	var res Result
+	msg, err := client.Messages.New(ctx, params, opts...)
+	if err != nil {
+		return res, &APIError{Op: "request failed", Err: err}
+	}
+	res.Model = string(msg.Model)
+	res.StopReason = string(msg.StopReason)
+	res.InputTokens = int(msg.Usage.InputTokens)
+	res.OutputTokens = int(msg.Usage.OutputTokens)
+
+	var text strings.Builder
+	for _, block := range msg.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+	text.WriteString("\n")
+	res.Text = text.String()
+	if _, err := io.WriteString(req.Out, res.Text); err != nil {
+		return res, err
+	}
+	onDelta(req, res.Text)
+	return res, nil
+}
+
+// onDelta passes text to req.OnDelta, if set.
+func onDelta(req Request, text string) {
+	if req.OnDelta != nil {
+		req.OnDelta(text)
+	}
 }
@@ -0,0 +1,24 @@
+package ai
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildPromptFencesDiffWithCodeBlocks(t *testing.T) {
+	for _, tc := range []struct {
+		name, diff, fence string
+	}{
+		{"plain diff", "+func main() {}", "```"},
+		{"markdown code block", "+```go\n+func main() {}\n+```", "````"},
+		{"longer backtick run", "+`````\n+quoted\n+`````", "``````"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			prompt := BuildPrompt(Request{From: "v1.0.0", To: "HEAD", FullDiff: tc.diff})
+			want := "\n" + tc.fence + "diff\n" + tc.diff + "\n" + tc.fence + "\n"
+			if !strings.Contains(prompt, want) {
+				t.Errorf("prompt does not fence the diff as\n%s\nprompt:\n%s", want, prompt)
+			}
+		})
+	}
+}
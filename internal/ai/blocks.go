@@ -0,0 +1,107 @@
+package ai
+
+import (
+	"regexp"
+	"strings"
+)
+
+// blockKind tells the blocks of an entry apart for the renderers.
+type blockKind int
+
+const (
+	textBlock    blockKind = iota // a line of text outside the lists
+	headingBlock                  // a "#" to "######" heading
+	listBlock                     // consecutive top-level bullets
+	commentBlock                  // a line holding a single HTML comment
+	codeBlock                     // a fenced code block, fences included
+)
+
+// block is one top-level block of an entry, in source order.
+type block struct {
+	kind  blockKind
+	level int      // heading level
+	text  string   // heading text, a line of text, a comment, or the code block
+	items []string // list items, formatted as Section.Bullets
+}
+
+var headingRe = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*$`)
+
+// fenceStart returns the fence that the trimmed line opens, "```" or "~~~",
+// or "" when it does not open one.
+func fenceStart(trimmed string) string {
+	if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+		return trimmed[:3]
+	}
+	return ""
+}
+
+// closesFence reports whether the trimmed line closes a code block opened
+// with fence.
+func closesFence(trimmed, fence string) bool {
+	return strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == ""
+}
+
+// parseBlocks splits an entry into its blocks for RenderHTML and RenderJSON.
+// Unlike ParseChangelog, which groups everything after a ### heading into
+// its section for the rewrites, it keeps the blocks in order so that a
+// footer line, or the heading of a following entry, stays where it is. An
+// indented line continues the list item directly above it; after a blank
+// line it is ordinary text, unless it opens a code block. Code blocks are
+// kept whole, blank lines included, and nothing inside them is taken for a
+// heading or a bullet.
+func parseBlocks(text string) []block {
+	var blocks []block
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	inItem := false // the previous line belongs to a list item
+	gap := false    // the previous line is blank and follows a list item
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], " \t")
+		trimmed := strings.TrimSpace(line)
+		indented := line != "" && (line[0] == ' ' || line[0] == '\t')
+		if fence := fenceStart(trimmed); fence != "" {
+			end := i + 1
+			for end < len(lines) && !closesFence(strings.TrimSpace(lines[end]), fence) {
+				end++
+			}
+			end = min(end, len(lines)-1)
+			code := strings.Join(lines[i:end+1], "\n")
+			if (inItem || gap) && indented {
+				items := blocks[len(blocks)-1].items
+				items[len(items)-1] += "\n" + code
+				inItem = true
+			} else {
+				blocks = append(blocks, block{kind: codeBlock, text: code})
+				inItem = false
+			}
+			gap = false
+			i = end
+			continue
+		}
+		gap = inItem && trimmed == ""
+
+		switch m := headingRe.FindStringSubmatch(line); {
+		case trimmed == "":
+			inItem = false
+		case inItem && indented:
+			items := blocks[len(blocks)-1].items
+			items[len(items)-1] += "\n" + trimmed
+		case isBullet(line):
+			if n := len(blocks); n == 0 || blocks[n-1].kind != listBlock {
+				blocks = append(blocks, block{kind: listBlock})
+			}
+			b := &blocks[len(blocks)-1]
+			b.items = append(b.items, strings.TrimSpace(line[2:]))
+			inItem = true
+		case m != nil:
+			blocks = append(blocks, block{kind: headingBlock, level: len(m[1]), text: m[2]})
+			inItem = false
+		case isHTMLComment(trimmed):
+			blocks = append(blocks, block{kind: commentBlock, text: trimmed})
+			inItem = false
+		default:
+			blocks = append(blocks, block{kind: textBlock, text: trimmed})
+			inItem = false
+		}
+	}
+	return blocks
+}
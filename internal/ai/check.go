@@ -0,0 +1,102 @@
+package ai
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Finding is a generated bullet that references names absent from the input.
+type Finding struct {
+	Bullet  string
+	Missing []string
+}
+
+var (
+	codeSpanRe = regexp.MustCompile("`([^`]+)`")
+	// linkTargetRe matches the target of an inline markdown link, "](url)",
+	// which the tool's own rewrites such as LinkJira add.
+	linkTargetRe = regexp.MustCompile(`\]\([^)]*\)`)
+	fileRe       = regexp.MustCompile(`[\w./-]*\w{2,}\.[A-Za-z][A-Za-z0-9]{0,7}\b`)
+)
+
+// CheckHallucinations scans the bullets of a generated changelog for code
+// spans and file names, and reports those that appear nowhere in the commits,
+// diff stat, or full diff the model was given. It is a heuristic: it catches
+// invented files and identifiers, not invented prose.
+func CheckHallucinations(changelog string, req Request) []Finding {
+	corpus := inputCorpus(req)
+
+	var findings []Finding
+	for _, line := range strings.Split(changelog, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasPrefix(trimmed, "- ") && !strings.HasPrefix(trimmed, "* ") {
+			continue
+		}
+		var missing []string
+		seen := map[string]bool{}
+		for _, ref := range references(trimmed[2:]) {
+			if seen[ref] || referenced(corpus, ref) {
+				continue
+			}
+			seen[ref] = true
+			missing = append(missing, ref)
+		}
+		if len(missing) > 0 {
+			findings = append(findings, Finding{Bullet: trimmed, Missing: missing})
+		}
+	}
+	return findings
+}
+
+// references extracts code spans and file-like tokens from a bullet. Link
+// targets are not references: only the link text is read.
+func references(bullet string) []string {
+	bullet = linkTargetRe.ReplaceAllString(bullet, "]")
+	var refs []string
+	for _, m := range codeSpanRe.FindAllStringSubmatch(bullet, -1) {
+		refs = append(refs, strings.TrimSpace(m[1]))
+	}
+	rest := codeSpanRe.ReplaceAllString(bullet, " ")
+	for _, m := range fileRe.FindAllString(rest, -1) {
+		refs = append(refs, strings.TrimRight(m, "."))
+	}
+	return refs
+}
+
+// referenced reports whether ref (or, for paths, its base name) occurs in
+// corpus.
+func referenced(corpus, ref string) bool {
+	if ref == "" || strings.Contains(corpus, ref) {
+		return true
+	}
+	return strings.Contains(ref, "/") && strings.Contains(corpus, path.Base(ref))
+}
+
+// inputCorpus concatenates everything the model saw about the changes.
+func inputCorpus(req Request) string {
+	var sb strings.Builder
+	all := append([]Changes{{Commits: req.Commits, DiffStat: req.DiffStat, FullDiff: req.FullDiff}}, req.Repos...)
+	for _, ch := range all {
+		for _, c := range ch.Commits {
+			sb.WriteString(c.Subject)
+			sb.WriteString("\n")
+			sb.WriteString(c.Body)
+			sb.WriteString("\n")
+		}
+		sb.WriteString(ch.DiffStat)
+		sb.WriteString("\n")
+		sb.WriteString(ch.FullDiff)
+		sb.WriteString("\n")
+	}
+	for _, f := range req.Fragments {
+		sb.WriteString(f.Content)
+		sb.WriteString("\n")
+	}
+	// --go-api-diff changes are on the request only, as --repos rejects it.
+	for _, c := range req.APIChanges {
+		sb.WriteString(c)
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
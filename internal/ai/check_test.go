@@ -0,0 +1,56 @@
+package ai
+
+import (
+	"testing"
+
+	"github.com/nealwashere/ai-changelog-generator/internal/git"
+)
+
+func TestCheckHallucinationsIgnoresLinkTargets(t *testing.T) {
+	req := Request{Commits: []git.Commit{{SHA: "abc1234", Subject: "fix(parser): handle empty input (PROJ-12)"}}}
+	for _, tc := range []struct {
+		name, changelog string
+		missing         []string
+	}{
+		{"jira link", "### Fixed\n\n- Handle empty input ([PROJ-12](https://acme.atlassian.net/browse/PROJ-12))\n", nil},
+		{"link to a file", "### Fixed\n\n- Handle empty input, see [the notes](docs/notes.md)\n", nil},
+		{"invented file in the text", "### Fixed\n\n- Handle empty input in [parser.go](https://example.com)\n", []string{"parser.go"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			findings := CheckHallucinations(tc.changelog, req)
+			var missing []string
+			for _, f := range findings {
+				missing = append(missing, f.Missing...)
+			}
+			if len(missing) != len(tc.missing) || (len(missing) > 0 && missing[0] != tc.missing[0]) {
+				t.Errorf("missing = %q, want %q", missing, tc.missing)
+			}
+		})
+	}
+}
+
+func TestCheckHallucinationsUsesAPIChanges(t *testing.T) {
+	changelog := "### Removed\n\n- **Breaking:** Removed `Client.Do`; use `Client.Send` instead.\n"
+	commits := []git.Commit{{SHA: "abc1234", Subject: "refactor: rework the client"}}
+	for _, tc := range []struct {
+		name    string
+		req     Request
+		missing int
+	}{
+		{"without API changes", Request{Commits: commits}, 2},
+		{"with API changes", Request{Commits: commits, APIChanges: []string{
+			"removed: `client.Client.Do` (was `func (c *Client) Do(r *Request) (*Response, error)`)",
+			"changed: `client.Client.Send` from `func (c *Client) Send(r *Request) error` to `func (c *Client) Send(r *Request) (*Response, error)`",
+		}}, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var missing []string
+			for _, f := range CheckHallucinations(changelog, tc.req) {
+				missing = append(missing, f.Missing...)
+			}
+			if len(missing) != tc.missing {
+				t.Errorf("missing = %q, want %d", missing, tc.missing)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package ai
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/nealwashere/ai-changelog-generator/internal/git"
+)
+
+// DefaultCiteFormat renders a bullet's citations as "(abc1234, def5678)".
+const DefaultCiteFormat = "({shas})"
+
+// citationRe matches the parenthesized SHA list the model is asked to end
+// each bullet with.
+var citationRe = regexp.MustCompile(`\s*\(([0-9a-fA-F]{7,40}(?:\s*,\s*[0-9a-fA-F]{7,40})*)\)\s*$`)
+
+// CheckCitations validates the commit citations at the end of each bullet of
+// c against commits. Citations of unknown commits are removed and returned;
+// the remaining ones are rewritten in their canonical abbreviated form using
+// format, in which {shas} stands for the comma-separated list. A bullet left
+// without valid citations loses its citation entirely.
+func CheckCitations(c Changelog, commits []git.Commit, format string) (Changelog, []string) {
+	var dropped []string
+	for i := range c.Sections {
+		for j, b := range c.Sections[i].Bullets {
+			m := citationRe.FindStringSubmatchIndex(b)
+			if m == nil {
+				continue
+			}
+			var valid []string
+			for _, sha := range strings.Split(b[m[2]:m[3]], ",") {
+				sha = strings.ToLower(strings.TrimSpace(sha))
+				if known := lookupSHA(commits, sha); known != "" {
+					valid = append(valid, known)
+				} else {
+					dropped = append(dropped, sha)
+				}
+			}
+			text := b[:m[0]]
+			if len(valid) > 0 {
+				text += " " + strings.ReplaceAll(format, "{shas}", strings.Join(valid, ", "))
+			}
+			c.Sections[i].Bullets[j] = text
+		}
+	}
+	return c, dropped
+}
+
+// lookupSHA returns the SHA of the commit that sha abbreviates, or that
+// abbreviates sha, or "" when there is none.
+func lookupSHA(commits []git.Commit, sha string) string {
+	for _, c := range commits {
+		if strings.HasPrefix(c.SHA, sha) || strings.HasPrefix(sha, c.SHA) {
+			return c.SHA
+		}
+	}
+	return ""
+}
@@ -0,0 +1,113 @@
+package ai
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/nealwashere/ai-changelog-generator/internal/git"
+)
+
+// Conventional is a commit subject parsed as a Conventional Commit
+// (https://www.conventionalcommits.org/), e.g. "feat(api)!: drop v1 routes".
+type Conventional struct {
+	Type        string // e.g. "feat", "fix"; lower-cased
+	Scope       string // e.g. "api"; empty when the subject has none
+	Breaking    bool   // marked with "!" before the colon
+	Description string
+}
+
+var conventionalRe = regexp.MustCompile(`^([A-Za-z]+)(?:\(([^()]*)\))?(!)?: +(.+)$`)
+
+// ParseConventional parses subject as a Conventional Commit header. ok is
+// false when subject does not follow the format.
+func ParseConventional(subject string) (c Conventional, ok bool) {
+	m := conventionalRe.FindStringSubmatch(strings.TrimSpace(subject))
+	if m == nil {
+		return Conventional{}, false
+	}
+	return Conventional{
+		Type:        strings.ToLower(m[1]),
+		Scope:       strings.TrimSpace(m[2]),
+		Breaking:    m[3] == "!",
+		Description: m[4],
+	}, true
+}
+
+// breakingFooterRe matches the footer that marks a breaking change in the
+// body of a Conventional Commit.
+var breakingFooterRe = regexp.MustCompile(`(?m)^BREAKING[ -]CHANGE: `)
+
+// IsBreaking reports whether c declares a breaking change, with a "!" in its
+// Conventional Commit header or a BREAKING CHANGE footer in its body.
+func IsBreaking(c git.Commit) bool {
+	if cc, ok := ParseConventional(c.Subject); ok && cc.Breaking {
+		return true
+	}
+	return breakingFooterRe.MatchString(c.Body)
+}
+
+// IsDescriptive reports whether c says enough on its own for the changelog:
+// a Conventional Commit header whose description has at least three words,
+// so that "fix: typo" or "chore: wip" do not count.
+func IsDescriptive(c git.Commit) bool {
+	cc, ok := ParseConventional(c.Subject)
+	return ok && len(strings.Fields(cc.Description)) >= 3
+}
+
+// ScopeStyle selects how conventional-commit scopes appear in the changelog.
+type ScopeStyle string
+
+const (
+	ScopesDefault ScopeStyle = ""       // no instruction; the model decides
+	ScopesPrefix  ScopeStyle = "prefix" // "**api:** Added ..." on each scoped bullet
+	ScopesGroup   ScopeStyle = "group"  // bullets grouped by scope within each section
+	ScopesIgnore  ScopeStyle = "ignore" // scopes left out of the bullets
+)
+
+// ParseScopeStyle validates a --scopes value.
+func ParseScopeStyle(s string) (ScopeStyle, error) {
+	switch st := ScopeStyle(s); st {
+	case ScopesPrefix, ScopesGroup, ScopesIgnore:
+		return st, nil
+	}
+	return "", fmt.Errorf("unknown scope style %q (want prefix, group, or ignore)", s)
+}
+
+// scopeInstructions returns the prompt text telling the model how to use
+// scopes, or "" when no commit has one or style is ScopesDefault.
+func scopeInstructions(style ScopeStyle, commits []git.Commit) string {
+	if style == ScopesDefault {
+		return ""
+	}
+	var sb strings.Builder
+	var scopes []string
+	seen := map[string]bool{}
+	for _, c := range commits {
+		cc, ok := ParseConventional(c.Subject)
+		if !ok || cc.Scope == "" {
+			continue
+		}
+		fmt.Fprintf(&sb, "- %s: %s\n", c.SHA, cc.Scope)
+		if !seen[cc.Scope] {
+			seen[cc.Scope] = true
+			scopes = append(scopes, cc.Scope)
+		}
+	}
+	if len(scopes) == 0 {
+		return ""
+	}
+	sort.Strings(scopes)
+
+	var intro string
+	switch style {
+	case ScopesPrefix:
+		intro = "Start each bullet that comes from a scoped commit with its scope in bold (e.g. **" + scopes[0] + ":**). Bullets from commits without a scope get no prefix."
+	case ScopesGroup:
+		intro = "Within each section, group bullets by scope, keeping bullets with the same scope together, ordered by scope, with bullets from commits without a scope last. Do not repeat the scope in the bullet text."
+	case ScopesIgnore:
+		intro = "Do not mention these scopes in the bullets; describe each change on its own terms."
+	}
+	return "## Commit Scopes\n\nConventional-commit scopes of the commits above. " + intro + "\n\n" + sb.String() + "\n"
+}
@@ -0,0 +1,66 @@
+package ai
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// debugMeta is the sidecar written next to the prompt and response by
+// WriteDebug. It deliberately has no field for the API key.
+type debugMeta struct {
+	Model         string    `json:"model"`
+	APIVersion    string    `json:"anthropic_version,omitempty"`
+	MaxTokens     int       `json:"max_tokens"`
+	LogFormat     LogFormat `json:"log_format,omitempty"`
+	Locale        string    `json:"locale,omitempty"`
+	From          string    `json:"from"`
+	To            string    `json:"to"`
+	StartedAt     time.Time `json:"started_at"`
+	DurationMS    int64     `json:"duration_ms"`
+	PromptBytes   int       `json:"prompt_bytes"`
+	ResponseBytes int       `json:"response_bytes"`
+}
+
+// WriteDebug records a generation in dir for reproducing bad outputs:
+// system.md and prompt.md hold the exact messages sent, response.md the full
+// text reassembled from the stream, and request.json the model, parameters,
+// and timing.
+func WriteDebug(dir string, req Request, response string, started time.Time, elapsed time.Duration) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("creating debug dir: %w", err)
+	}
+
+	prompt := BuildPrompt(req)
+	meta, err := json.MarshalIndent(debugMeta{
+		Model:         req.Model,
+		APIVersion:    req.APIVersion,
+		MaxTokens:     MaxTokens,
+		LogFormat:     req.LogFormat,
+		Locale:        req.Locale,
+		From:          req.From,
+		To:            req.To,
+		StartedAt:     started,
+		DurationMS:    elapsed.Milliseconds(),
+		PromptBytes:   len(prompt),
+		ResponseBytes: len(response),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	files := []struct{ name, content string }{
+		{"system.md", SystemPrompt(req)},
+		{"prompt.md", prompt},
+		{"response.md", response},
+		{"request.json", string(meta) + "\n"},
+	}
+	for _, f := range files {
+		if err := os.WriteFile(filepath.Join(dir, f.name), []byte(f.content), 0644); err != nil {
+			return fmt.Errorf("writing %s: %w", f.name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package ai
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// sanitizeDiff replaces the bytes of diff that are not valid UTF-8, as found
+// in Latin-1 or other legacy-encoded files, with U+FFFD. It returns the
+// cleaned diff and the files in which bytes were replaced.
+func sanitizeDiff(diff string) (string, []string) {
+	if utf8.ValidString(diff) {
+		return diff, nil
+	}
+	var sb strings.Builder
+	var files []string
+	file, reported := "", false
+	for _, line := range strings.SplitAfter(diff, "\n") {
+		if strings.HasPrefix(line, "diff --git ") {
+			file, reported = strings.TrimSpace(line), false
+			if i := strings.LastIndex(file, " b/"); i != -1 {
+				file = file[i+3:]
+			}
+		}
+		if !utf8.ValidString(line) {
+			line = strings.ToValidUTF8(line, "\uFFFD")
+			if !reported && file != "" {
+				files = append(files, file)
+				reported = true
+			}
+		}
+		sb.WriteString(line)
+	}
+	return sb.String(), files
+}
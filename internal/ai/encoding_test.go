@@ -0,0 +1,82 @@
+package ai
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/nealwashere/ai-changelog-generator/internal/git"
+)
+
+func TestPromptReplacesInvalidUTF8(t *testing.T) {
+	latin1 := "caf\xe9" // "café" in Latin-1
+	for _, tc := range []struct {
+		name    string
+		req     Request
+		garbled []string // files named in the prompt as not UTF-8
+	}{
+		{
+			name: "subject",
+			req:  Request{Commits: []git.Commit{{SHA: "a1b2c3d", Subject: "fix: " + latin1 + " menu"}}},
+		},
+		{
+			name: "body",
+			req:  Request{LogFormat: LogFull, Commits: []git.Commit{{SHA: "a1b2c3d", Subject: "fix: menu", Body: "Thanks to Ren\xe9e\n\nSigned-off-by: \xff\xfe"}}},
+		},
+		{
+			name: "author",
+			req:  Request{LogFormat: LogFull, Commits: []git.Commit{{SHA: "a1b2c3d", Subject: "fix: menu", Author: "Jos\xe9"}}},
+		},
+		{
+			name: "diff",
+			req: Request{
+				Commits:  []git.Commit{{SHA: "a1b2c3d", Subject: "docs: menu"}},
+				DiffStat: " menu.txt | 2 +-\n 1 file changed, 1 insertion(+), 1 deletion(-)",
+				FullDiff: "diff --git a/menu.txt b/menu.txt\n--- a/menu.txt\n+++ b/menu.txt\n@@ -1 +1 @@\n-cafe\n+" + latin1 + "\ndiff --git a/ok.txt b/ok.txt\n+fine",
+			},
+			garbled: []string{"menu.txt"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.req.From, tc.req.To = "v1.0.0", "HEAD"
+			prompt := BuildPrompt(tc.req)
+			if !utf8.ValidString(prompt) {
+				t.Errorf("prompt is not valid UTF-8:\n%q", prompt)
+			}
+			if !strings.Contains(prompt, "\uFFFD") {
+				t.Errorf("prompt does not mark the replaced bytes:\n%s", prompt)
+			}
+			if _, files := sanitizeDiff(tc.req.FullDiff); !slices.Equal(files, tc.garbled) {
+				t.Errorf("sanitizeDiff files = %q, want %q", files, tc.garbled)
+			}
+			for _, f := range tc.garbled {
+				if !strings.Contains(prompt, "not UTF-8 encoded; their undecodable bytes are shown as \uFFFD: "+f+".") {
+					t.Errorf("prompt does not name %s as garbled:\n%s", f, prompt)
+				}
+			}
+
+			// encoding/json would replace the bytes itself; the body must
+			// marshal without relying on that, carrying the prompt unchanged.
+			body, err := json.Marshal(messageParams(tc.req))
+			if err != nil {
+				t.Fatalf("marshaling the request body: %v", err)
+			}
+			if !json.Valid(body) || !utf8.Valid(body) {
+				t.Fatalf("request body is not valid JSON in UTF-8:\n%s", body)
+			}
+			var sent struct {
+				Messages []struct {
+					Content []struct{ Text string }
+				}
+			}
+			if err := json.Unmarshal(body, &sent); err != nil {
+				t.Fatal(err)
+			}
+			if len(sent.Messages) != 1 || len(sent.Messages[0].Content) != 1 || sent.Messages[0].Content[0].Text != prompt {
+				t.Errorf("request body does not carry the prompt unchanged:\n%s", body)
+			}
+		})
+	}
+}
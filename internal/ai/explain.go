@@ -0,0 +1,26 @@
+package ai
+
+import (
+	"regexp"
+	"strings"
+)
+
+// explainInstruction asks for a rationale under every bullet, in a form that
+// StripRationales can remove again.
+const explainInstruction = "Below every bullet, add one line indented by two spaces of the form `<!-- why: ... -->` that briefly explains which commits the bullet comes from and why it belongs in its section, or why related commits were left out. Keep each rationale on that single line.\n\n"
+
+// rationaleRe matches a rationale line requested by Request.Explain.
+var rationaleRe = regexp.MustCompile(`^\s*<!--\s*why:.*-->\s*$`)
+
+// StripRationales removes the rationale lines that Request.Explain asks for,
+// leaving the changelog itself.
+func StripRationales(text string) string {
+	lines := strings.SplitAfter(text, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if !rationaleRe.MatchString(strings.TrimRight(line, "\r\n")) {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "")
+}
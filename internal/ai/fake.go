@@ -0,0 +1,138 @@
+package ai
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/nealwashere/ai-changelog-generator/internal/git"
+)
+
+// Provider answers generation requests in place of the Anthropic API. Like
+// Generator.Generate, Generate writes the response to req.Out and returns it.
+type Provider interface {
+	Generate(req Request) (Result, error)
+}
+
+// Provider names accepted by ParseProvider.
+const (
+	ProviderAnthropic = "anthropic"
+	ProviderFake      = "fake"
+)
+
+// ParseProvider validates a --provider value. The Anthropic API is the
+// Generator's default and is returned as a nil Provider.
+func ParseProvider(s string) (Provider, error) {
+	switch s {
+	case "", ProviderAnthropic:
+		return nil, nil
+	case ProviderFake:
+		return Fake{}, nil
+	}
+	return nil, fmt.Errorf("unknown provider %q (want %s or %s)", s, ProviderAnthropic, ProviderFake)
+}
+
+// FakeModel is the model name Fake reports in its results.
+const FakeModel = "fake"
+
+// Fake writes a changelog derived from the request alone, without a model, so
+// that complete runs, releases included, can be tested without network access
+// or an API key. The same request always yields the same text: each commit
+// becomes a bullet with its subject and SHA, under Added for feat commits,
+// Fixed for fix commits, and Changed for everything else.
+type Fake struct{}
+
+// Generate writes the fake changelog for req to req.Out, and passes it to
+// req.OnDelta in one piece.
+func (Fake) Generate(req Request) (Result, error) {
+	return respond(req, FakeModel, fakeText(req))
+}
+
+// respond writes text, the whole response of a Provider without a model, to
+// req.Out and req.OnDelta, and returns it as the Result of model. Token
+// counts are estimates.
+func respond(req Request, model, text string) (Result, error) {
+	res := Result{
+		Text:         text,
+		Model:        model,
+		StopReason:   "end_turn",
+		InputTokens:  EstimateTokens(req),
+		OutputTokens: (len(text) + 2) / 3,
+	}
+	if _, err := io.WriteString(req.Out, text); err != nil {
+		res.Text = ""
+		return res, err
+	}
+	onDelta(req, text)
+	return res, nil
+}
+
+// fakeText builds the response Fake gives for req.
+func fakeText(req Request) string {
+	switch {
+	case req.Repair != nil:
+		// Fake output is already well-formed; nothing to repair.
+		return strings.TrimRight(req.Repair.Previous, "\n") + "\n"
+	case req.Prompt != "":
+		return fmt.Sprintf("- Replayed a saved prompt of %d bytes.\n", len(req.Prompt))
+	}
+
+	var commits []git.Commit
+	commits = append(commits, req.Commits...)
+	for _, c := range req.Repos {
+		commits = append(commits, c.Commits...)
+	}
+	if req.Headline {
+		return fmt.Sprintf("%d change(s) from %s to %s.\n", len(commits), req.From, req.To)
+	}
+
+	sections := map[string][]string{}
+	for _, c := range commits {
+		section, subject := "Changed", c.Subject
+		if cc, ok := ParseConventional(c.Subject); ok {
+			switch cc.Type {
+			case "feat":
+				section = "Added"
+			case "fix":
+				section = "Fixed"
+			}
+			subject = cc.Description
+		}
+		sections[section] = append(sections[section], fmt.Sprintf("%s (%s)", subject, c.SHA))
+	}
+
+	var sb strings.Builder
+	if req.VersionHeader != "" {
+		sb.WriteString(req.VersionHeader + "\n\n")
+	}
+	if req.Style == StyleNews {
+		for _, name := range []string{"Added", "Changed", "Fixed"} {
+			for _, b := range sections[name] {
+				fmt.Fprintf(&sb, "* %s\n", b)
+			}
+		}
+		return sb.String()
+	}
+	first := true
+	for _, name := range []string{"Added", "Changed", "Fixed"} {
+		if len(sections[name]) == 0 {
+			continue
+		}
+		if !first {
+			sb.WriteString("\n")
+		}
+		first = false
+		fmt.Fprintf(&sb, "### %s\n\n", name)
+		for _, b := range sections[name] {
+			fmt.Fprintf(&sb, "- %s\n", b)
+		}
+	}
+	for _, f := range req.Fragments {
+		if !first {
+			sb.WriteString("\n")
+		}
+		first = false
+		sb.WriteString(strings.TrimRight(f.Content, "\n") + "\n")
+	}
+	return sb.String()
+}
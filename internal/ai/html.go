@@ -0,0 +1,153 @@
+package ai
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// inlineRe matches the inline markdown RenderHTML converts: a code span, a
+// [text](url) link, **bold** text, or a bare http(s) URL, which must not end
+// in punctuation that more likely belongs to the sentence.
+var inlineRe = regexp.MustCompile("`([^`]+)`" + `|\[([^\]]+)\]\(([^()\s]+)\)|\*\*([^*]+)\*\*|(https?://[^\s<>()]*[^\s<>().,;:!?'"])`)
+
+// RenderHTML converts a generated Keep a Changelog entry to an HTML fragment
+// for embedding in a page: headings become <h1> to <h6>, bullets <ul> lists,
+// with indented "- " lines as nested lists, fenced code blocks <pre>
+// elements, and other text paragraphs, all in their order in the text.
+// Inline code, links, bold text, and bare URLs are converted; everything
+// else is escaped, HTML tags included, so that neither the model nor a commit
+// message can inject markup into the page. Only lines that are a single HTML
+// comment, such as the --provenance footer, are kept as they are.
+func RenderHTML(text string) string {
+	var sb strings.Builder
+	for _, b := range parseBlocks(text) {
+		switch b.kind {
+		case headingBlock:
+			fmt.Fprintf(&sb, "<h%d>%s</h%d>\n", b.level, renderInline(b.text), b.level)
+		case listBlock:
+			sb.WriteString("<ul>\n")
+			for _, item := range b.items {
+				writeHTMLItem(&sb, item)
+			}
+			sb.WriteString("</ul>\n")
+		case commentBlock:
+			sb.WriteString(b.text + "\n")
+		case codeBlock:
+			writeHTMLCode(&sb, strings.Split(b.text, "\n"))
+		default:
+			sb.WriteString("<p>" + renderInline(b.text) + "</p>\n")
+		}
+	}
+	return sb.String()
+}
+
+// writeHTMLItem renders one bullet, with the nested list of its indented
+// "- " lines and any code block inside it.
+func writeHTMLItem(sb *strings.Builder, item string) {
+	lines := strings.Split(item, "\n")
+	sb.WriteString("<li>" + renderInline(lines[0]))
+	var nested []string
+	flush := func() {
+		if len(nested) > 0 {
+			sb.WriteString("\n<ul>\n" + strings.Join(nested, "\n") + "\n</ul>\n")
+			nested = nil
+		}
+	}
+	for i := 1; i < len(lines); i++ {
+		l := strings.TrimSpace(lines[i])
+		switch {
+		case fenceStart(l) != "":
+			end := i + 1
+			for end < len(lines) && !closesFence(strings.TrimSpace(lines[end]), fenceStart(l)) {
+				end++
+			}
+			end = min(end, len(lines)-1)
+			flush()
+			sb.WriteString("\n")
+			writeHTMLCode(sb, lines[i:end+1])
+			i = end
+		case isBullet(l):
+			nested = append(nested, "<li>"+renderInline(strings.TrimSpace(l[2:]))+"</li>")
+		case len(nested) > 0:
+			last := nested[len(nested)-1]
+			nested[len(nested)-1] = strings.TrimSuffix(last, "</li>") + " " + renderInline(l) + "</li>"
+		default:
+			sb.WriteString(" " + renderInline(l))
+		}
+	}
+	flush()
+	sb.WriteString("</li>\n")
+}
+
+// writeHTMLCode renders the lines of a fenced code block, fences included,
+// as an escaped <pre> element. An unclosed block runs to the end.
+func writeHTMLCode(sb *strings.Builder, lines []string) {
+	fence := fenceStart(strings.TrimSpace(lines[0]))
+	body := lines[1:]
+	if n := len(body); n > 0 && closesFence(strings.TrimSpace(body[n-1]), fence) {
+		body = body[:n-1]
+	}
+	// The block's own indentation, inside a bullet, is not part of the code.
+	indent := lines[0][:len(lines[0])-len(strings.TrimLeft(lines[0], " \t"))]
+	for i, l := range body {
+		body[i] = strings.TrimPrefix(l, indent)
+	}
+	sb.WriteString("<pre><code>" + html.EscapeString(strings.Join(body, "\n")) + "</code></pre>\n")
+}
+
+// isHTMLComment reports whether line is exactly one "<!-- … -->" comment.
+// A "--" inside could end the comment early in a browser and let what
+// follows through as markup.
+func isHTMLComment(line string) bool {
+	inner, ok := strings.CutPrefix(line, "<!--")
+	if !ok {
+		return false
+	}
+	inner, ok = strings.CutSuffix(inner, "-->")
+	return ok && !strings.Contains(inner, "--")
+}
+
+// renderInline converts the inline markdown of s to HTML and escapes the rest.
+func renderInline(s string) string {
+	var sb strings.Builder
+	last := 0
+	for _, m := range inlineRe.FindAllStringSubmatchIndex(s, -1) {
+		sb.WriteString(html.EscapeString(s[last:m[0]]))
+		last = m[1]
+		switch {
+		case m[2] != -1: // code span
+			sb.WriteString("<code>" + html.EscapeString(s[m[2]:m[3]]) + "</code>")
+		case m[4] != -1: // link
+			label := renderInline(s[m[4]:m[5]])
+			if href := s[m[6]:m[7]]; safeURL(href) {
+				sb.WriteString(`<a href="` + html.EscapeString(href) + `">` + label + "</a>")
+			} else {
+				sb.WriteString(label)
+			}
+		case m[8] != -1: // bold
+			sb.WriteString("<strong>" + renderInline(s[m[8]:m[9]]) + "</strong>")
+		default: // bare URL
+			u := html.EscapeString(s[m[10]:m[11]])
+			sb.WriteString(`<a href="` + u + `">` + u + "</a>")
+		}
+	}
+	sb.WriteString(html.EscapeString(s[last:]))
+	return sb.String()
+}
+
+// safeURL reports whether href may be used as a link target: relative, or
+// http, https, or mailto. Other schemes, such as javascript:, are dropped.
+func safeURL(href string) bool {
+	u, err := url.Parse(href)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "", "http", "https", "mailto":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+package ai
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderHTML(t *testing.T) {
+	for _, tc := range []struct {
+		name, text string
+		want       []string // substrings of the output
+		notWant    []string
+	}{
+		{
+			name: "headings and bullets",
+			text: "## [1.2.0] - 2026-01-02\n\n### Added\n\n- A paging cursor\n",
+			want: []string{"<h2>[1.2.0] - 2026-01-02</h2>\n", "<h3>Added</h3>\n<ul>\n<li>A paging cursor</li>\n</ul>\n"},
+		},
+		{
+			name:    "script tag in a line",
+			text:    "## [1.2.0]\n\n<script>alert(1)</script>\n\n### Fixed\n\n- <script>alert(2)</script>\n",
+			want:    []string{"<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>", "<li>&lt;script&gt;alert(2)&lt;/script&gt;</li>"},
+			notWant: []string{"<script>"},
+		},
+		{
+			name:    "event handler attribute",
+			text:    "## [1.2.0]\n\n<img src=x onerror=alert(1)>\n",
+			want:    []string{"<p>&lt;img src=x onerror=alert(1)&gt;</p>"},
+			notWant: []string{"<img"},
+		},
+		{
+			name: "comment kept",
+			text: "## [1.2.0]\n\n### Fixed\n\n- A fix\n\n<!-- changelog-provenance: {\"tool\":\"x\"} -->\n",
+			want: []string{"<!-- changelog-provenance: {\"tool\":\"x\"} -->\n"},
+		},
+		{
+			name:    "comment ending early",
+			text:    "## [1.2.0]\n\n<!-- a --><script>alert(1)</script><!-- b -->\n",
+			notWant: []string{"<script>", "<!-- a -->"},
+		},
+		{
+			name: "inline code is escaped",
+			text: "### Changed\n\n- Rename `Map<K, V>` to `Dict & co`\n",
+			want: []string{"<li>Rename <code>Map&lt;K, V&gt;</code> to <code>Dict &amp; co</code></li>"},
+		},
+		{
+			name: "links",
+			text: "### Fixed\n\n- See [the docs](https://example.com/a?b=1&c=2) and https://example.com/x.\n",
+			want: []string{
+				`<a href="https://example.com/a?b=1&amp;c=2">the docs</a>`,
+				`<a href="https://example.com/x">https://example.com/x</a>.`,
+			},
+		},
+		{
+			name:    "javascript link dropped",
+			text:    "### Fixed\n\n- Click [here](javascript:alert(1))\n",
+			notWant: []string{"href", "javascript:alert(1)\">"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := RenderHTML(tc.text)
+			for _, w := range tc.want {
+				if !strings.Contains(got, w) {
+					t.Errorf("output lacks %q:\n%s", w, got)
+				}
+			}
+			for _, w := range tc.notWant {
+				if strings.Contains(got, w) {
+					t.Errorf("output contains %q:\n%s", w, got)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderHTMLKeepsOrder(t *testing.T) {
+	for _, tc := range []struct {
+		name, text, want string
+	}{
+		{
+			name: "footer line",
+			text: "## [1.2.0] - 2026-01-02\n\n### Fixed\n\n- A fix\n\n**Full Changelog**: https://github.com/acme/widget/compare/1.1.0...1.2.0\n\n<!-- changelog-provenance: {} -->\n",
+			want: "<h2>[1.2.0] - 2026-01-02</h2>\n<h3>Fixed</h3>\n<ul>\n<li>A fix</li>\n</ul>\n" +
+				"<p><strong>Full Changelog</strong>: <a href=\"https://github.com/acme/widget/compare/1.1.0...1.2.0\">https://github.com/acme/widget/compare/1.1.0...1.2.0</a></p>\n" +
+				"<!-- changelog-provenance: {} -->\n",
+		},
+		{
+			name: "two entries",
+			text: "## [1.2.0] - 2026-01-02\n\n### Added\n\n- Paging\n\n## [1.1.0] - 2025-12-01\n\n### Fixed\n\n- A fix\n",
+			want: "<h2>[1.2.0] - 2026-01-02</h2>\n<h3>Added</h3>\n<ul>\n<li>Paging</li>\n</ul>\n" +
+				"<h2>[1.1.0] - 2025-12-01</h2>\n<h3>Fixed</h3>\n<ul>\n<li>A fix</li>\n</ul>\n",
+		},
+		{
+			name: "indented line after the list",
+			text: "### Fixed\n\n- A fix\n  continued\n\n  Indented note\n",
+			want: "<h3>Fixed</h3>\n<ul>\n<li>A fix continued</li>\n</ul>\n<p>Indented note</p>\n",
+		},
+		{
+			name: "code block",
+			text: "### Changed\n\n```yaml\n### not a heading\n\nkey: <v>\n```\n",
+			want: "<h3>Changed</h3>\n<pre><code>### not a heading\n\nkey: &lt;v&gt;</code></pre>\n",
+		},
+		{
+			name: "code block in a bullet",
+			text: "### Changed\n\n- Rename the key:\n\n  ```yaml\n  ### not a heading\n\n  key: v\n  ```\n- Next\n",
+			want: "<h3>Changed</h3>\n<ul>\n<li>Rename the key:\n<pre><code>### not a heading\n\nkey: v</code></pre>\n</li>\n<li>Next</li>\n</ul>\n",
+		},
+		{
+			name: "code block directly in a bullet",
+			text: "### Changed\n\n- Rename the key:\n  ```yaml\n  ### not a heading\n\n  key: v\n  ```\n- Next\n",
+			want: "<h3>Changed</h3>\n<ul>\n<li>Rename the key:\n<pre><code>### not a heading\n\nkey: v</code></pre>\n</li>\n<li>Next</li>\n</ul>\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := RenderHTML(tc.text); got != tc.want {
+				t.Errorf("RenderHTML =\n%s\nwant:\n%s", got, tc.want)
+			}
+		})
+	}
+}
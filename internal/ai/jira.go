@@ -0,0 +1,87 @@
+package ai
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// jiraKeyRe matches an issue key such as "PROJ-123", capturing the
+	// character before it, the project key, and the number. A key directly
+	// after a word character, slash, dot, or dash is part of something else.
+	jiraKeyRe = regexp.MustCompile(`(^|[^\w/.\-])([A-Z][A-Z0-9_]+)-([1-9]\d*)\b`)
+	// jiraSkipRe matches the inline markdown that LinkJira leaves alone:
+	// code spans, links, autolinks, and bare URLs.
+	jiraSkipRe = regexp.MustCompile("`[^`]*`|!?\\[[^\\]]*\\]\\([^)]*\\)|<[^>\\s]+>|https?://\\S+")
+)
+
+var jiraProjectRe = regexp.MustCompile(`^[A-Z][A-Z0-9_]+$`)
+
+// ValidateJiraKey checks that key has the form of a Jira project key: an
+// uppercase letter followed by uppercase letters, digits, or underscores.
+func ValidateJiraKey(key string) error {
+	if !jiraProjectRe.MatchString(key) {
+		return fmt.Errorf("%q is not a Jira project key (uppercase letters, digits, and underscores, starting with a letter)", key)
+	}
+	return nil
+}
+
+// NotJiraKeys lists prefixes that look like Jira project keys in ordinary
+// text, such as "UTF-8" or "SHA-256". LinkJira skips them unless they are
+// listed explicitly.
+var NotJiraKeys = map[string]bool{
+	"CVE": true, "CWE": true, "GHSA": true, "ISO": true, "RFC": true, "PEP": true,
+	"SHA": true, "MD": true, "UTF": true, "UCS": true, "ECMA": true, "ES": true,
+	"TLS": true, "SSL": true, "HTTP": true,
+}
+
+// LinkJira rewrites the Jira issue keys in text, such as "PROJ-123", into
+// markdown links to base + "/browse/PROJ-123". With keys, only those project
+// keys are linked; without, any key is, except those in NotJiraKeys. Keys
+// inside code, existing links, and URLs are left as they are, so running it
+// twice changes nothing more.
+func LinkJira(text, base string, keys []string) string {
+	base = strings.TrimRight(base, "/")
+	allowed := map[string]bool{}
+	for _, k := range keys {
+		allowed[k] = true
+	}
+	link := func(s string) string {
+		return jiraKeyRe.ReplaceAllStringFunc(s, func(m string) string {
+			sub := jiraKeyRe.FindStringSubmatch(m)
+			project := sub[2]
+			if len(allowed) > 0 && !allowed[project] || len(allowed) == 0 && NotJiraKeys[project] {
+				return m
+			}
+			key := project + "-" + sub[3]
+			return sub[1] + "[" + key + "](" + base + "/browse/" + key + ")"
+		})
+	}
+
+	lines := strings.Split(text, "\n")
+	fence := ""
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			continue
+		}
+		var sb strings.Builder
+		last := 0
+		for _, loc := range jiraSkipRe.FindAllStringIndex(line, -1) {
+			sb.WriteString(link(line[last:loc[0]]))
+			sb.WriteString(line[loc[0]:loc[1]])
+			last = loc[1]
+		}
+		sb.WriteString(link(line[last:]))
+		lines[i] = sb.String()
+	}
+	return strings.Join(lines, "\n")
+}
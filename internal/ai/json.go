@@ -0,0 +1,102 @@
+package ai
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// versionHeaderRe matches a Keep a Changelog version header, capturing the
+// version and the optional date: "## [1.2.0] - 2026-02-22".
+var versionHeaderRe = regexp.MustCompile(`^## \[([^\]]+)\](?: - (\S+))?`)
+
+// jsonEntry is the document RenderJSON writes.
+type jsonEntry struct {
+	Version  string        `json:"version,omitempty"` // e.g. "1.2.0" or "Unreleased"
+	Date     string        `json:"date,omitempty"`    // YYYY-MM-DD
+	Notes    []string      `json:"notes,omitempty"`   // other text before and between the sections
+	Sections []jsonSection `json:"sections"`
+}
+
+type jsonSection struct {
+	Title string   `json:"title"`
+	Items []string `json:"items"`
+}
+
+// RenderJSON converts a generated Keep a Changelog entry to a JSON document
+// for tools that consume release notes as data: the version and date from
+// its header, and each section's title and bullets in order, with their
+// inline markdown kept. Any other text, such as a footer line after the last
+// list, is listed under "notes". A text holding several entries, each under
+// its own "## " heading, becomes an array of such documents. The bullets are
+// read the same way as by RenderHTML, so all formats of one entry agree.
+func RenderJSON(text string) string {
+	entries := jsonEntries(text)
+	var v any = entries
+	switch len(entries) {
+	case 0:
+		v = jsonEntry{Sections: []jsonSection{}}
+	case 1:
+		v = entries[0]
+	}
+	return marshalJSON(v)
+}
+
+// RenderJSONList is RenderJSON for output that is a list of entries, such as
+// that of --split-by-tags: it is always an array, of as many documents as
+// text has entries, so that its shape does not depend on their number.
+func RenderJSONList(text string) string {
+	entries := jsonEntries(text)
+	if entries == nil {
+		entries = []jsonEntry{}
+	}
+	return marshalJSON(entries)
+}
+
+// jsonEntries reads the entries of text for RenderJSON, one per "## "
+// heading.
+func jsonEntries(text string) []jsonEntry {
+	var entries []jsonEntry
+	headed := false // the current entry has its "## " heading
+	var sec *jsonSection
+	for _, b := range parseBlocks(text) {
+		if len(entries) == 0 || b.kind == headingBlock && b.level == 2 && (headed || len(entries[len(entries)-1].Sections) > 0) {
+			entries = append(entries, jsonEntry{Sections: []jsonSection{}})
+			headed, sec = false, nil
+		}
+		e := &entries[len(entries)-1]
+		switch {
+		case b.kind == headingBlock && b.level == 2:
+			headed = true
+			if m := versionHeaderRe.FindStringSubmatch("## " + b.text); m != nil {
+				e.Version, e.Date = m[1], m[2]
+			} else {
+				e.Notes = append(e.Notes, b.text)
+			}
+		case b.kind == headingBlock && b.level == 3:
+			e.Sections = append(e.Sections, jsonSection{Title: b.text, Items: []string{}})
+			sec = &e.Sections[len(e.Sections)-1]
+		case b.kind == listBlock && sec != nil:
+			sec.Items = append(sec.Items, b.items...)
+		case b.kind == listBlock:
+			e.Notes = append(e.Notes, b.items...)
+		default:
+			// Text after a section's list is not part of the section.
+			if sec != nil && len(sec.Items) > 0 {
+				sec = nil
+			}
+			note := b.text
+			if b.kind == headingBlock {
+				note = strings.Repeat("#", b.level) + " " + note
+			}
+			e.Notes = append(e.Notes, note)
+		}
+	}
+	return entries
+}
+
+// marshalJSON formats v as an indented JSON document ending in a newline.
+func marshalJSON(v any) string {
+	data, _ := json.MarshalIndent(v, "", "  ") // cannot fail for strings
+	return string(data) + "\n"
+}
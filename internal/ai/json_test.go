@@ -0,0 +1,79 @@
+package ai
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestRenderJSON(t *testing.T) {
+	for _, tc := range []struct {
+		name, text string
+		want       any
+	}{
+		{
+			name: "footer line",
+			text: "## [1.2.0] - 2026-01-02\n\n### Fixed\n\n- A fix\n  continued\n\n  Indented note\n\n**Full Changelog**: https://example.com/compare\n",
+			want: map[string]any{
+				"version": "1.2.0", "date": "2026-01-02",
+				"notes":    []any{"Indented note", "**Full Changelog**: https://example.com/compare"},
+				"sections": []any{map[string]any{"title": "Fixed", "items": []any{"A fix\ncontinued"}}},
+			},
+		},
+		{
+			name: "two entries",
+			text: "## [1.2.0] - 2026-01-02\n\n### Added\n\n- Paging\n\n## [1.1.0] - 2025-12-01\n\n### Fixed\n\n- A fix\n",
+			want: []any{
+				map[string]any{"version": "1.2.0", "date": "2026-01-02", "sections": []any{map[string]any{"title": "Added", "items": []any{"Paging"}}}},
+				map[string]any{"version": "1.1.0", "date": "2025-12-01", "sections": []any{map[string]any{"title": "Fixed", "items": []any{"A fix"}}}},
+			},
+		},
+		{
+			name: "intro before the list",
+			text: "## [Unreleased]\n\n### Added\n\nSome intro\n\n- Paging\n",
+			want: map[string]any{
+				"version":  "Unreleased",
+				"notes":    []any{"Some intro"},
+				"sections": []any{map[string]any{"title": "Added", "items": []any{"Paging"}}},
+			},
+		},
+		{
+			name: "empty",
+			text: "",
+			want: map[string]any{"sections": []any{}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			out := RenderJSON(tc.text)
+			var got any
+			if err := json.Unmarshal([]byte(out), &got); err != nil {
+				t.Fatalf("invalid JSON: %v\n%s", err, out)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("RenderJSON =\n%s\nwant %v", out, tc.want)
+			}
+		})
+	}
+}
+
+func TestRenderJSONList(t *testing.T) {
+	for _, tc := range []struct {
+		name, text string
+		want       int // entries in the array
+	}{
+		{"one entry", "## [1.2.0] - 2026-01-02\n\n### Added\n\n- Paging\n", 1},
+		{"two entries", "## [1.2.0] - 2026-01-02\n\n### Added\n\n- Paging\n\n## [1.1.0] - 2025-12-01\n\n### Fixed\n\n- A fix\n", 2},
+		{"empty", "", 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			out := RenderJSONList(tc.text)
+			var got []map[string]any
+			if err := json.Unmarshal([]byte(out), &got); err != nil {
+				t.Fatalf("not a JSON array: %v\n%s", err, out)
+			}
+			if len(got) != tc.want {
+				t.Errorf("RenderJSONList has %d entries, want %d:\n%s", len(got), tc.want, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package ai
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// TruncatedNote is the line TrimToLength ends a shortened entry with.
+const TruncatedNote = "(truncated)"
+
+// lengthPriority lists the sections TrimToLength keeps first, matched
+// anywhere in the title so that --theme icons do not hide them; the others
+// follow in their generated order.
+var lengthPriority = []string{"Breaking", "Added", "Fixed"}
+
+// TrimToLength shortens the entry text so that it has at most max characters,
+// counted as Unicode code points the way length-capped stores count them. It
+// fills the budget section by section, breaking changes, Added, and Fixed
+// first, keeping the bullets of each section in order. The bullet that
+// overflows is cut at a word boundary and ends with "…"; everything after it
+// is omitted and TruncatedNote added at the end. The sections that remain
+// keep their generated order. The preamble, with the version header, and the
+// Upgrade Notes section, whose instructions must reach the reader word for
+// word, are always kept whole and count against the budget first, so the
+// result is longer than max when they alone do not fit. Text that already
+// fits is returned unchanged, with truncated false.
+func TrimToLength(text string, max int) (trimmed string, truncated bool) {
+	if utf8.RuneCountInString(text) <= max {
+		return text, false
+	}
+	c := ParseChangelog(text)
+
+	order := make([]int, 0, len(c.Sections))
+	taken := make([]bool, len(c.Sections))
+	kept := make([]Section, len(c.Sections))
+	for i, s := range c.Sections {
+		if strings.Contains(strings.ToLower(s.Title), strings.ToLower(UpgradeNotesTitle)) {
+			kept[i], taken[i] = s, true
+		}
+	}
+	for _, prefix := range lengthPriority {
+		for i, s := range c.Sections {
+			if !taken[i] && strings.Contains(strings.ToLower(s.Title), strings.ToLower(prefix)) {
+				order, taken[i] = append(order, i), true
+			}
+		}
+	}
+	for i := range c.Sections {
+		if !taken[i] {
+			order = append(order, i)
+		}
+	}
+
+	render := func() string {
+		out := Changelog{Preamble: c.Preamble}
+		for _, s := range kept {
+			if len(s.Bullets) > 0 {
+				out.Sections = append(out.Sections, s)
+			}
+		}
+		return strings.TrimRight(out.String(), "\n") + "\n\n" + TruncatedNote + "\n"
+	}
+	fits := func() bool { return utf8.RuneCountInString(render()) <= max }
+trim:
+	for _, i := range order {
+		kept[i].Title = c.Sections[i].Title
+		for _, b := range c.Sections[i].Bullets {
+			kept[i].Bullets = append(kept[i].Bullets, b)
+			if fits() {
+				continue
+			}
+			// Cut the overflowing bullet word by word; drop it if not even
+			// its first word fits.
+			words := strings.Fields(b)
+			last := len(kept[i].Bullets) - 1
+			for n := len(words) - 1; n > 0; n-- {
+				kept[i].Bullets[last] = strings.Join(words[:n], " ") + "…"
+				if fits() {
+					break trim
+				}
+			}
+			kept[i].Bullets = kept[i].Bullets[:last]
+			break trim
+		}
+	}
+
+	return render(), true
+}
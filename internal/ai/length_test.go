@@ -0,0 +1,38 @@
+package ai
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTrimToLengthKeepsUpgradeNotes(t *testing.T) {
+	notes := "Run `tool migrate` once, then rename `timeout` to `request_timeout` in config.yaml."
+	text := "## [2.0.0] - 2026-01-02\n\n### Upgrade Notes\n\n- " + notes +
+		"\n\n### Added\n\n- A new paging cursor for the list endpoints.\n- Retries with backoff.\n\n### Fixed\n\n- An empty response body no longer crashes the client.\n"
+	got, truncated := TrimToLength(text, 200)
+	if !truncated {
+		t.Fatalf("not truncated:\n%s", got)
+	}
+	if !strings.Contains(got, "- "+notes+"\n") {
+		t.Errorf("upgrade note was cut:\n%s", got)
+	}
+	if n := utf8.RuneCountInString(got); n > 200 {
+		t.Errorf("got %d characters, want at most 200:\n%s", n, got)
+	}
+	if !strings.HasSuffix(got, "\n"+TruncatedNote+"\n") {
+		t.Errorf("missing %q at the end:\n%s", TruncatedNote, got)
+	}
+}
+
+func TestTrimToLengthOverrunByKeptParts(t *testing.T) {
+	text := "## [2.0.0] - 2026-01-02\n\n### Upgrade Notes\n\n- Rename `timeout` to `request_timeout` in config.yaml.\n\n### Added\n\n- Paging cursor.\n"
+	got, truncated := TrimToLength(text, 40)
+	if !truncated {
+		t.Fatalf("not truncated:\n%s", got)
+	}
+	want := "## [2.0.0] - 2026-01-02\n\n### Upgrade Notes\n\n- Rename `timeout` to `request_timeout` in config.yaml.\n\n" + TruncatedNote + "\n"
+	if got != want {
+		t.Errorf("TrimToLength =\n%s\nwant:\n%s", got, want)
+	}
+}
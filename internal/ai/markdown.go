@@ -0,0 +1,414 @@
+package ai
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Changelog is a generated entry split into its ### sections.
+type Changelog struct {
+	Preamble []string // lines before the first section, e.g. the version header
+	Sections []Section
+}
+
+// Section is one ### heading and the content beneath it.
+type Section struct {
+	Title   string   // heading text without the "### " prefix
+	Bullets []string // bullet text without the marker; continuation lines joined with "\n"
+	Prose   []string // non-bullet lines, which well-formed output does not have
+}
+
+// ParseChangelog splits a generated entry into sections and bullets. Blank
+// lines are dropped; indented lines following a bullet are kept as part of it.
+// Fenced code blocks are kept whole, blank lines and indentation included,
+// with the bullet, section prose, or preamble they start in; nothing inside
+// them is taken for a heading or a bullet.
+func ParseChangelog(text string) Changelog {
+	var c Changelog
+	var cur *Section
+	fence := ""                   // the fence of the open code block, if any
+	var addCode func(line string) // adds a line of the open code block
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		line = strings.TrimRight(line, " \t")
+		trimmed := strings.TrimSpace(line)
+		if fence != "" {
+			addCode(line)
+			if closesFence(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if fence = fenceStart(trimmed); fence != "" {
+			switch s, indent := cur, line[:len(line)-len(trimmed)]; {
+			case s == nil:
+				addCode = func(line string) { c.Preamble = append(c.Preamble, line) }
+			case len(s.Bullets) > 0:
+				// Kept after the bullet above it, even unindented, as Prose
+				// would move it before the bullets; String indents it.
+				addCode = func(line string) {
+					s.Bullets[len(s.Bullets)-1] += "\n" + strings.TrimPrefix(line, indent)
+				}
+			default:
+				addCode = func(line string) { s.Prose = append(s.Prose, line) }
+			}
+			addCode(line)
+			continue
+		}
+		switch {
+		case strings.HasPrefix(trimmed, "### "):
+			c.Sections = append(c.Sections, Section{Title: strings.TrimSpace(trimmed[4:])})
+			cur = &c.Sections[len(c.Sections)-1]
+		case trimmed == "":
+			continue
+		case cur == nil:
+			c.Preamble = append(c.Preamble, line)
+		case isBullet(line):
+			cur.Bullets = append(cur.Bullets, strings.TrimSpace(trimmed[2:]))
+		case len(cur.Bullets) > 0 && (line[0] == ' ' || line[0] == '\t'):
+			cur.Bullets[len(cur.Bullets)-1] += "\n" + trimmed
+		default:
+			cur.Prose = append(cur.Prose, trimmed)
+		}
+	}
+	return c
+}
+
+// isBullet reports whether line starts a top-level "- " or "* " list item.
+func isBullet(line string) bool {
+	return strings.HasPrefix(line, "- ") || strings.HasPrefix(line, "* ")
+}
+
+// Section returns the section with the given title, or nil.
+func (c *Changelog) Section(title string) *Section {
+	for i := range c.Sections {
+		if strings.EqualFold(c.Sections[i].Title, title) {
+			return &c.Sections[i]
+		}
+	}
+	return nil
+}
+
+// String renders c as markdown with one blank line between blocks and "- "
+// bullet markers.
+func (c Changelog) String() string {
+	var blocks []string
+	if len(c.Preamble) > 0 {
+		blocks = append(blocks, strings.Join(c.Preamble, "\n"))
+	}
+	for _, s := range c.Sections {
+		blocks = append(blocks, "### "+s.Title)
+		if len(s.Prose) > 0 {
+			blocks = append(blocks, strings.Join(s.Prose, "\n"))
+		}
+		if len(s.Bullets) > 0 {
+			lines := make([]string, len(s.Bullets))
+			for i, b := range s.Bullets {
+				lines[i] = "- " + indentBullet(b)
+			}
+			blocks = append(blocks, strings.Join(lines, "\n"))
+		}
+	}
+	return strings.Join(blocks, "\n\n") + "\n"
+}
+
+// indentBullet indents the continuation lines of bullet text b under its
+// marker, leaving the blank lines of its code blocks empty.
+func indentBullet(b string) string {
+	lines := strings.Split(b, "\n")
+	for i := 1; i < len(lines); i++ {
+		if lines[i] != "" {
+			lines[i] = "  " + lines[i]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// outputFenceRe matches the opening line of a fence that wraps a whole
+// response, capturing the fence: plain or marked as markdown.
+var outputFenceRe = regexp.MustCompile("^(```+|~~~+)\\s*(?i:markdown|md)?\\s*$")
+
+// StripOutputFence removes the code fence that models sometimes wrap their
+// whole answer in, "```markdown" or a plain "```" line at the top and the
+// matching fence at the bottom. Code blocks inside the entry are kept; text
+// that is not wrapped, or whose last fence closes one of its own code blocks,
+// is returned unchanged.
+func StripOutputFence(text string) string {
+	lines := strings.Split(strings.TrimSpace(strings.ReplaceAll(text, "\r\n", "\n")), "\n")
+	if len(lines) < 2 {
+		return text
+	}
+	m := outputFenceRe.FindStringSubmatch(strings.TrimSpace(lines[0]))
+	last := strings.TrimSpace(lines[len(lines)-1])
+	if m == nil || !strings.HasPrefix(last, m[1]) || strings.Trim(last, m[1][:1]) != "" {
+		return text
+	}
+	inner := lines[1 : len(lines)-1]
+	fence := ""
+	for _, line := range inner {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case fence != "":
+			if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+				fence = ""
+			}
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			fence = trimmed[:3]
+		}
+	}
+	if fence != "" {
+		return text // the last line closes a code block of the entry
+	}
+	return strings.TrimSpace(strings.Join(inner, "\n")) + "\n"
+}
+
+var (
+	bulletMarkerRe = regexp.MustCompile(`^(\s*)[-*+]\s+(\S)`)
+	atxHeadingRe   = regexp.MustCompile(`^(#{1,6})(\s*)([^#\s].*)$`)
+)
+
+// FixMarkdown normalizes the layout of generated markdown: "- " bullet
+// markers, a space after heading hashes, exactly one blank line around
+// headings and between blocks but none between the items of a list, no
+// trailing whitespace, and a single final newline. Fenced code blocks are
+// left exactly as they are. Applying it twice gives the same result as
+// applying it once.
+func FixMarkdown(text string) string {
+	var out []string
+	blank := false   // a blank line is pending before the next line
+	heading := false // the previous line was a heading
+	item := false    // the previous line was a list item or belongs to one
+	fence := ""
+	emit := func(line string) {
+		if blank && len(out) > 0 {
+			out = append(out, "")
+		}
+		out = append(out, line)
+		blank = false
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if fence != "" {
+			out = append(out, line)
+			if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+				fence = ""
+			}
+			continue
+		}
+
+		line = strings.TrimRight(line, " \t")
+		switch {
+		case trimmed == "":
+			blank = true
+			continue
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			fence = trimmed[:3]
+			blank = blank || heading
+			emit(line)
+			heading, item = false, false
+			continue
+		}
+
+		// "#123 ..." is an issue reference, not a heading missing its space.
+		if m := atxHeadingRe.FindStringSubmatch(line); m != nil && (m[2] != "" || len(m[1]) > 1) {
+			blank = true
+			emit(m[1] + " " + m[3])
+			blank, heading, item = true, true, false
+			continue
+		}
+		bullet := bulletMarkerRe.MatchString(line)
+		switch {
+		case heading:
+			blank = true
+		case item && bullet:
+			blank = false
+		}
+		if bullet {
+			line = bulletMarkerRe.ReplaceAllString(line, "$1- $2")
+		}
+		emit(line)
+		heading = false
+		item = bullet || (item && (line[0] == ' ' || line[0] == '\t'))
+	}
+	if len(out) == 0 {
+		return ""
+	}
+	return strings.Join(out, "\n") + "\n"
+}
+
+// BulletOrder selects how SortBullets orders bullets within a section.
+type BulletOrder string
+
+const (
+	OrderAlpha BulletOrder = "alpha" // case-insensitive alphabetical
+	OrderPR    BulletOrder = "pr"    // by lowest referenced #number; unreferenced bullets last
+)
+
+var prRefRe = regexp.MustCompile(`#(\d+)\b`)
+
+// SortBullets orders the bullets within each section of c, leaving the order
+// of the sections themselves unchanged. Ties keep their generated order.
+func SortBullets(c Changelog, order BulletOrder) Changelog {
+	for i := range c.Sections {
+		b := c.Sections[i].Bullets
+		sort.SliceStable(b, func(x, y int) bool {
+			if order == OrderPR {
+				px, py := lowestRef(b[x]), lowestRef(b[y])
+				if px != py {
+					return px < py
+				}
+			}
+			return strings.ToLower(b[x]) < strings.ToLower(b[y])
+		})
+	}
+	return c
+}
+
+// lowestRef returns the smallest #number in s, or a value larger than any
+// reference when there is none.
+func lowestRef(s string) int {
+	lowest := int(^uint(0) >> 1)
+	for _, m := range prRefRe.FindAllStringSubmatch(s, -1) {
+		if n, err := strconv.Atoi(m[1]); err == nil && n < lowest {
+			lowest = n
+		}
+	}
+	return lowest
+}
+
+// DedupeBullets removes each bullet of c that repeats an earlier one in any
+// section, comparing the text with case, punctuation, and spacing ignored, and
+// returns the removed bullets. Sections left without content are dropped.
+func DedupeBullets(c Changelog) (Changelog, []string) {
+	seen := map[string]bool{}
+	var removed []string
+	var sections []Section
+	for _, s := range c.Sections {
+		var bullets []string
+		for _, b := range s.Bullets {
+			key := normalizeBullet(b)
+			if key != "" && seen[key] {
+				removed = append(removed, b)
+				continue
+			}
+			seen[key] = true
+			bullets = append(bullets, b)
+		}
+		s.Bullets = bullets
+		if len(s.Bullets) > 0 || len(s.Prose) > 0 {
+			sections = append(sections, s)
+		}
+	}
+	c.Sections = sections
+	return c, removed
+}
+
+// normalizeBullet reduces a bullet to its lower-cased words and numbers, so
+// that "Fix the parser." and "fix the parser" compare equal.
+func normalizeBullet(b string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(b), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// FilterSections keeps only the sections of c whose titles are in allow,
+// compared case-insensitively, and returns the others as dropped.
+func FilterSections(c Changelog, allow []string) (kept Changelog, dropped []Section) {
+	kept.Preamble = c.Preamble
+	for _, s := range c.Sections {
+		ok := false
+		for _, a := range allow {
+			if strings.EqualFold(s.Title, a) {
+				ok = true
+				break
+			}
+		}
+		if ok {
+			kept.Sections = append(kept.Sections, s)
+		} else {
+			dropped = append(dropped, s)
+		}
+	}
+	return kept, dropped
+}
+
+// EmptySectionText is the placeholder bullet EnsureSections puts in a
+// standard section that has no content. Other sections get "No changes.".
+var EmptySectionText = map[string]string{
+	"Added":      "Nothing added.",
+	"Changed":    "No changes.",
+	"Deprecated": "Nothing deprecated.",
+	"Removed":    "Nothing removed.",
+	"Fixed":      "No fixes.",
+	"Security":   "No security changes.",
+}
+
+// EnsureSections makes sure c has a section for each of titles, compared
+// case-insensitively, and returns the titles it had to add or fill. A missing
+// or empty section gets the single bullet placeholder, or when that is empty
+// the EmptySectionText of its title. New sections go where Keep a Changelog
+// order puts them, after the existing sections that come before them there;
+// titles outside that order go at the end.
+func EnsureSections(c Changelog, titles []string, placeholder string) (Changelog, []string) {
+	rank := func(title string) int {
+		for i, s := range keepAChangelogSections {
+			if strings.EqualFold(s, title) {
+				return i
+			}
+		}
+		return len(keepAChangelogSections)
+	}
+	var added []string
+	c.Sections = append([]Section(nil), c.Sections...)
+	for _, title := range titles {
+		text := placeholder
+		if text == "" {
+			text = "No changes."
+			for name, t := range EmptySectionText {
+				if strings.EqualFold(name, title) {
+					text = t
+				}
+			}
+		}
+		if s := c.Section(title); s != nil {
+			if len(s.Bullets) == 0 && len(s.Prose) == 0 {
+				s.Bullets = []string{text}
+				added = append(added, s.Title)
+			}
+			continue
+		}
+		at := len(c.Sections)
+		if r := rank(title); r < len(keepAChangelogSections) {
+			at = 0
+			for i, s := range c.Sections {
+				if rank(s.Title) <= r {
+					at = i + 1
+				}
+			}
+			title = keepAChangelogSections[r]
+		}
+		c.Sections = append(c.Sections[:at], append([]Section{{Title: title, Bullets: []string{text}}}, c.Sections[at:]...)...)
+		added = append(added, title)
+	}
+	return c, added
+}
+
+// UpgradeNotesTitle is the heading of the section AddUpgradeNotes writes.
+const UpgradeNotesTitle = "Upgrade Notes"
+
+// AddUpgradeNotes makes notes, one bullet each and unchanged, the first
+// section of c, where readers of a breaking release look before anything
+// else. A section of that title the model wrote anyway is replaced.
+func AddUpgradeNotes(c Changelog, notes []string) Changelog {
+	sections := []Section{{Title: UpgradeNotesTitle, Bullets: notes}}
+	for _, s := range c.Sections {
+		if !strings.EqualFold(s.Title, UpgradeNotesTitle) {
+			sections = append(sections, s)
+		}
+	}
+	c.Sections = sections
+	return c
+}
@@ -0,0 +1,125 @@
+package ai
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestStripOutputFence(t *testing.T) {
+	entry := "## [1.2.0] - 2026-01-02\n\n### Added\n\n- A `--dry-run` flag.\n"
+	withCode := "## [1.2.0] - 2026-01-02\n\n### Changed\n\n- Config keys are renamed:\n\n```yaml\nrequest_timeout: 30s\n```\n"
+	for _, tc := range []struct {
+		name, text, want string
+	}{
+		{"markdown fence", "```markdown\n" + entry + "```\n", entry},
+		{"md fence", "```md\n" + entry + "```", entry},
+		{"plain fence", "```\n" + entry + "```\n", entry},
+		{"tilde fence", "~~~\n" + entry + "~~~\n", entry},
+		{"longer fence", "````markdown\n" + entry + "````\n", entry},
+		{"blank lines around", "\n```markdown\n\n" + entry + "\n```\n\n", entry},
+		{"inner code block kept", "```markdown\n" + withCode + "```\n", withCode},
+		{"longer fence around a code block", "````markdown\n" + withCode + "````\n", withCode},
+		{"not wrapped", entry, entry},
+		{"not wrapped, code block kept", withCode, withCode},
+		{"other language is not a wrapper", "```go\nfunc main() {}\n```\n", "```go\nfunc main() {}\n```\n"},
+		{"last fence closes an inner block", "```\nx\n```\n" + entry + "```\n", "```\nx\n```\n" + entry + "```\n"},
+		{"closing fence too short", "````\n" + entry + "```\n", "````\n" + entry + "```\n"},
+		{"unclosed fence", "```markdown\n" + entry, "```markdown\n" + entry},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := StripOutputFence(tc.text); got != tc.want {
+				t.Errorf("StripOutputFence(%q) =\n%s\nwant:\n%s", tc.text, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDedupeBullets(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		bullets []string
+		want    []string
+	}{
+		{"trailing period", []string{"Fix the parser", "Fix the parser."}, []string{"Fix the parser"}},
+		{"trailing punctuation", []string{"Add `--dry-run`!", "Add --dry-run"}, []string{"Add `--dry-run`!"}},
+		{"case", []string{"Fix the Parser", "fix the parser"}, []string{"Fix the Parser"}},
+		{"whitespace", []string{"Fix  the\tparser ", "Fix the parser"}, []string{"Fix  the\tparser "}},
+		{"all at once", []string{"Handle empty input (#12).", "  handle EMPTY input (#12)"}, []string{"Handle empty input (#12)."}},
+		{"different bullets both kept", []string{"Fix the parser", "Fix the printer"}, []string{"Fix the parser", "Fix the printer"}},
+		{"different numbers both kept", []string{"Require Go 1.2", "Require Go 12"}, []string{"Require Go 1.2", "Require Go 12"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, removed := DedupeBullets(Changelog{Sections: []Section{{Title: "Fixed", Bullets: tc.bullets}}})
+			var bullets []string
+			if len(got.Sections) == 1 {
+				bullets = got.Sections[0].Bullets
+			}
+			if !slices.Equal(bullets, tc.want) {
+				t.Errorf("DedupeBullets kept %q, want %q", bullets, tc.want)
+			}
+			if len(removed) != len(tc.bullets)-len(tc.want) {
+				t.Errorf("DedupeBullets removed %q", removed)
+			}
+		})
+	}
+}
+
+func TestDedupeBulletsAcrossSections(t *testing.T) {
+	c := Changelog{Sections: []Section{
+		{Title: "Added", Bullets: []string{"Paging cursor for list endpoints"}},
+		{Title: "Changed", Bullets: []string{"paging cursor for list endpoints."}},
+		{Title: "Fixed", Bullets: []string{"Empty input no longer crashes"}},
+	}}
+	got, removed := DedupeBullets(c)
+	want := "### Added\n\n- Paging cursor for list endpoints\n\n### Fixed\n\n- Empty input no longer crashes\n"
+	if s := got.String(); s != want {
+		t.Errorf("DedupeBullets =\n%s\nwant:\n%s", s, want)
+	}
+	if !slices.Equal(removed, []string{"paging cursor for list endpoints."}) {
+		t.Errorf("removed = %q", removed)
+	}
+}
+
+func TestEnsureSections(t *testing.T) {
+	c := Changelog{Preamble: []string{"## [1.2.0] - 2026-01-02"}, Sections: []Section{
+		{Title: "Added", Bullets: []string{"Paging cursor"}},
+		{Title: "Fixed"},
+		{Title: "Notes", Bullets: []string{"See the docs"}},
+	}}
+	got, added := EnsureSections(c, []string{"security", "fixed", "changed", "Upgrade"}, "")
+	want := "## [1.2.0] - 2026-01-02\n\n### Added\n\n- Paging cursor\n\n### Changed\n\n- No changes.\n\n### Fixed\n\n- " + EmptySectionText["Fixed"] +
+		"\n\n### Security\n\n- " + EmptySectionText["Security"] + "\n\n### Notes\n\n- See the docs\n\n### Upgrade\n\n- No changes.\n"
+	if s := got.String(); s != want {
+		t.Errorf("EnsureSections =\n%s\nwant:\n%s", s, want)
+	}
+	if wantAdded := []string{"Security", "Fixed", "Changed", "Upgrade"}; !slices.Equal(added, wantAdded) {
+		t.Errorf("added = %q, want %q", added, wantAdded)
+	}
+}
+
+func TestParseChangelogCodeBlocks(t *testing.T) {
+	entry := "## [1.2.0] - 2026-01-02\n\n" +
+		"### Changed\n\n" +
+		"- Config keys are renamed:\n" +
+		"  ```markdown\n  ### Not a heading\n    request_timeout: 30s\n\n  - not a bullet\n  ```\n" +
+		"- Retries back off.\n\n" +
+		"### Fixed\n\n" +
+		"- Handle empty input.\n"
+	c := ParseChangelog(entry)
+	if got := len(c.Sections); got != 2 {
+		t.Fatalf("ParseChangelog found %d sections, want 2: %+v", got, c.Sections)
+	}
+	if got := c.Sections[0].Bullets; len(got) != 2 || !strings.Contains(got[0], "### Not a heading\n  request_timeout: 30s\n\n- not a bullet\n```") {
+		t.Errorf("Changed bullets = %q, want the code block in the first", got)
+	}
+	if got := c.String(); got != entry {
+		t.Errorf("round trip:\n%s\nwant:\n%s", got, entry)
+	}
+
+	unindented := "### Changed\n\n- Config keys are renamed:\n\n```yaml\nrequest_timeout: 30s\n```\n"
+	want := "### Changed\n\n- Config keys are renamed:\n  ```yaml\n  request_timeout: 30s\n  ```\n"
+	if got := ParseChangelog(unindented).String(); got != want {
+		t.Errorf("code block after a bullet:\n%s\nwant:\n%s", got, want)
+	}
+}
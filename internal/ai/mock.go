@@ -0,0 +1,39 @@
+package ai
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MockModel is the model name a Mock reports in its results.
+const MockModel = "mock"
+
+// Mock answers generations with canned responses instead of calling the API,
+// so that prompts and everything done with the response can be tested
+// deterministically and offline.
+type Mock struct {
+	// Responses maps a prompt, exactly as BuildPrompt returns it, to the
+	// response text.
+	Responses map[string]string
+	// Default answers prompts missing from Responses. When it is empty, such
+	// prompts are an error.
+	Default string
+}
+
+// Generate writes the canned response for req to req.Out, and passes it to
+// req.OnDelta in one piece. Like a streamed response, the text always ends
+// in a newline.
+func (m *Mock) Generate(req Request) (Result, error) {
+	prompt := BuildPrompt(req)
+	text, ok := m.Responses[prompt]
+	if !ok {
+		if m.Default == "" {
+			return Result{}, fmt.Errorf("mock has no response for this prompt (%d bytes)", len(prompt))
+		}
+		text = m.Default
+	}
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	return respond(req, MockModel, text)
+}
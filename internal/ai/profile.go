@@ -0,0 +1,52 @@
+package ai
+
+import (
+	"sort"
+	"strings"
+)
+
+// PromptSection is the estimated size of one part of the prompt for a
+// request.
+type PromptSection struct {
+	Name   string // heading of the part, e.g. "Full Diff"; see PromptBreakdown
+	Tokens int    // estimated like EstimateTokens
+}
+
+// PromptBreakdown splits the prompt for req by its headings and estimates the
+// tokens of each part, largest first. Parts with the same heading, such as the
+// commit lists of several repositories, are added up. The system prompt and
+// the instructions before the first heading are reported as "System Prompt"
+// and "Instructions".
+func PromptBreakdown(req Request) []PromptSection {
+	bytes := map[string]int{"System Prompt": len(SystemPrompt(req))}
+	order := []string{"System Prompt"}
+	add := func(name string, n int) {
+		if _, ok := bytes[name]; !ok {
+			order = append(order, name)
+		}
+		bytes[name] += n
+	}
+
+	name, fence := "Instructions", ""
+	for _, line := range strings.SplitAfter(BuildPrompt(req), "\n") {
+		trimmed := strings.TrimRight(line, "\n")
+		switch {
+		case fence != "":
+			if trimmed == fence {
+				fence = ""
+			}
+		case strings.HasPrefix(trimmed, "```"):
+			fence = trimmed[:len(trimmed)-len(strings.TrimLeft(trimmed, "`"))]
+		case strings.HasPrefix(trimmed, "## ") || strings.HasPrefix(trimmed, "### "):
+			name = strings.TrimSpace(strings.TrimLeft(trimmed, "#"))
+		}
+		add(name, len(line))
+	}
+
+	sections := make([]PromptSection, 0, len(order))
+	for _, name := range order {
+		sections = append(sections, PromptSection{Name: name, Tokens: (bytes[name] + 2) / 3})
+	}
+	sort.SliceStable(sections, func(i, j int) bool { return sections[i].Tokens > sections[j].Tokens })
+	return sections
+}
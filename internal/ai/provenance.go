@@ -0,0 +1,42 @@
+package ai
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// ProvenanceMarker starts the HTML comment written by ProvenanceFooter.
+const ProvenanceMarker = "<!-- changelog-provenance: "
+
+// provenance is the record in a ProvenanceFooter. The hashes are of the
+// exact texts sent, which --debug-dir saves as system.md and prompt.md, so
+// an auditor holding those files can check them with sha256sum.
+type provenance struct {
+	Tool         string `json:"tool"`
+	Model        string `json:"model"`
+	From         string `json:"from"`
+	To           string `json:"to"`
+	SystemSHA256 string `json:"system_sha256"`
+	PromptSHA256 string `json:"prompt_sha256"`
+}
+
+// ProvenanceFooter returns a single-line HTML comment recording how an entry
+// was generated from req by the given tool version: the model, the input
+// range, and SHA-256 hashes of the system prompt and prompt. It is invisible
+// in rendered markdown and can be found again by ProvenanceMarker.
+func ProvenanceFooter(req Request, tool string) string {
+	sum := func(s string) string {
+		h := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(h[:])
+	}
+	data, _ := json.Marshal(provenance{
+		Tool:         tool,
+		Model:        req.Model,
+		From:         req.From,
+		To:           req.To,
+		SystemSHA256: sum(SystemPrompt(req)),
+		PromptSHA256: sum(BuildPrompt(req)),
+	})
+	return ProvenanceMarker + string(data) + " -->"
+}
@@ -0,0 +1,265 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go/option"
+)
+
+// RateLimits is the rate-limit state reported in API response headers.
+// Counts are -1 when the header was absent.
+type RateLimits struct {
+	RequestsRemaining int
+	RequestsReset     time.Time
+	TokensRemaining   int // input tokens
+	TokensReset       time.Time
+}
+
+// parseRateLimits reads the anthropic-ratelimit-* headers. ok is false when
+// the response carried none of them.
+func parseRateLimits(h http.Header) (l RateLimits, ok bool) {
+	count := func(name string) int {
+		n, err := strconv.Atoi(h.Get(name))
+		if err != nil {
+			return -1
+		}
+		ok = true
+		return n
+	}
+	reset := func(name string) time.Time {
+		t, _ := time.Parse(time.RFC3339, h.Get(name))
+		return t
+	}
+
+	l.RequestsRemaining = count("anthropic-ratelimit-requests-remaining")
+	l.RequestsReset = reset("anthropic-ratelimit-requests-reset")
+	l.TokensRemaining = count("anthropic-ratelimit-input-tokens-remaining")
+	l.TokensReset = reset("anthropic-ratelimit-input-tokens-reset")
+	if l.TokensRemaining == -1 {
+		// Older accounts report a combined token limit.
+		l.TokensRemaining = count("anthropic-ratelimit-tokens-remaining")
+		l.TokensReset = reset("anthropic-ratelimit-tokens-reset")
+	}
+	return l, ok
+}
+
+// observe returns request middleware that records the rate limits of every
+// response, including retried attempts, under the key it was sent with.
+// With several Keys, each attempt first switches to the next key that the
+// recorded limits leave room for need input tokens, so a retry after a 429
+// goes out with a different key.
+func (g *Generator) observe(need int) option.Middleware {
+	return func(req *http.Request, next option.MiddlewareNext) (*http.Response, error) {
+		if len(g.Keys) > 0 {
+			req.Header.Set("X-Api-Key", g.pickKey(need))
+		}
+		key := req.Header.Get("X-Api-Key")
+		resp, err := next(req)
+		if resp != nil {
+			l, ok := parseRateLimits(resp.Header)
+			if resp.StatusCode == http.StatusTooManyRequests {
+				// Throttled regardless of what the counts say: keep the key
+				// out of rotation until it resets.
+				l, ok = throttled(l, ok, resp.Header), true
+			}
+			if ok {
+				if g.limits == nil {
+					g.limits = map[string]*RateLimits{}
+				}
+				g.limits[key] = &l
+				g.logf("rate limit%s: %d request(s), %d input token(s) remaining", g.keyLabel(key), l.RequestsRemaining, l.TokensRemaining)
+			}
+			if resp.StatusCode == http.StatusTooManyRequests {
+				g.honorRetryAfter(req, resp, key, need)
+			}
+		}
+		return resp, err
+	}
+}
+
+// DefaultMaxRetryWait is the longest retry-after delay a Generator waits out
+// when MaxRetryWait is zero.
+const DefaultMaxRetryWait = 5 * time.Minute
+
+// maxRetries is the number of retries the SDK makes for each request. With
+// several keys, a 429 gets the chance to be retried with every other key.
+func (g *Generator) maxRetries() int {
+	if len(g.Keys) > 1 {
+		return max(2, len(g.Keys))
+	}
+	return 2 // the SDK default
+}
+
+// honorRetryAfter makes the SDK's retry of the 429 response resp wait for
+// the delay in its retry-after header instead of the SDK's own backoff,
+// which ignores delays of a minute or more. It sleeps for the delay, or not
+// at all when another of the Keys is free, then tells the SDK to retry at
+// once. A delay beyond MaxRetryWait fails the request instead. The last
+// attempt and responses the API marks as not retryable are left alone.
+func (g *Generator) honorRetryAfter(req *http.Request, resp *http.Response, key string, need int) {
+	delay, ok := retryAfter(resp.Header)
+	if !ok || resp.Header.Get("x-should-retry") == "false" {
+		return
+	}
+	if n, err := strconv.Atoi(req.Header.Get("X-Stainless-Retry-Count")); err == nil && n >= g.maxRetries() {
+		return
+	}
+	for _, k := range g.Keys {
+		if k != key && g.wait(k, need) <= 0 {
+			delay = 0
+			break
+		}
+	}
+
+	limit := g.MaxRetryWait
+	if limit <= 0 {
+		limit = DefaultMaxRetryWait
+	}
+	if delay > limit {
+		g.logf("rate limited: retry-after asks for %s, longer than the %s limit; not retrying", delay.Round(time.Second), limit)
+		resp.Header.Set("x-should-retry", "false")
+		return
+	}
+	if delay > 0 {
+		g.logf("rate limited: waiting %s per retry-after", delay.Round(time.Second))
+		t := time.NewTimer(delay)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-req.Context().Done():
+			return // the SDK reports the context error
+		}
+	}
+	resp.Header.Set("Retry-After-Ms", "0")
+}
+
+// retryAfter parses the delay a response asks for in its retry-after-ms or
+// retry-after header, the latter in seconds or as an HTTP date.
+func retryAfter(h http.Header) (time.Duration, bool) {
+	if ms, err := strconv.ParseFloat(h.Get("retry-after-ms"), 64); err == nil && ms >= 0 {
+		return time.Duration(ms * float64(time.Millisecond)), true
+	}
+	v := h.Get("retry-after")
+	if secs, err := strconv.ParseFloat(v, 64); err == nil && secs >= 0 {
+		return time.Duration(secs * float64(time.Second)), true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
+
+// throttled returns the limits of a 429 response: no requests remaining
+// until the later of the reported reset and the retry-after delay, or a
+// minute from now when the response gives neither.
+func throttled(l RateLimits, ok bool, h http.Header) RateLimits {
+	if !ok {
+		l = RateLimits{TokensRemaining: -1}
+	}
+	l.RequestsRemaining = 0
+	if d, ok := retryAfter(h); ok {
+		if t := time.Now().Add(d); t.After(l.RequestsReset) {
+			l.RequestsReset = t
+		}
+	}
+	if l.RequestsReset.IsZero() {
+		l.RequestsReset = time.Now().Add(time.Minute)
+	}
+	return l
+}
+
+// keys returns the API keys req may be sent with.
+func (g *Generator) keys(req Request) []string {
+	if len(g.Keys) > 0 {
+		return g.Keys
+	}
+	return []string{req.APIKey}
+}
+
+// pickKey returns the next key in rotation whose recorded limits allow a
+// request needing need input tokens now, or the one that resets soonest when
+// none does.
+func (g *Generator) pickKey(need int) string {
+	n := len(g.Keys)
+	soonest, soonestWait := g.Keys[g.next%n], time.Duration(-1)
+	for i := 0; i < n; i++ {
+		k := g.Keys[(g.next+i)%n]
+		w := g.wait(k, need)
+		if w <= 0 {
+			g.next = (g.next + i + 1) % n
+			return k
+		}
+		if soonestWait < 0 || w < soonestWait {
+			soonest, soonestWait = k, w
+		}
+	}
+	return soonest
+}
+
+// keyLabel identifies key in diagnostics by its position in Keys, never by
+// its value; it is "" when there is only Request.APIKey.
+func (g *Generator) keyLabel(key string) string {
+	for i, k := range g.Keys {
+		if k == key {
+			return fmt.Sprintf(" (key %d of %d)", i+1, len(g.Keys))
+		}
+	}
+	return ""
+}
+
+// wait returns how long to wait before sending a request needing need input
+// tokens with key: until the relevant limit resets when the last response for
+// key left no requests or too few input tokens, else zero or less.
+func (g *Generator) wait(key string, need int) time.Duration {
+	l := g.limits[key]
+	if l == nil {
+		return 0
+	}
+	var until time.Time
+	if l.RequestsRemaining == 0 {
+		until = l.RequestsReset
+	}
+	if l.TokensRemaining >= 0 && l.TokensRemaining < need && l.TokensReset.After(until) {
+		until = l.TokensReset
+	}
+	return time.Until(until)
+}
+
+// pace sleeps until a limit resets when none of the keys req may use has
+// headroom for its prompt, judged by the last response for each key.
+func (g *Generator) pace(ctx context.Context, req Request) error {
+	need := EstimateTokens(req)
+	wait := time.Duration(-1)
+	for _, k := range g.keys(req) {
+		w := g.wait(k, need)
+		if w <= 0 {
+			return nil
+		}
+		if wait < 0 || w < wait {
+			wait = w
+		}
+	}
+	if wait <= 0 {
+		return nil
+	}
+
+	g.logf("rate limit: near the limit, waiting %s for it to reset", wait.Round(time.Second))
+	t := time.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (g *Generator) logf(format string, args ...any) {
+	if g.Logf != nil {
+		g.Logf(format, args...)
+	}
+}
@@ -0,0 +1,39 @@
+package ai
+
+import "strings"
+
+// EmojiIcons is the default icon of each Keep a Changelog section for
+// --theme emoji.
+var EmojiIcons = map[string]string{
+	"Added":      "✨",
+	"Changed":    "🔄",
+	"Deprecated": "⚠️",
+	"Removed":    "🗑️",
+	"Fixed":      "🐛",
+	"Security":   "🔒",
+}
+
+// ApplyTheme puts the icon of each "### " section heading in text before its
+// title, as in "### ✨ Added". Titles are matched case-insensitively against
+// the keys of icons; other headings are left alone, as are headings that
+// already start with their icon, so applying it twice changes nothing more.
+func ApplyTheme(text string, icons map[string]string) string {
+	lines := strings.Split(text, "\n")
+	fence := false
+	for i, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			fence = !fence
+		}
+		if fence || !strings.HasPrefix(line, "### ") {
+			continue
+		}
+		title := strings.TrimSpace(line[4:])
+		for name, icon := range icons {
+			if strings.EqualFold(title, name) {
+				lines[i] = "### " + icon + " " + title
+				break
+			}
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,124 @@
+package ai
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Violation is a way in which a generated entry departs from the Keep a
+// Changelog format.
+type Violation struct {
+	Line    int // 1-based line in the entry; 0 for the entry as a whole
+	Message string
+}
+
+func (v Violation) String() string {
+	if v.Line == 0 {
+		return v.Message
+	}
+	return fmt.Sprintf("line %d: %s", v.Line, v.Message)
+}
+
+// keepAChangelogSections are the section headings Keep a Changelog allows.
+var keepAChangelogSections = []string{"Added", "Changed", "Deprecated", "Removed", "Fixed", "Security"}
+
+// ValidateKeepAChangelog checks a generated entry against the format asked
+// for by req: the exact version header (or none for a fragment), only the
+// standard ### sections, each used once and non-empty, and nothing but
+// bullets beneath them. Section names are not checked when req translates
+// headings.
+func ValidateKeepAChangelog(text string, req Request) []Violation {
+	var vs []Violation
+	add := func(line int, format string, args ...any) {
+		vs = append(vs, Violation{Line: line, Message: fmt.Sprintf(format, args...)})
+	}
+
+	lines := strings.Split(strings.ReplaceAll(strings.TrimRight(text, "\n"), "\r\n", "\n"), "\n")
+	first := 0
+	for first < len(lines) && strings.TrimSpace(lines[first]) == "" {
+		first++
+	}
+	if first == len(lines) {
+		return []Violation{{Message: "the entry is empty"}}
+	}
+
+	i := first
+	if req.VersionHeader != "" {
+		got := strings.TrimSpace(lines[i])
+		if got != req.VersionHeader {
+			add(i+1, "first line is %q, want the version header %q", got, req.VersionHeader)
+		}
+		if got == req.VersionHeader || strings.HasPrefix(got, "## ") {
+			i++ // a wrong header is reported once, not again as a stray heading
+		}
+	}
+
+	seen := map[string]int{} // section title → line
+	section, bullets := "", 0
+	endSection := func() {
+		if section != "" && bullets == 0 {
+			add(seen[section], "section %q has no bullets", section)
+		}
+	}
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		n := i + 1
+		switch {
+		case trimmed == "":
+		case strings.HasPrefix(trimmed, "### "):
+			endSection()
+			section, bullets = strings.TrimSpace(trimmed[4:]), 0
+			if prev, dup := seen[section]; dup {
+				add(n, "section %q repeats the one on line %d", section, prev)
+			}
+			seen[section] = n
+			if !req.TranslateHeadings && !allowedSection(section) {
+				add(n, "section %q is not one of %s", section, strings.Join(keepAChangelogSections, ", "))
+			}
+		case strings.HasPrefix(trimmed, "#"):
+			add(n, "unexpected heading %q; only ### sections belong in an entry", trimmed)
+		case isBullet(line):
+			if section == "" {
+				add(n, "bullet outside a ### section")
+			}
+			bullets++
+		case bullets > 0 && (line[0] == ' ' || line[0] == '\t'):
+			// continuation of the previous bullet
+		default:
+			add(n, "stray text outside a bullet: %q", truncate(trimmed, 60))
+		}
+	}
+	endSection()
+	return vs
+}
+
+// allowedSection reports whether title is a standard Keep a Changelog section.
+func allowedSection(title string) bool {
+	for _, s := range keepAChangelogSections {
+		if title == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Repair asks the model to correct a previous response that failed
+// validation; see Request.Repair.
+type Repair struct {
+	Previous   string      // the rejected response
+	Violations []Violation // what was wrong with it
+}
+
+// writeRepair appends the repair instructions for r to the prompt.
+func writeRepair(sb *strings.Builder, r *Repair) {
+	sb.WriteString("## Previous Attempt\n\n")
+	sb.WriteString("A previous answer to this request did not follow the required format:\n\n")
+	for _, v := range r.Violations {
+		sb.WriteString("- ")
+		sb.WriteString(v.String())
+		sb.WriteString("\n")
+	}
+	sb.WriteString("\nRewrite it so that it follows every rule, keeping the same content. Output only the corrected changelog.\n\n")
+	writeFenced(sb, "markdown", strings.TrimSpace(r.Previous))
+}
@@ -0,0 +1,199 @@
+// Package forge talks to the code-hosting service behind a repository's
+// remote to enrich changelog input with issue and pull request metadata.
+package forge
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnavailable is returned when the forge API cannot be used right now
+// (network failure, rate limit, server error). Callers should skip the
+// enrichment rather than fail the run.
+var ErrUnavailable = errors.New("forge API unavailable")
+
+// GitHub is a minimal client for the GitHub REST API.
+type GitHub struct {
+	Owner, Repo string
+	Token       string // optional; raises the rate limit and allows private repos
+	BaseURL     string // defaults to https://api.github.com
+	CacheDir    string // label cache; empty disables caching
+	HTTP        *http.Client
+
+	// CacheTTL is how long cached labels are used before they are fetched
+	// again; zero fetches them every time.
+	CacheTTL time.Duration
+}
+
+// DefaultCacheTTL is the CacheTTL of NewGitHub clients, so that label changes
+// show up the next day without the cache having to be cleared.
+const DefaultCacheTTL = 24 * time.Hour
+
+var githubRemoteRe = regexp.MustCompile(`github\.com[:/]([^/]+)/([^/]+?)(?:\.git)?/?$`)
+
+// ParseGitHubRemote extracts owner and repository name from a GitHub remote
+// URL in HTTPS or SSH form. ok is false for non-GitHub remotes.
+func ParseGitHubRemote(url string) (owner, repo string, ok bool) {
+	m := githubRemoteRe.FindStringSubmatch(strings.TrimSpace(url))
+	if m == nil {
+		return "", "", false
+	}
+	return m[1], m[2], true
+}
+
+// NewGitHub returns a client for owner/repo that caches label names under
+// the user cache directory for DefaultCacheTTL.
+func NewGitHub(owner, repo, token string) *GitHub {
+	g := &GitHub{
+		Owner:    owner,
+		Repo:     repo,
+		Token:    token,
+		BaseURL:  "https://api.github.com",
+		HTTP:     &http.Client{Timeout: 10 * time.Second},
+		CacheTTL: DefaultCacheTTL,
+	}
+	if dir, err := os.UserCacheDir(); err == nil {
+		g.CacheDir = filepath.Join(dir, "ai-changelog-generator", "github", owner, repo)
+	}
+	return g
+}
+
+// CompareURL returns the GitHub page listing the changes from ref from to
+// ref to, or the history up to to when from is empty, as in the "Full
+// Changelog" line of GitHub's generated release notes.
+func CompareURL(owner, repo, from, to string) string {
+	if from == "" {
+		return fmt.Sprintf("https://github.com/%s/%s/commits/%s", owner, repo, to)
+	}
+	return fmt.Sprintf("https://github.com/%s/%s/compare/%s...%s", owner, repo, from, to)
+}
+
+var issueRefRe = regexp.MustCompile(`(?:^|[^\w&])#(\d+)\b`)
+
+// IssueRefs returns the distinct issue/PR numbers referenced as #N in texts,
+// in ascending order.
+func IssueRefs(texts ...string) []int {
+	seen := map[int]bool{}
+	var refs []int
+	for _, t := range texts {
+		for _, m := range issueRefRe.FindAllStringSubmatch(t, -1) {
+			n, err := strconv.Atoi(m[1])
+			if err != nil || seen[n] {
+				continue
+			}
+			seen[n] = true
+			refs = append(refs, n)
+		}
+	}
+	sort.Ints(refs)
+	return refs
+}
+
+// issue is the subset of the GitHub issue payload the tool uses. Pull
+// requests are returned by the same endpoint.
+type issue struct {
+	Labels []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+}
+
+// Labels returns the label names of issue or pull request n. Unknown numbers
+// yield no labels; ErrUnavailable wraps transient and rate-limit failures.
+// Only the names are cached, never the rest of the issue, since the titles
+// and bodies of private issues do not belong on disk.
+func (g *GitHub) Labels(n int) ([]string, error) {
+	var cacheFile string
+	if g.CacheDir != "" {
+		cacheFile = filepath.Join(g.CacheDir, "labels", strconv.Itoa(n)+".json")
+		if names, ok := g.readCache(cacheFile); ok {
+			return names, nil
+		}
+	}
+
+	body, err := g.get(fmt.Sprintf("issues/%d", n))
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		return nil, nil
+	}
+	var is issue
+	if err := json.Unmarshal(body, &is); err != nil {
+		return nil, fmt.Errorf("decoding issue #%d: %w", n, err)
+	}
+	names := []string{}
+	for _, l := range is.Labels {
+		names = append(names, l.Name)
+	}
+	if cacheFile != "" {
+		// Best effort: a cache write failure only costs a later request.
+		if data, err := json.Marshal(names); err == nil && os.MkdirAll(filepath.Dir(cacheFile), 0700) == nil {
+			_ = os.WriteFile(cacheFile, data, 0600)
+		}
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	return names, nil
+}
+
+// readCache returns the label names cached in file, with ok false when there
+// are none or they are older than g.CacheTTL.
+func (g *GitHub) readCache(file string) (names []string, ok bool) {
+	info, err := os.Stat(file)
+	if err != nil || time.Since(info.ModTime()) >= g.CacheTTL {
+		return nil, false
+	}
+	data, err := os.ReadFile(file)
+	if err != nil || json.Unmarshal(data, &names) != nil {
+		return nil, false
+	}
+	if len(names) == 0 {
+		names = nil
+	}
+	return names, true
+}
+
+// get returns the body of GET /repos/{owner}/{repo}/{path}. A nil body means
+// the resource does not exist.
+func (g *GitHub) get(path string) ([]byte, error) {
+	url := fmt.Sprintf("%s/repos/%s/%s/%s", strings.TrimRight(g.BaseURL, "/"), g.Owner, g.Repo, path)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if g.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.Token)
+	}
+
+	resp, err := g.HTTP.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return nil, nil
+	case resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests:
+		return nil, fmt.Errorf("%w: rate limited (HTTP %d)", ErrUnavailable, resp.StatusCode)
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("%w: HTTP %d", ErrUnavailable, resp.StatusCode)
+	}
+
+	var raw json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("%w: reading response: %v", ErrUnavailable, err)
+	}
+	return raw, nil
+}
@@ -0,0 +1,91 @@
+package forge
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLabelsCachesOnlyNames(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/repos/acme/widget/issues/12":
+			w.Write([]byte(`{"number": 12, "title": "Secret launch plan", "body": "Private details", "labels": [{"name": "kind/bug"}, {"name": "area/api"}]}`))
+		case "/repos/acme/widget/issues/13":
+			w.Write([]byte(`{"number": 13, "title": "Unlabeled", "labels": []}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	g := &GitHub{Owner: "acme", Repo: "widget", BaseURL: srv.URL, CacheDir: dir, HTTP: srv.Client(), CacheTTL: time.Hour}
+	for _, tc := range []struct {
+		n    int
+		want []string
+	}{
+		{12, []string{"kind/bug", "area/api"}},
+		{13, nil},
+		{14, nil},
+	} {
+		for run := 0; run < 2; run++ {
+			got, err := g.Labels(tc.n)
+			if err != nil || !slices.Equal(got, tc.want) {
+				t.Errorf("Labels(%d), run %d = %q, %v; want %q", tc.n, run, got, err, tc.want)
+			}
+		}
+	}
+	// Unknown issues are not cached; the others are read from the cache the
+	// second time.
+	if requests != 4 {
+		t.Errorf("made %d requests, want 4", requests)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "labels", "12.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); got != `["kind/bug","area/api"]` {
+		t.Errorf("cache file = %s, want only the label names", got)
+	}
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if data, err := os.ReadFile(path); err == nil && strings.Contains(string(data), "Secret") {
+			t.Errorf("%s caches the issue title", path)
+		}
+		return nil
+	})
+}
+
+func TestLabelsCacheExpires(t *testing.T) {
+	label := "kind/bug"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"labels": [{"name": "` + label + `"}]}`))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	g := &GitHub{Owner: "acme", Repo: "widget", BaseURL: srv.URL, CacheDir: dir, HTTP: srv.Client(), CacheTTL: time.Hour}
+	if _, err := g.Labels(12); err != nil {
+		t.Fatal(err)
+	}
+	label = "kind/feature"
+	if got, _ := g.Labels(12); !slices.Equal(got, []string{"kind/bug"}) {
+		t.Errorf("fresh cache entry: Labels = %q, want the cached label", got)
+	}
+
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "labels", "12.json"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := g.Labels(12); !slices.Equal(got, []string{"kind/feature"}) {
+		t.Errorf("expired cache entry: Labels = %q, want the label fetched again", got)
+	}
+}
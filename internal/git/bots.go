@@ -0,0 +1,68 @@
+package git
+
+import (
+	"regexp"
+	"strings"
+)
+
+// dependencyBotRe matches the accounts of well-known dependency updaters,
+// with or without GitHub's "[bot]" suffix.
+var dependencyBotRe = regexp.MustCompile(`(?i)^(dependabot|renovate|renovate-bot|greenkeeper|depfu|pyup-bot|snyk-bot)(\[bot\])?$`)
+
+// botEmailRe matches the no-reply addresses of GitHub Apps, such as
+// 49699333+dependabot[bot]@users.noreply.github.com, and the addresses of
+// GitHub Actions and Renovate.
+var botEmailRe = regexp.MustCompile(`(?i)(\[bot\]@users\.noreply\.github\.com|^actions@github\.com|^bot@renovateapp\.com)$`)
+
+// dependencyBumpRes match the subjects that dependency updaters write, e.g.
+// "Bump golang.org/x/net from 0.17.0 to 0.23.0",
+// "build(deps): bump actions/checkout from 3 to 4",
+// "chore(deps): update dependency eslint to v9", and
+// "Update module github.com/foo/bar to v2.1.0".
+var dependencyBumpRes = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)^bump \S+ from \S+ to \S+`),
+	regexp.MustCompile(`(?i)^(build|chore|fix|ci)\(deps(-dev)?\): (bump|update)\b`),
+	regexp.MustCompile(`(?i)^update (dependency|module) \S+ to v?\d`),
+}
+
+// IsDependencyBump reports whether c is an automated dependency update,
+// judged by its author or its subject.
+func IsDependencyBump(c Commit) bool {
+	if dependencyBotRe.MatchString(c.Author) {
+		return true
+	}
+	for _, re := range dependencyBumpRes {
+		if re.MatchString(c.Subject) {
+			return true
+		}
+	}
+	return false
+}
+
+// SplitDependencyBumps separates dependency-update commits from the rest,
+// keeping the order of each.
+func SplitDependencyBumps(commits []Commit) (rest, bumps []Commit) {
+	for _, c := range commits {
+		if IsDependencyBump(c) {
+			bumps = append(bumps, c)
+		} else {
+			rest = append(rest, c)
+		}
+	}
+	return rest, bumps
+}
+
+// IsBot reports whether c was authored by an automated account: a GitHub App
+// or a known dependency updater, judged by the author name or email.
+func IsBot(c Commit) bool {
+	return dependencyBotRe.MatchString(c.Author) || strings.HasSuffix(strings.ToLower(c.Author), "[bot]") ||
+		botEmailRe.MatchString(c.Email)
+}
+
+// MatchesAuthor reports whether pattern occurs, ignoring case, in the author
+// name or email of c, so that "dependabot" matches "dependabot[bot]" and
+// "@example.com" matches everyone at example.com.
+func MatchesAuthor(c Commit, pattern string) bool {
+	pattern = strings.ToLower(pattern)
+	return strings.Contains(strings.ToLower(c.Author), pattern) || strings.Contains(strings.ToLower(c.Email), pattern)
+}
@@ -0,0 +1,94 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+)
+
+// topLevelDir returns the first component of the repository-relative path p,
+// or "" for a file at the repository root.
+func topLevelDir(p string) string {
+	if i := strings.IndexByte(p, '/'); i != -1 {
+		return p[:i]
+	}
+	return ""
+}
+
+// CapDiffPerDir limits how many changed (added or removed) lines the files
+// of each top-level directory contribute to diff, a patch as printed by
+// FullDiff. Once a directory has used max lines, the rest of its hunks are
+// dropped; each file that lost lines keeps its header and gets a marker
+// saying how many were omitted. It returns the capped patch and the number of
+// changed lines omitted per directory ("" for the repository root).
+func CapDiffPerDir(diff string, max int) (string, map[string]int) {
+	var sb strings.Builder
+	used := map[string]int{}
+	omitted := map[string]int{}
+
+	dir := ""         // top-level directory of the current file
+	inFile := false   // within the section of a file
+	inHunks := false  // past the file header, within its hunks
+	fileOmitted := 0  // changed lines dropped from the current file
+	dropping := false // the current file is over its directory's budget
+	endFile := func() {
+		if fileOmitted > 0 {
+			fmt.Fprintf(&sb, "[... %d more changed line(s) omitted: %s reached the per-directory diff budget ...]\n", fileOmitted, dirLabel(dir))
+		}
+		inFile, inHunks, fileOmitted, dropping = false, false, 0, false
+	}
+
+	lines := strings.SplitAfter(diff, "\n")
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			endFile()
+			inFile = true
+			dir = topLevelDir(diffPath(line))
+			dropping = used[dir] >= max
+		case inFile && strings.HasPrefix(line, "@@"):
+			inHunks = true
+			if dropping {
+				continue
+			}
+		case inHunks && (line[0] == '+' || line[0] == '-'):
+			if dropping || used[dir] >= max {
+				dropping = true
+				fileOmitted++
+				omitted[dir]++
+				continue
+			}
+			used[dir]++
+		case inHunks && (line[0] == ' ' || line[0] == '\\'):
+			if dropping {
+				continue
+			}
+		case inHunks:
+			// Anything else, such as the next commit of a per-commit patch,
+			// ends the file.
+			endFile()
+		}
+		sb.WriteString(line)
+	}
+	endFile()
+	return sb.String(), omitted
+}
+
+// diffPath returns the (new) path named by a "diff --git a/x b/y" line.
+func diffPath(header string) string {
+	header = strings.TrimRight(header, "\n")
+	if i := strings.LastIndex(header, " b/"); i != -1 {
+		return header[i+3:]
+	}
+	return strings.TrimPrefix(header, "diff --git ")
+}
+
+// dirLabel names dir in an omission marker.
+func dirLabel(dir string) string {
+	if dir == "" {
+		return "the repository root"
+	}
+	return dir + "/"
+}
@@ -1,9 +1,13 @@
 package git
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -12,15 +16,78 @@ import (
 // used to diff from "nothing" when there is no prior commit to compare against.
 const emptyTreeSHA = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
 
+// Binary is the git executable run by this package: a name looked up on
+// PATH or a path to a git-compatible wrapper.
+var Binary = "git"
+
+// Env holds extra KEY=VALUE entries added to the environment of every git
+// command, after the inherited environment.
+var Env []string
+
+// CheckBinary verifies that Binary resolves to an executable file.
+func CheckBinary() error {
+	if _, err := exec.LookPath(Binary); err != nil {
+		return fmt.Errorf("git binary %q is not executable: %w", Binary, err)
+	}
+	return nil
+}
+
+// configOverrides pin the git settings that change output format, so that
+// diffs look the same regardless of the user's ~/.gitconfig. The advice
+// settings turn off the "hint:" lines that newer versions of git add to
+// stderr, which would otherwise end up in error messages; git ignores the
+// ones it does not know.
+var configOverrides = []string{
+	"-c", "color.ui=never",
+	"-c", "color.diff=never",
+	"-c", "diff.noprefix=false",
+	"-c", "diff.mnemonicPrefix=false",
+	"-c", "core.pager=cat",
+	"-c", "advice.detachedHead=false",
+	"-c", "advice.nestedTag=false",
+	"-c", "advice.implicitIdentity=false",
+	"-c", "advice.addIgnoredFile=false",
+	"-c", "advice.addEmptyPathspec=false",
+	"-c", "advice.ignoredHook=false",
+	"-c", "advice.statusHints=false",
+	"-c", "advice.waitingForEditor=false",
+	"-c", "advice.defaultBranchName=false",
+	"-c", "advice.forceDeleteBranch=false",
+}
+
+// Error is returned when a git command fails.
+type Error struct {
+	Args   []string // arguments after "git"
+	Stderr string   // trimmed stderr, when git ran and exited non-zero
+	Err    error    // underlying exec error
+}
+
+func (e *Error) Error() string {
+	if e.Stderr != "" {
+		return fmt.Sprintf("git %s: %s", strings.Join(e.Args, " "), e.Stderr)
+	}
+	return fmt.Sprintf("git %s: %v", strings.Join(e.Args, " "), e.Err)
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
 func runGit(repoPath string, args ...string) (string, error) {
-	cmd := exec.Command("git", args...)
+	return runGitInput(repoPath, "", args...)
+}
+
+// runGitInput is runGit with stdin fed from input.
+func runGitInput(repoPath, input string, args ...string) (string, error) {
+	cmd := exec.Command(Binary, append(configOverrides, args...)...)
 	cmd.Dir = repoPath
+	cmd.Stdin = strings.NewReader(input)
+	cmd.Env = append(append(os.Environ(), "GIT_CONFIG_NOSYSTEM=1", "GIT_TERMINAL_PROMPT=0"), Env...)
 	out, err := cmd.Output()
 	if err != nil {
+		gitErr := &Error{Args: args, Err: err}
 		if exitErr, ok := err.(*exec.ExitError); ok {
-			return "", fmt.Errorf("git %s: %s", strings.Join(args, " "), strings.TrimSpace(string(exitErr.Stderr)))
+			gitErr.Stderr = strings.TrimSpace(string(exitErr.Stderr))
 		}
-		return "", fmt.Errorf("git %s: %w", strings.Join(args, " "), err)
+		return "", gitErr
 	}
 	return strings.TrimRight(string(out), "\n"), nil
 }
@@ -38,45 +105,500 @@ func LastReleaseTag(repoPath string) (string, error) {
 	return runGit(repoPath, "describe", "--tags", "--abbrev=0")
 }
 
-// CommitLog returns one-line commit messages from from..to, excluding merges.
-// When from is empty, all commits reachable from to are returned.
-func CommitLog(repoPath, from, to string) ([]string, error) {
-	var out string
-	var err error
-	if from == "" {
-		out, err = runGit(repoPath, "log", "--oneline", "--no-merges", to)
-	} else {
-		out, err = runGit(repoPath, "log", "--oneline", "--no-merges", from+".."+to)
+// LastStableTag is LastReleaseTag ignoring pre-release tags, which contain a
+// "-" as in v1.3.0-rc.1. Returns ("", nil) when no other tag is reachable
+// from HEAD.
+func LastStableTag(repoPath string) (string, error) {
+	out, err := runGit(repoPath, "tag", "--merged", "HEAD")
+	if err != nil || out == "" {
+		return "", err
+	}
+	tags := strings.Split(out, "\n")
+	for _, t := range tags {
+		if !strings.Contains(t, "-") {
+			return runGit(repoPath, "describe", "--tags", "--abbrev=0", "--exclude", "*-*")
+		}
+	}
+	return "", nil
+}
+
+// ListTags returns the tags matching the glob pattern, or all tags when
+// pattern is empty.
+func ListTags(repoPath, pattern string) ([]string, error) {
+	args := []string{"tag", "-l"}
+	if pattern != "" {
+		args = append(args, pattern)
+	}
+	out, err := runGit(repoPath, args...)
+	if err != nil || out == "" {
+		return nil, err
+	}
+	return strings.Split(out, "\n"), nil
+}
+
+// RangeTag is a tag on a commit in a range, as listed by TagsInRange.
+type RangeTag struct {
+	Name   string
+	Commit string // full SHA of the tagged commit
+	Date   string // YYYY-MM-DD: the tagger date of an annotated tag, else the commit date
+}
+
+// TagsInRange returns the tags on the commits in from..to, or in all of to's
+// history when from is empty, oldest first: in the order of the commits they
+// tag, and by name for tags on the same commit.
+func TagsInRange(repoPath, from, to string) ([]RangeTag, error) {
+	revs, err := runGit(repoPath, append([]string{"rev-list", "--topo-order", "--reverse"}, logRange(from, to, nil)...)...)
+	if err != nil {
+		return nil, err
+	}
+	pos := map[string]int{}
+	for i, sha := range strings.Split(revs, "\n") {
+		pos[sha] = i
+	}
+	out, err := runGit(repoPath, "for-each-ref", "--merged="+to, "--format=%(refname:short)%1f%(objectname)%1f%(*objectname)%1f%(creatordate:short)", "refs/tags")
+	if err != nil || out == "" {
+		return nil, err
+	}
+	var tags []RangeTag
+	for _, line := range strings.Split(out, "\n") {
+		f := strings.Split(line, "\x1f")
+		if len(f) != 4 {
+			return nil, fmt.Errorf("unexpected for-each-ref output %q", line)
+		}
+		t := RangeTag{Name: f[0], Commit: f[2], Date: f[3]}
+		if t.Commit == "" {
+			t.Commit = f[1] // lightweight
+		}
+		if _, ok := pos[t.Commit]; ok {
+			tags = append(tags, t)
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool {
+		if pos[tags[i].Commit] != pos[tags[j].Commit] {
+			return pos[tags[i].Commit] < pos[tags[j].Commit]
+		}
+		return tags[i].Name < tags[j].Name
+	})
+	return tags, nil
+}
+
+// Commit describes a single commit in a release range.
+type Commit struct {
+	SHA     string // abbreviated hash
+	Subject string
+	Author  string
+	Email   string // author email; may be empty
+	Date    string // YYYY-MM-DD
+	Body    string // message body without the subject line; may be empty
+}
+
+// commitFormat is the git log --format used by CommitLog. Fields are separated
+// by the ASCII unit separator and records by the record separator so that
+// subjects and bodies can contain arbitrary text.
+const commitFormat = "%h%x1f%s%x1f%an%x1f%ae%x1f%ad%x1f%b%x1e"
+
+// logRange returns git log revision arguments selecting from..to minus any
+// commits reachable from the exclude refs.
+func logRange(from, to string, exclude []string) []string {
+	rev := to
+	if from != "" {
+		rev = from + ".." + to
+	}
+	args := []string{rev}
+	if len(exclude) > 0 {
+		args = append(append(args, "--not"), exclude...)
+	}
+	return args
+}
+
+// RemoteURL returns the fetch URL of the named remote.
+func RemoteURL(repoPath, name string) (string, error) {
+	return runGit(repoPath, "remote", "get-url", name)
+}
+
+// CurrentBranch returns the short name of the checked-out branch, or "" when
+// HEAD is detached.
+func CurrentBranch(repoPath string) (string, error) {
+	out, err := runGit(repoPath, "symbolic-ref", "--quiet", "--short", "HEAD")
+	if err != nil {
+		var ge *Error
+		if errors.As(err, &ge) && ge.Stderr == "" {
+			return "", nil // exit 1 without a message: detached HEAD
+		}
+		return "", err
+	}
+	return out, nil
+}
+
+// DefaultBranch returns the default branch of the named remote, read from the
+// local refs/remotes/<remote>/HEAD or, when that is not set, by asking the
+// remote. Returns ("", nil) when it cannot be determined.
+func DefaultBranch(repoPath, remote string) (string, error) {
+	if out, err := runGit(repoPath, "symbolic-ref", "--quiet", "--short", "refs/remotes/"+remote+"/HEAD"); err == nil {
+		return strings.TrimPrefix(out, remote+"/"), nil
+	}
+	if _, err := RemoteURL(repoPath, remote); err != nil {
+		return "", nil // no such remote
+	}
+	out, err := runGit(repoPath, "remote", "show", remote)
+	if err != nil {
+		return "", fmt.Errorf("querying remote %s: %w", remote, err)
+	}
+	for _, line := range strings.Split(out, "\n") {
+		if b, ok := strings.CutPrefix(strings.TrimSpace(line), "HEAD branch: "); ok && b != "(unknown)" {
+			return b, nil
+		}
+	}
+	return "", nil
+}
+
+// IsWorkTree reports whether repoPath is inside the work tree of a git
+// repository. It is false for a directory outside any repository and for a
+// bare repository or the .git directory itself, which have no work tree.
+func IsWorkTree(repoPath string) bool {
+	out, err := runGit(repoPath, "rev-parse", "--is-inside-work-tree")
+	return err == nil && out == "true"
+}
+
+// GitDir returns the absolute path of the repository's .git directory.
+func GitDir(repoPath string) (string, error) {
+	return runGit(repoPath, "rev-parse", "--absolute-git-dir")
+}
+
+// IsShallow reports whether repoPath is a shallow clone, in which case tags
+// and range operations only see part of the history.
+func IsShallow(repoPath string) (bool, error) {
+	out, err := runGit(repoPath, "rev-parse", "--is-shallow-repository")
+	if err != nil {
+		return false, err
+	}
+	return out == "true", nil
+}
+
+// Unshallow fetches the complete history and tags of a shallow clone.
+func Unshallow(repoPath string) error {
+	if _, err := runGit(repoPath, "fetch", "--unshallow", "--tags"); err != nil {
+		return fmt.Errorf("fetching full history: %w", err)
 	}
+	return nil
+}
+
+// CommitLog returns the commits in from..to, newest first, excluding merges.
+// When from is empty, all commits reachable from to are returned. Commits
+// reachable from any exclude ref are omitted.
+func CommitLog(repoPath, from, to string, exclude ...string) ([]Commit, error) {
+	args := append([]string{"log", "--no-merges", "--date=short", "--format=" + commitFormat}, logRange(from, to, exclude)...)
+	out, err := runGit(repoPath, args...)
 	if err != nil {
 		return nil, err
 	}
-	if out == "" {
+	return parseCommits(out), nil
+}
+
+// LookupCommits returns the given commits in the order listed, rather than a
+// range. Each entry must name a commit; see ResolveCommit.
+func LookupCommits(repoPath string, shas []string) ([]Commit, error) {
+	if len(shas) == 0 {
 		return nil, nil
 	}
+	args := append([]string{"log", "--no-walk=unsorted", "--date=short", "--format=" + commitFormat}, shas...)
+	out, err := runGit(repoPath, args...)
+	if err != nil {
+		return nil, err
+	}
+	return parseCommits(out), nil
+}
+
+// parseCommits splits git log output produced with commitFormat into commits.
+func parseCommits(out string) []Commit {
+	var commits []Commit
+	for _, rec := range strings.Split(out, "\x1e") {
+		rec = strings.TrimLeft(rec, "\n")
+		if rec == "" {
+			continue
+		}
+		f := strings.SplitN(rec, "\x1f", 6)
+		for len(f) < 6 {
+			f = append(f, "")
+		}
+		commits = append(commits, Commit{
+			SHA:     f[0],
+			Subject: f[1],
+			Author:  f[2],
+			Email:   f[3],
+			Date:    f[4],
+			Body:    strings.TrimSpace(f[5]),
+		})
+	}
+	return commits
+}
+
+// ResolveCommit returns the full SHA of the commit rev refers to.
+func ResolveCommit(repoPath, rev string) (string, error) {
+	sha, err := runGit(repoPath, "rev-parse", "--verify", "--quiet", rev+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("%q does not name a commit", rev)
+	}
+	return sha, nil
+}
+
+// MergeBase returns the full SHA of the best common ancestor of a and b, as
+// git merge-base picks it. It returns ("", nil) when the histories share no
+// commit.
+func MergeBase(repoPath, a, b string) (string, error) {
+	out, err := runGit(repoPath, "merge-base", a, b)
+	var ge *Error
+	if errors.As(err, &ge) && ge.Stderr == "" {
+		var exitErr *exec.ExitError
+		if errors.As(ge.Err, &exitErr) && exitErr.ExitCode() == 1 {
+			return "", nil // unrelated histories
+		}
+	}
+	return out, err
+}
+
+// PreparedMessage returns the commit message git has prepared for the next
+// commit while a merge or squash merge is in progress (MERGE_MSG or
+// SQUASH_MSG), without its "#" comment lines, or "" when there is none.
+func PreparedMessage(repoPath string) (string, error) {
+	dir, err := GitDir(repoPath)
+	if err != nil {
+		return "", err
+	}
+	for _, name := range []string{"MERGE_MSG", "SQUASH_MSG"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		var lines []string
+		for _, line := range strings.Split(string(data), "\n") {
+			if !strings.HasPrefix(line, "#") {
+				lines = append(lines, line)
+			}
+		}
+		if msg := strings.TrimSpace(strings.Join(lines, "\n")); msg != "" {
+			return msg, nil
+		}
+	}
+	return "", nil
+}
+
+// UserName returns the configured user.name, or "" when it is unset.
+func UserName(repoPath string) string {
+	name, err := runGit(repoPath, "config", "--get", "user.name")
+	if err != nil {
+		return ""
+	}
+	return name
+}
+
+// ShortSHA returns git's abbreviated form of the commit rev refers to.
+func ShortSHA(repoPath, rev string) (string, error) {
+	return runGit(repoPath, "rev-parse", "--short", rev+"^{commit}")
+}
+
+// Parent returns the first parent of sha, so that Parent(sha)..sha covers just
+// that commit. Returns ("", nil) for a root commit; pass the result as from to
+// the range functions, which treat "" as the empty tree.
+func Parent(repoPath, sha string) (string, error) {
+	out, err := runGit(repoPath, "rev-list", "--parents", "-n", "1", sha)
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(out)
+	if len(fields) < 2 {
+		return "", nil
+	}
+	return fields[1], nil
+}
+
+// DiffOptions controls the diffs produced by DiffStat and FullDiff.
+type DiffOptions struct {
+	// Exclude drops commits reachable from these refs. A range diff cannot
+	// leave out individual commits, so with exclusions the diff is instead
+	// built from the per-commit patches of the commits CommitLog would return.
+	Exclude []string
+
+	// Only restricts the diff to the patches of exactly these commits,
+	// ignoring the range; used for curated, non-contiguous commit lists.
+	Only []string
+
+	// Context is the number of context lines around each change (git diff
+	// -U). Negative values use git's default of three.
+	Context int
+	// FunctionContext shows the whole enclosing function as context (-W).
+	FunctionContext bool
+
+	// IgnoreWhitespace ignores whitespace when comparing lines (-w), so
+	// reformatted lines, and files with nothing but whitespace changes, drop
+	// out of both the stat and the full diff.
+	IgnoreWhitespace bool
+
+	// Paths, when non-nil, limits the diff to these files, taken literally.
+	Paths []string
+
+	// Omit leaves these files, taken literally, out of the diff and its
+	// stat entirely.
+	Omit []string
+
+	// NoDiff holds git pathspec patterns, such as "infra/*.tf", whose files
+	// are left out of FullDiff only. They still count in DiffStat, so the
+	// change is acknowledged without its content.
+	NoDiff []string
+
+	// WorkTree compares from with the working tree instead of with to,
+	// covering the staged and unstaged changes to tracked files but not
+	// untracked ones. With Staged it compares from with the index only, as
+	// git diff --cached does. Neither combines with Exclude or Only.
+	WorkTree bool
+	Staged   bool
+}
+
+// diffArgs returns the git arguments for a diff of from..to under opts,
+// starting with the subcommand and ending with the range.
+func diffArgs(from, to string, opts DiffOptions, extra ...string) []string {
+	if opts.IgnoreWhitespace {
+		extra = append(extra, "--ignore-all-space")
+	}
+	// The log forms pass --root so that a root commit's patch is included
+	// even when log.showRoot is off; diff covers it via the empty tree.
+	var args []string
+	if len(opts.Only) > 0 {
+		args = append([]string{"log", "--root", "--no-walk=unsorted", "--format="}, extra...)
+		return append(append(args, opts.Only...), pathspecs(opts.Paths)...)
+	}
+	if len(opts.Exclude) > 0 {
+		args = append([]string{"log", "--root", "--no-merges", "--format="}, extra...)
+	} else {
+		args = append([]string{"diff"}, extra...)
+	}
+	if len(opts.Exclude) > 0 {
+		args = append(args, logRange(from, to, opts.Exclude)...)
+	} else {
+		if from == "" {
+			from = emptyTreeSHA
+		}
+		switch {
+		case opts.WorkTree && opts.Staged:
+			args = append(args, "--cached", from)
+		case opts.WorkTree:
+			args = append(args, from)
+		default:
+			args = append(args, from+".."+to)
+		}
+	}
+	args = append(args, pathspecs(opts.Paths)...)
+	if len(opts.Omit) > 0 {
+		if opts.Paths == nil {
+			args = append(args, "--")
+		}
+		for _, p := range opts.Omit {
+			args = append(args, ":(exclude,literal)"+p)
+		}
+	}
+	return args
+}
+
+// pathspecs returns the trailing "-- <paths>" arguments for paths, matched
+// literally so that names with glob characters are not expanded.
+func pathspecs(paths []string) []string {
+	if paths == nil {
+		return nil
+	}
+	args := []string{"--"}
+	for _, p := range paths {
+		args = append(args, ":(literal)"+p)
+	}
+	return args
+}
+
+// ChangedFiles returns the paths of the files changed in from..to under
+// opts, one per file, in git's order.
+func ChangedFiles(repoPath, from, to string, opts DiffOptions) ([]string, error) {
+	out, err := runGit(repoPath, diffArgs(from, to, opts, "--name-only")...)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	var files []string
+	for _, f := range strings.Split(out, "\n") {
+		// The per-commit log forms list a file once per commit touching it.
+		if f != "" && !seen[f] {
+			seen[f] = true
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+// TreeFiles returns the paths of the entries directly in dir, a directory
+// relative to the repository root ("" for the root itself), in the tree of
+// rev. They include subdirectories. A dir that does not exist at rev has no
+// entries.
+func TreeFiles(repoPath, rev, dir string) ([]string, error) {
+	args := []string{"ls-tree", "--name-only", rev}
+	if dir != "" {
+		args = append(args, "--", dir+"/")
+	}
+	out, err := runGit(repoPath, args...)
+	if err != nil || out == "" {
+		return nil, err
+	}
 	return strings.Split(out, "\n"), nil
 }
 
+// FileAt returns the content of the file path, relative to the repository
+// root, in the tree of rev.
+func FileAt(repoPath, rev, path string) (string, error) {
+	return runGit(repoPath, "show", rev+":"+path)
+}
+
 // DiffStat returns the --stat output for from..to.
-// When from is empty, diffs from the empty tree (i.e. all content is "added").
-func DiffStat(repoPath, from, to string) (string, error) {
-	if from == "" {
-		from = emptyTreeSHA
-	}
-	return runGit(repoPath, "diff", "--stat", from+".."+to)
+// When from is empty, diffs from the empty tree (i.e. all content is "added"),
+// which covers the same changes as CommitLog with an empty from: everything
+// reachable from to, including the root commit.
+func DiffStat(repoPath, from, to string, opts DiffOptions) (string, error) {
+	return runGit(repoPath, diffArgs(from, to, opts, "--stat")...)
+}
+
+// DiffNumstat returns the --numstat output for from..to, the exact inserted
+// and deleted line counts of each file that DiffStat scales into a bar.
+func DiffNumstat(repoPath, from, to string, opts DiffOptions) (string, error) {
+	return runGit(repoPath, diffArgs(from, to, opts, "--numstat")...)
 }
 
 // FullDiff returns the full diff for from..to without ANSI color codes.
 // When from is empty, diffs from the empty tree.
-func FullDiff(repoPath, from, to string) (string, error) {
-	if from == "" {
-		from = emptyTreeSHA
+func FullDiff(repoPath, from, to string, opts DiffOptions) (string, error) {
+	extra := []string{"--no-color"}
+	if len(opts.Exclude) > 0 || len(opts.Only) > 0 {
+		extra = append(extra, "-p")
+	}
+	// Context options imply a patch, so they apply only here, not to DiffStat.
+	if opts.Context >= 0 {
+		extra = append(extra, fmt.Sprintf("-U%d", opts.Context))
+	}
+	if opts.FunctionContext {
+		extra = append(extra, "--function-context")
+	}
+	args := diffArgs(from, to, opts, extra...)
+	if len(opts.NoDiff) > 0 {
+		if opts.Paths == nil && len(opts.Omit) == 0 {
+			args = append(args, "--")
+		}
+		for _, p := range opts.NoDiff {
+			args = append(args, ":(exclude)"+p)
+		}
 	}
-	return runGit(repoPath, "diff", "--no-color", from+".."+to)
+	return runGit(repoPath, args...)
 }
 
-// Commit stages the given files and creates a commit with the provided message.
-func Commit(repoPath, message string, files ...string) error {
+// CommitFiles stages the given files and creates a commit with the provided
+// message.
+func CommitFiles(repoPath, message string, files ...string) error {
 	addArgs := append([]string{"add"}, files...)
 	if _, err := runGit(repoPath, addArgs...); err != nil {
 		return fmt.Errorf("staging files: %w", err)
@@ -87,15 +609,70 @@ func Commit(repoPath, message string, files ...string) error {
 	return nil
 }
 
-// CreateTag creates an annotated git tag at HEAD.
+// CreateTag creates an annotated git tag at HEAD. The message is passed on
+// stdin and kept verbatim, so multi-line markdown, including lines starting
+// with "#", survives unchanged.
 func CreateTag(repoPath, tag, message string) error {
-	_, err := runGit(repoPath, "tag", "-a", tag, "-m", message)
+	_, err := runGitInput(repoPath, message, "tag", "-a", "--cleanup=verbatim", "-F", "-", tag)
 	if err != nil {
 		return fmt.Errorf("creating tag %s: %w", tag, err)
 	}
 	return nil
 }
 
+// AddNote attaches message as a git note to object under the notes ref ref,
+// e.g. refs/notes/changelog; a bare name like "changelog" is taken as
+// refs/notes/changelog. It fails when object already has a note there. As
+// with CreateTag, the message is passed on stdin and "#" lines survive.
+func AddNote(repoPath, ref, object, message string) error {
+	return note(repoPath, ref, object, message, "add")
+}
+
+// ReplaceNote is AddNote that overwrites an existing note.
+func ReplaceNote(repoPath, ref, object, message string) error {
+	return note(repoPath, ref, object, message, "add", "-f")
+}
+
+// AppendNote adds message to the note of object under ref, after a blank
+// line, or creates the note as AddNote does when there is none yet.
+func AppendNote(repoPath, ref, object, message string) error {
+	return note(repoPath, ref, object, message, "append")
+}
+
+func note(repoPath, ref, object, message string, args ...string) error {
+	args = append(append([]string{"notes", "--ref", ref}, args...), "-F", "-", object)
+	if _, err := runGitInput(repoPath, message, args...); err != nil {
+		return fmt.Errorf("adding note to %s under %s: %w", object, ref, err)
+	}
+	return nil
+}
+
+// Tag describes a tag as stored in the repository.
+type Tag struct {
+	Object  string // full SHA the ref points at: the tag object, or the commit for a lightweight tag
+	Commit  string // full SHA of the tagged commit
+	Type    string // "tag" for an annotated tag, "commit" for a lightweight one
+	Message string // annotation without any signature or trailing newlines; the commit message for a lightweight tag
+}
+
+// LookupTag reads the tag named name. ok is false when there is no such tag.
+func LookupTag(repoPath, name string) (t Tag, ok bool, err error) {
+	out, err := runGit(repoPath, "for-each-ref", "--format=%(objecttype)%1f%(objectname)%1f%(*objectname)%1f%(contents:signature)%1f%(contents)", "refs/tags/"+name)
+	if err != nil || out == "" {
+		return Tag{}, false, err
+	}
+	f := strings.SplitN(out, "\x1f", 5)
+	if len(f) != 5 {
+		return Tag{}, false, fmt.Errorf("unexpected for-each-ref output for tag %s", name)
+	}
+	message := strings.TrimSuffix(f[4], f[3]) // a signed tag's signature follows the message
+	t = Tag{Type: f[0], Object: f[1], Commit: f[2], Message: strings.TrimRight(message, "\n")}
+	if t.Commit == "" {
+		t.Commit = t.Object
+	}
+	return t, true, nil
+}
+
 var changedLinesRe = regexp.MustCompile(`(\d+) insertion|(\d+) deletion`)
 
 // ParseTotalChangedLines extracts the total number of inserted + deleted lines
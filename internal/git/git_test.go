@@ -0,0 +1,368 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newRepo creates an empty repository in a temporary directory, with a git
+// identity and global config of its own so that the user's do not leak in.
+func newRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath(Binary); err != nil {
+		t.Skip("git is not installed")
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(home, ".gitconfig"))
+	for _, kv := range [][2]string{
+		{"GIT_AUTHOR_NAME", "Test"}, {"GIT_AUTHOR_EMAIL", "test@example.com"},
+		{"GIT_COMMITTER_NAME", "Test"}, {"GIT_COMMITTER_EMAIL", "test@example.com"},
+	} {
+		t.Setenv(kv[0], kv[1])
+	}
+	dir := t.TempDir()
+	if _, err := runGit(dir, "init", "-q", "-b", "main"); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// commitFile writes content to name in repo and commits it.
+func commitFile(t *testing.T, repo, name, content, message string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(repo, name), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := CommitFiles(repo, message, name); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiffIgnoresUserConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		noColor bool
+	}{
+		{name: "default config"},
+		{name: "no prefix", config: "[diff]\n\tnoprefix = true\n"},
+		{name: "mnemonic prefix", config: "[diff]\n\tmnemonicPrefix = true\n"},
+		{name: "color always", config: "[color]\n\tui = always\n\tdiff = always\n"},
+		{name: "color always with NO_COLOR", config: "[color]\n\tui = always\n\tdiff = always\n", noColor: true},
+		{name: "pager", config: "[core]\n\tpager = sed s/^/paged:/\n[pager]\n\tdiff = true\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newRepo(t)
+			commitFile(t, repo, "a.txt", "one\n", "first")
+			commitFile(t, repo, "a.txt", "one\ntwo\n", "second")
+			if err := os.WriteFile(os.Getenv("GIT_CONFIG_GLOBAL"), []byte(tt.config), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if tt.noColor {
+				t.Setenv("NO_COLOR", "1")
+			}
+
+			diff, err := FullDiff(repo, "HEAD~1", "HEAD", DiffOptions{Context: -1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range []string{"diff --git a/a.txt b/a.txt\n", "--- a/a.txt\n", "+++ b/a.txt\n", "\n+two"} {
+				if !strings.Contains(diff, want) {
+					t.Errorf("FullDiff is missing %q:\n%s", want, diff)
+				}
+			}
+			stat, err := DiffStat(repo, "HEAD~1", "HEAD", DiffOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(stat, " a.txt | 1 +\n") {
+				t.Errorf("DiffStat = %q, want it to start with the plain a.txt line", stat)
+			}
+			for name, out := range map[string]string{"FullDiff": diff, "DiffStat": stat} {
+				if strings.Contains(out, "\x1b[") {
+					t.Errorf("%s has color codes: %q", name, out)
+				}
+				if strings.Contains(out, "paged:") {
+					t.Errorf("%s went through the pager: %q", name, out)
+				}
+			}
+		})
+	}
+}
+
+func TestSingleCommitWithoutTags(t *testing.T) {
+	repo := newRepo(t)
+	// An unrelated orphan branch, to exclude without excluding anything.
+	if _, err := runGit(repo, "commit", "-q", "--allow-empty", "-m", "other history"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runGit(repo, "branch", "-m", "other"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runGit(repo, "checkout", "-q", "--orphan", "main"); err != nil {
+		t.Fatal(err)
+	}
+	commitFile(t, repo, "a.txt", "hello\n", "feat: first")
+	sha, err := ResolveCommit(repo, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tag, err := LastReleaseTag(repo)
+	if err != nil || tag != "" {
+		t.Fatalf("LastReleaseTag = %q, %v; want no tag and no error", tag, err)
+	}
+	if parent, err := Parent(repo, sha); err != nil || parent != "" {
+		t.Errorf("Parent = %q, %v; want no parent and no error", parent, err)
+	}
+	commits, err := CommitLog(repo, "", "HEAD")
+	if err != nil || len(commits) != 1 || !strings.HasPrefix(sha, commits[0].SHA) {
+		t.Fatalf("CommitLog = %+v, %v; want the one commit", commits, err)
+	}
+
+	// Each way of building the diff covers the root commit's file.
+	for _, tc := range []struct {
+		name string
+		opts DiffOptions
+	}{
+		{"range", DiffOptions{Context: -1}},
+		{"exclude", DiffOptions{Context: -1, Exclude: []string{"other"}}},
+		{"only", DiffOptions{Context: -1, Only: []string{sha}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			stat, err := DiffStat(repo, "", "HEAD", tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(stat, "a.txt | 1 +") {
+				t.Errorf("DiffStat = %q, want the added a.txt", stat)
+			}
+			diff, err := FullDiff(repo, "", "HEAD", tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(diff, "+++ b/a.txt\n") || !strings.Contains(diff, "\n+hello") {
+				t.Errorf("FullDiff = %q, want the added a.txt", diff)
+			}
+		})
+	}
+}
+
+func TestCreateTagKeepsMessageVerbatim(t *testing.T) {
+	for _, tc := range []struct {
+		name, message string
+	}{
+		{"headings", "## [1.2.0] - 2026-01-02\n\n### Added\n\n- Paging cursor\n\n### Fixed\n\n- Empty input"},
+		{"hash at line start", "Release 1.2.0\n\n#123 is fixed\n# not a comment"},
+		{"blank lines and indentation", "Release 1.2.0\n\n\n\n  - indented\n\ttabbed  "},
+		{"scissors line", "Release 1.2.0\n\n# ------------------------ >8 ------------------------\nkept"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := newRepo(t)
+			commitFile(t, repo, "a.txt", "one\n", "first")
+			if err := CreateTag(repo, "v1.2.0", tc.message+"\n"); err != nil {
+				t.Fatal(err)
+			}
+
+			tag, ok, err := LookupTag(repo, "v1.2.0")
+			if err != nil || !ok {
+				t.Fatalf("LookupTag = %v, %v", ok, err)
+			}
+			if tag.Type != "tag" {
+				t.Errorf("tag type = %q, want an annotated tag", tag.Type)
+			}
+			if tag.Message != tc.message {
+				t.Errorf("LookupTag message = %q, want %q", tag.Message, tc.message)
+			}
+			if got, err := runGit(repo, "tag", "-l", "--format=%(contents)", "v1.2.0"); err != nil || got != tc.message {
+				t.Errorf("git tag --format=%%(contents) = %q, %v; want %q", got, err, tc.message)
+			}
+			listing, err := runGit(repo, "tag", "-n99", "v1.2.0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, line := range strings.Split(tc.message, "\n") {
+				if strings.HasPrefix(line, "#") && !strings.Contains(listing, line) {
+					t.Errorf("git tag -n99 is missing %q:\n%s", line, listing)
+				}
+			}
+		})
+	}
+}
+
+func TestNoAdviceHints(t *testing.T) {
+	repo := newRepo(t)
+	commitFile(t, repo, "a.txt", "one\n", "first")
+	commitFile(t, repo, "a.txt", "two\n", "second")
+	if err := CreateTag(repo, "v1.0.0", "Release 1.0.0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, ".gitignore"), []byte("*.log\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, "debug.log"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// A hook that is not executable is ignored with a hint.
+	if err := os.WriteFile(filepath.Join(repo, ".git", "hooks", "pre-commit"), []byte("#!/bin/sh\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The runner keeps stderr only when git fails, so record it through a
+	// wrapper, the way Binary allows.
+	git, err := exec.LookPath(Binary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	log := filepath.Join(dir, "stderr.log")
+	wrapper := filepath.Join(dir, "git")
+	script := "#!/bin/sh\n\"" + git + "\" \"$@\" 2>\"" + log + ".1\"\nstatus=$?\ncat \"" + log + ".1\" >>\"" + log + "\"\ncat \"" + log + ".1\" >&2\nexit $status\n"
+	if err := os.WriteFile(wrapper, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	defer func(b string) { Binary = b }(Binary)
+	Binary = wrapper
+
+	for _, tc := range []struct {
+		name    string
+		run     func() error
+		wantErr bool
+	}{
+		{"detached checkout", func() error { _, err := runGit(repo, "checkout", "HEAD~1"); return err }, false},
+		{"checkout back", func() error { _, err := runGit(repo, "checkout", "-q", "main"); return err }, false},
+		{"tag of a tag", func() error {
+			_, err := runGit(repo, "tag", "-a", "-m", "nested", "v1.0.0-nested", "v1.0.0")
+			return err
+		}, false},
+		{"ignored hook", func() error { return CommitFiles(repo, "third", ".gitignore") }, false},
+		{"ignored file", func() error { return CommitFiles(repo, "fourth", "debug.log") }, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := os.Truncate(log, 0); err != nil && !os.IsNotExist(err) {
+				t.Fatal(err)
+			}
+			err := tc.run()
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tc.wantErr)
+			}
+			stderr, _ := os.ReadFile(log)
+			// Advice either starts with "hint:" or, like the detached HEAD
+			// note, names the advice setting that turns it off.
+			for _, advice := range []string{"hint:", "advice."} {
+				if err != nil && strings.Contains(err.Error(), advice) {
+					t.Errorf("error has advice: %v", err)
+				}
+				if strings.Contains(string(stderr), advice) {
+					t.Errorf("stderr has advice:\n%s", stderr)
+				}
+			}
+		})
+	}
+}
+
+func TestAggregateStatCountsExactly(t *testing.T) {
+	repo := newRepo(t)
+	if err := os.Mkdir(filepath.Join(repo, "api"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	lines := func(prefix string, n int) string {
+		var sb strings.Builder
+		for i := range n {
+			fmt.Fprintf(&sb, "%s %d\n", prefix, i)
+		}
+		return sb.String()
+	}
+	commitFile(t, repo, "api/big.txt", lines("old", 300), "first")
+	commitFile(t, repo, "README", "one\n", "second")
+	// 250 lines replaced and 7 added: far beyond the width of the bar.
+	commitFile(t, repo, "api/big.txt", lines("old", 50)+lines("new", 257), "third")
+	commitFile(t, repo, "api/small.txt", "a\nb\n", "fourth")
+	if err := os.WriteFile(filepath.Join(repo, "logo.bin"), []byte{0, 1, 2, 0}, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	commitFile(t, repo, "README", "two\n", "fifth")
+	if err := CommitFiles(repo, "sixth", "logo.bin"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		opts DiffOptions
+	}{
+		{"range", DiffOptions{}},
+		{"per commit", DiffOptions{Exclude: []string{"HEAD~5"}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			stat, err := DiffStat(repo, "HEAD~4", "HEAD", tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			numstat, err := DiffNumstat(repo, "HEAD~4", "HEAD", tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := AggregateStat(stat, numstat)
+			for _, want := range []string{
+				" (root) | 2 file(s), +1 -1\n",
+				" api/   | 2 file(s), +259 -250\n",
+			} {
+				if !strings.Contains(got, want) {
+					t.Errorf("AggregateStat is missing %q:\n%s", want, got)
+				}
+			}
+			if total := ParseTotalChangedLines(got); total != ParseTotalChangedLines(stat) {
+				t.Errorf("ParseTotalChangedLines = %d, want %d as in the stat", total, ParseTotalChangedLines(stat))
+			}
+		})
+	}
+}
+
+func TestLastStableTag(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		setup func(t *testing.T, repo string)
+		want  string
+	}{
+		{"no tags", func(t *testing.T, repo string) {}, ""},
+		{"only pre-releases", func(t *testing.T, repo string) {
+			mustGit(t, repo, "tag", "v1.0.0-rc.1")
+		}, ""},
+		{"stable tag on another branch", func(t *testing.T, repo string) {
+			mustGit(t, repo, "checkout", "-q", "-b", "other")
+			commitFile(t, repo, "b.txt", "two\n", "second")
+			mustGit(t, repo, "tag", "v1.0.0")
+			mustGit(t, repo, "checkout", "-q", "main")
+			mustGit(t, repo, "tag", "v1.1.0-rc.1")
+		}, ""},
+		{"stable tag before a pre-release", func(t *testing.T, repo string) {
+			mustGit(t, repo, "tag", "v1.0.0")
+			commitFile(t, repo, "b.txt", "two\n", "second")
+			mustGit(t, repo, "tag", "v1.1.0-rc.1")
+		}, "v1.0.0"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := newRepo(t)
+			commitFile(t, repo, "a.txt", "one\n", "first")
+			tc.setup(t, repo)
+			if got, err := LastStableTag(repo); err != nil || got != tc.want {
+				t.Errorf("LastStableTag = %q, %v; want %q", got, err, tc.want)
+			}
+		})
+	}
+}
+
+// mustGit runs git with args in repo and fails the test if it fails.
+func mustGit(t *testing.T, repo string, args ...string) {
+	t.Helper()
+	if _, err := runGit(repo, args...); err != nil {
+		t.Fatal(err)
+	}
+}
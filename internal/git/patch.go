@@ -0,0 +1,216 @@
+package git
+
+import (
+	"fmt"
+	"mime"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// mboxFromRe matches the line git format-patch starts each message with.
+	mboxFromRe   = regexp.MustCompile(`^From ([0-9a-f]{40}) `)
+	patchTagRe   = regexp.MustCompile(`^\[[^\]]*\]\s*`)
+	hunkHeaderRe = regexp.MustCompile(`^@@ -\d+(?:,(\d+))? \+\d+(?:,(\d+))? @@`)
+)
+
+// ParsePatch reads a patch file: either git format-patch output, with one
+// mbox message per commit, or a plain unified diff. For an mbox it returns
+// one Commit per message, newest first as CommitLog lists them, taken from
+// its From, Date, and Subject headers and the message text above the "---"
+// line, and the diffs of all messages joined in order. A plain diff yields
+// no commits and the text as its diff.
+func ParsePatch(text string) (commits []Commit, diff string) {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	lines := strings.SplitAfter(text, "\n")
+
+	var messages [][]string
+	for _, line := range lines {
+		if mboxFromRe.MatchString(line) {
+			messages = append(messages, nil)
+		}
+		if len(messages) > 0 {
+			messages[len(messages)-1] = append(messages[len(messages)-1], line)
+		}
+	}
+	if len(messages) == 0 {
+		return nil, text
+	}
+
+	var diffs strings.Builder
+	for _, msg := range messages {
+		c, d := parseMessage(msg)
+		commits = append([]Commit{c}, commits...)
+		diffs.WriteString(d)
+	}
+	return commits, diffs.String()
+}
+
+// parseMessage splits one format-patch message into its commit and its diff.
+// The diff runs from the first "diff --git" line up to the "-- " line that
+// starts the signature.
+func parseMessage(msg []string) (Commit, string) {
+	var c Commit
+	c.SHA = mboxFromRe.FindStringSubmatch(msg[0])[1][:7]
+
+	// Headers, with folded continuation lines joined, up to the first blank line.
+	headers := map[string]string{}
+	var last string
+	i := 1
+	for ; i < len(msg); i++ {
+		line := strings.TrimRight(msg[i], "\n")
+		if line == "" {
+			i++
+			break
+		}
+		if (line[0] == ' ' || line[0] == '\t') && last != "" {
+			headers[last] += " " + strings.TrimSpace(line)
+			continue
+		}
+		if name, value, ok := strings.Cut(line, ":"); ok {
+			last = strings.ToLower(name)
+			headers[last] = strings.TrimSpace(value)
+		}
+	}
+
+	var dec mime.WordDecoder
+	decode := func(s string) string {
+		if d, err := dec.DecodeHeader(s); err == nil {
+			return d
+		}
+		return s
+	}
+	c.Subject = patchTagRe.ReplaceAllString(decode(headers["subject"]), "")
+	addr, err := mail.ParseAddress(headers["from"])
+	if err == nil {
+		c.Email = addr.Address
+	}
+	if err == nil && addr.Name != "" {
+		c.Author = addr.Name
+	} else {
+		c.Author = decode(headers["from"])
+	}
+	if t, err := mail.ParseDate(headers["date"]); err == nil {
+		c.Date = t.Format("2006-01-02")
+	}
+
+	var body, diff strings.Builder
+	inBody, inDiff := true, false
+	for _, line := range msg[i:] {
+		switch {
+		case inDiff && line == "-- \n":
+			inDiff = false
+		case inDiff:
+			diff.WriteString(line)
+		case strings.HasPrefix(line, "diff --git "):
+			inBody, inDiff = false, true
+			diff.WriteString(line)
+		case inBody && line == "---\n":
+			inBody = false // the diffstat follows
+		case inBody:
+			body.WriteString(line)
+		}
+	}
+	c.Body = strings.TrimSpace(body.String())
+	return c, diff.String()
+}
+
+// patchFileStat is the inserted and deleted line count of a file in a patch.
+type patchFileStat struct {
+	name     string
+	ins, del int
+}
+
+// PatchStat summarizes a unified diff in the layout of git diff --stat: one
+// line per file with its inserted plus deleted line count, then the totals
+// line that ParseTotalChangedLines reads.
+func PatchStat(diff string) string {
+	files := patchFileStats(diff)
+	var sb strings.Builder
+	width := 0
+	for _, f := range files {
+		width = max(width, len(f.name))
+	}
+	ins, del := 0, 0
+	for _, f := range files {
+		fmt.Fprintf(&sb, " %-*s | %d %s%s\n", width, f.name, f.ins+f.del, strings.Repeat("+", min(f.ins, 40)), strings.Repeat("-", min(f.del, 40)))
+		ins += f.ins
+		del += f.del
+	}
+	fmt.Fprintf(&sb, " %d files changed, %d insertions(+), %d deletions(-)", len(files), ins, del)
+	return sb.String()
+}
+
+// PatchNumstat summarizes a unified diff in the layout of git diff
+// --numstat, for AggregateStat.
+func PatchNumstat(diff string) string {
+	var sb strings.Builder
+	for _, f := range patchFileStats(diff) {
+		fmt.Fprintf(&sb, "%d\t%d\t%s\n", f.ins, f.del, f.name)
+	}
+	return sb.String()
+}
+
+// patchFileStats counts the inserted and deleted lines of each file in diff.
+func patchFileStats(diff string) []*patchFileStat {
+	var files []*patchFileStat
+	cur := func() *patchFileStat {
+		if len(files) == 0 {
+			files = append(files, &patchFileStat{name: "(unknown)"})
+		}
+		return files[len(files)-1]
+	}
+
+	oldLeft, newLeft := 0, 0 // lines remaining in the current hunk
+	for _, line := range strings.Split(diff, "\n") {
+		if oldLeft > 0 || newLeft > 0 {
+			switch {
+			case strings.HasPrefix(line, "+"):
+				cur().ins++
+				newLeft--
+			case strings.HasPrefix(line, "-"):
+				cur().del++
+				oldLeft--
+			case strings.HasPrefix(line, `\`):
+				// "\ No newline at end of file"
+			default:
+				oldLeft--
+				newLeft--
+			}
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			name := line[len("diff --git "):]
+			if i := strings.LastIndex(name, " b/"); i != -1 {
+				name = name[i+3:]
+			}
+			files = append(files, &patchFileStat{name: name})
+		case strings.HasPrefix(line, "+++ "):
+			name, _, _ := strings.Cut(line[4:], "\t")
+			name = strings.TrimPrefix(name, "b/")
+			if len(files) == 0 || files[len(files)-1].ins+files[len(files)-1].del > 0 {
+				files = append(files, &patchFileStat{name: name})
+			} else if name != "/dev/null" {
+				files[len(files)-1].name = name
+			}
+		default:
+			if m := hunkHeaderRe.FindStringSubmatch(line); m != nil {
+				oldLeft, newLeft = hunkLen(m[1]), hunkLen(m[2])
+			}
+		}
+	}
+	return files
+}
+
+// hunkLen parses the line count of a hunk header range, which is 1 when
+// omitted.
+func hunkLen(s string) int {
+	if s == "" {
+		return 1
+	}
+	n, _ := strconv.Atoi(s)
+	return n
+}
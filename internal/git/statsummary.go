@@ -0,0 +1,101 @@
+package git
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// statFileRe matches a per-file line of git diff --stat: the path, then
+	// either the changed line count and its +/- bar, or "Bin" for a binary
+	// file.
+	statFileRe = regexp.MustCompile(`^ (.+?) +\| +(?:(\d+) ?(\+*)(-*)|Bin .*)$`)
+	// statRenameRe matches the "{old => new}" part of a renamed path.
+	statRenameRe = regexp.MustCompile(`\{[^{}]* => ([^{}]*)\}`)
+)
+
+// AggregateStat rolls the changes of a range up into one line per top-level
+// directory with its file count, insertions, and deletions, for ranges whose
+// per-file stat would not fit in the prompt. The counts come from numstat,
+// the output of DiffNumstat, as the bar of the --stat output is scaled down
+// for large files; binary files count as a file without lines. The totals
+// lines of stat, the output of DiffStat, are kept as they are, so
+// ParseTotalChangedLines reads the same count.
+func AggregateStat(stat, numstat string) string {
+	type dirStat struct {
+		files, ins, del int
+	}
+	dirs := map[string]*dirStat{}
+	seen := map[string]bool{}
+	for _, line := range strings.Split(strings.TrimRight(numstat, "\n"), "\n") {
+		ins, rest, ok := strings.Cut(line, "\t")
+		del, path, ok2 := strings.Cut(rest, "\t")
+		if !ok || !ok2 {
+			continue
+		}
+		path = statPath(path)
+		dir := topLevelDir(path)
+		d := dirs[dir]
+		if d == nil {
+			d = &dirStat{}
+			dirs[dir] = d
+		}
+		// The per-commit log forms list a file once per commit touching it.
+		if !seen[path] {
+			seen[path] = true
+			d.files++
+		}
+		// Binary files have "-" for both counts.
+		n, _ := strconv.Atoi(ins)
+		d.ins += n
+		n, _ = strconv.Atoi(del)
+		d.del += n
+	}
+	var totals []string
+	for _, line := range strings.Split(strings.TrimRight(stat, "\n"), "\n") {
+		if statFileRe.MatchString(line) || strings.TrimSpace(line) == "" {
+			continue
+		}
+		totals = append(totals, line)
+	}
+
+	names := make([]string, 0, len(dirs))
+	width := 0
+	for name := range dirs {
+		names = append(names, name)
+		width = max(width, len(statDirLabel(name)))
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, " (per-file stat summarized by top-level directory)\n")
+	for _, name := range names {
+		d := dirs[name]
+		fmt.Fprintf(&sb, " %-*s | %d file(s), +%d -%d\n", width, statDirLabel(name), d.files, d.ins, d.del)
+	}
+	for _, line := range totals {
+		sb.WriteString(line + "\n")
+	}
+	return sb.String()
+}
+
+// statPath returns the new path of a --stat or --numstat path, which for a rename is
+// "old => new" or "dir/{old => new}/file".
+func statPath(p string) string {
+	p = statRenameRe.ReplaceAllString(p, "$1")
+	if _, after, ok := strings.Cut(p, " => "); ok {
+		p = after
+	}
+	return strings.ReplaceAll(p, "//", "/")
+}
+
+// statDirLabel names a directory in an aggregated stat.
+func statDirLabel(dir string) string {
+	if dir == "" {
+		return "(root)"
+	}
+	return dir + "/"
+}
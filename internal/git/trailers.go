@@ -0,0 +1,48 @@
+package git
+
+import (
+	"regexp"
+	"strings"
+)
+
+// trailerRe matches the first line of a trailer, "Key: value", capturing the
+// key and the value. Keys are a word of letters, digits, and dashes.
+var trailerRe = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9-]*):\s*(.*)$`)
+
+// Trailer returns the values of the trailers named key, compared ignoring
+// case, in the message body of a commit, in order. As with git
+// interpret-trailers, the trailers are the last paragraph of the body, when
+// every line of it is a trailer or continues one; a continuation line is
+// indented, and joins the value on a new line with its indentation removed.
+func Trailer(body, key string) []string {
+	paragraphs := strings.Split(strings.TrimSpace(strings.ReplaceAll(body, "\r\n", "\n")), "\n\n")
+	last := paragraphs[len(paragraphs)-1]
+	if last == "" {
+		return nil
+	}
+
+	type trailer struct{ key, value string }
+	var trailers []trailer
+	for _, line := range strings.Split(last, "\n") {
+		if line != "" && (line[0] == ' ' || line[0] == '\t') && len(trailers) > 0 {
+			t := &trailers[len(trailers)-1]
+			t.value += "\n" + strings.TrimSpace(line)
+			continue
+		}
+		m := trailerRe.FindStringSubmatch(strings.TrimRight(line, " \t"))
+		if m == nil {
+			return nil // not a trailer block
+		}
+		trailers = append(trailers, trailer{m[1], m[2]})
+	}
+
+	var values []string
+	for _, t := range trailers {
+		if strings.EqualFold(t.key, key) {
+			if v := strings.TrimSpace(t.value); v != "" {
+				values = append(values, v)
+			}
+		}
+	}
+	return values
+}
@@ -0,0 +1,417 @@
+// Package goapi compares the exported API of the Go packages in a repository
+// between two revisions, so that removed and incompatibly changed symbols
+// reach the changelog as facts rather than guesses from the diff.
+package goapi
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/build/constraint"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/nealwashere/ai-changelog-generator/internal/git"
+)
+
+// Change kinds.
+const (
+	Removed      = "removed"
+	Changed      = "changed"
+	AddedToIface = "added to interface" // implementations outside the package break
+)
+
+// Change is one incompatible change to an exported symbol.
+type Change struct {
+	Kind    string // Removed, Changed, or AddedToIface
+	Package string // import path of the package
+	Symbol  string // e.g. "Client", "Client.Do", or "Client.Timeout"; empty for a whole package
+	Old     string // declaration at the old revision; empty for AddedToIface
+	New     string // declaration at the new revision; empty for Removed
+}
+
+// String describes c on one line, for the prompt.
+func (c Change) String() string {
+	name := c.Package + "." + c.Symbol
+	switch {
+	case c.Kind == Removed && c.Symbol == "":
+		return fmt.Sprintf("removed: package `%s`, with all of its exported API", c.Package)
+	case c.Kind == Removed:
+		return fmt.Sprintf("removed: `%s` (was `%s`)", name, c.Old)
+	case c.Kind == AddedToIface:
+		return fmt.Sprintf("added to interface: `%s` (`%s`); types implementing it elsewhere must add it", name, c.New)
+	}
+	return fmt.Sprintf("changed: `%s` from `%s` to `%s`", name, c.Old, c.New)
+}
+
+// Diff returns the incompatible changes to the exported API of the Go
+// packages whose files changed between from and to in repo, sorted by
+// package and symbol. Test files, package main, and packages under internal,
+// testdata, or vendor directories are not public API and are skipped, as
+// are files that do not parse or carry a "//go:build ignore" constraint.
+// Additions are compatible and not reported, except for methods added to an
+// interface.
+func Diff(repo, from, to string) ([]Change, error) {
+	files, err := git.ChangedFiles(repo, from, to, git.DiffOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("listing changed files: %w", err)
+	}
+	dirs := map[string]bool{}
+	for _, f := range files {
+		if strings.HasSuffix(f, ".go") && !strings.HasSuffix(f, "_test.go") && public(path.Dir(f)) {
+			dirs[path.Dir(f)] = true
+		}
+	}
+	if len(dirs) == 0 {
+		return nil, nil
+	}
+
+	module := modulePath(repo, to)
+	var changes []Change
+	for _, dir := range sortedKeys(dirs) {
+		oldAPI, err := packageAPI(repo, from, dir)
+		if err != nil {
+			return nil, err
+		}
+		newAPI, err := packageAPI(repo, to, dir)
+		if err != nil {
+			return nil, err
+		}
+		importPath := module
+		if dir != "." {
+			importPath = path.Join(module, dir)
+		}
+		changes = append(changes, compare(importPath, oldAPI, newAPI)...)
+	}
+	return changes, nil
+}
+
+// public reports whether dir, a slash-separated directory relative to the
+// repository root, can hold a package that other modules import.
+func public(dir string) bool {
+	for _, elem := range strings.Split(dir, "/") {
+		switch {
+		case elem == "internal", elem == "testdata", elem == "vendor":
+			return false
+		case strings.HasPrefix(elem, "."), strings.HasPrefix(elem, "_"):
+			return dir == "."
+		}
+	}
+	return true
+}
+
+// modulePath returns the module path declared by the go.mod at the root of
+// repo at rev, or "." when there is none, so that symbols are still named by
+// their directory.
+func modulePath(repo, rev string) string {
+	src, err := git.FileAt(repo, rev, "go.mod")
+	if err != nil {
+		return "."
+	}
+	for _, line := range strings.Split(src, "\n") {
+		if rest, ok := strings.CutPrefix(strings.TrimSpace(line), "module "); ok {
+			return strings.Trim(strings.TrimSpace(rest), `"`)
+		}
+	}
+	return "."
+}
+
+// api maps each exported symbol of a package to its declaration, with
+// parameter names and formatting normalized away. Interfaces lists the
+// symbols that are interface types.
+type api struct {
+	decls      map[string]string
+	interfaces map[string]bool
+}
+
+// packageAPI reads the exported API of the package in dir at rev. A package
+// main, or a dir without Go files, has none.
+func packageAPI(repo, rev, dir string) (api, error) {
+	a := api{decls: map[string]string{}, interfaces: map[string]bool{}}
+	treeDir := dir
+	if dir == "." {
+		treeDir = ""
+	}
+	entries, err := git.TreeFiles(repo, rev, treeDir)
+	if err != nil {
+		return a, fmt.Errorf("listing %s at %s: %w", dir, rev, err)
+	}
+	sort.Strings(entries)
+
+	fset := token.NewFileSet()
+	pkg := ""
+	for _, name := range entries {
+		if !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		src, err := git.FileAt(repo, rev, name)
+		if err != nil {
+			continue // a submodule or a directory named like a Go file
+		}
+		f, err := parser.ParseFile(fset, name, src, parser.ParseComments|parser.SkipObjectResolution)
+		if err != nil || buildIgnored(f) {
+			continue
+		}
+		// Files of another package, such as a documentation-only
+		// "//go:build ignore" program, do not belong to the API. Those are
+		// skipped above, so that one sorting first cannot claim the package.
+		if pkg == "" {
+			pkg = f.Name.Name
+		}
+		if f.Name.Name != pkg || pkg == "main" {
+			continue
+		}
+		for _, d := range f.Decls {
+			addDecl(a, fset, d)
+		}
+	}
+	return a, nil
+}
+
+// buildIgnored reports whether f is kept out of every build by a build
+// constraint on the "ignore" tag, as generators run with go run are. Other
+// constraints, such as an operating system, leave the file in the API.
+func buildIgnored(f *ast.File) bool {
+	for _, g := range f.Comments {
+		if g.Pos() > f.Package {
+			break
+		}
+		for _, c := range g.List {
+			if !constraint.IsGoBuild(c.Text) && !constraint.IsPlusBuild(c.Text) {
+				continue
+			}
+			expr, err := constraint.Parse(c.Text)
+			if err != nil {
+				continue
+			}
+			if hasTag(expr, "ignore") && !expr.Eval(func(tag string) bool { return tag != "ignore" }) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasTag reports whether the build constraint x refers to tag.
+func hasTag(x constraint.Expr, tag string) bool {
+	switch x := x.(type) {
+	case *constraint.TagExpr:
+		return x.Tag == tag
+	case *constraint.NotExpr:
+		return hasTag(x.X, tag)
+	case *constraint.AndExpr:
+		return hasTag(x.X, tag) || hasTag(x.Y, tag)
+	case *constraint.OrExpr:
+		return hasTag(x.X, tag) || hasTag(x.Y, tag)
+	}
+	return false
+}
+
+// addDecl records the exported symbols that d declares. Where build
+// constraints give a symbol several declarations, the first file wins.
+func addDecl(a api, fset *token.FileSet, d ast.Decl) {
+	set := func(key, decl string) {
+		if _, ok := a.decls[key]; !ok {
+			a.decls[key] = decl
+		}
+	}
+	switch d := d.(type) {
+	case *ast.FuncDecl:
+		if !d.Name.IsExported() {
+			return
+		}
+		if d.Recv == nil {
+			set(d.Name.Name, "func "+d.Name.Name+typeParams(fset, d.Type.TypeParams)+signature(fset, d.Type))
+			return
+		}
+		recv, ptr := receiver(d.Recv.List[0].Type)
+		if !ast.IsExported(recv) {
+			return
+		}
+		set(recv+"."+d.Name.Name, "func ("+ptr+recv+") "+d.Name.Name+signature(fset, d.Type))
+	case *ast.GenDecl:
+		for _, spec := range d.Specs {
+			switch s := spec.(type) {
+			case *ast.TypeSpec:
+				if s.Name.IsExported() {
+					addType(a, fset, s, set)
+				}
+			case *ast.ValueSpec:
+				for _, n := range s.Names {
+					if !n.IsExported() {
+						continue
+					}
+					decl := d.Tok.String() + " " + n.Name
+					if s.Type != nil {
+						decl += " " + expr(fset, s.Type)
+					}
+					set(n.Name, decl)
+				}
+			}
+		}
+	}
+}
+
+// addType records the exported type s and its exported fields or methods.
+func addType(a api, fset *token.FileSet, s *ast.TypeSpec, set func(key, decl string)) {
+	name := s.Name.Name
+	head := "type " + name + typeParams(fset, s.TypeParams)
+	switch t := s.Type.(type) {
+	case *ast.StructType:
+		set(name, head+" struct")
+		for _, f := range t.Fields.List {
+			typ := expr(fset, f.Type)
+			if len(f.Names) == 0 { // embedded
+				embedded, _ := receiver(f.Type)
+				if ast.IsExported(embedded) {
+					set(name+"."+embedded, "embedded "+typ)
+				}
+			}
+			for _, n := range f.Names {
+				if n.IsExported() {
+					set(name+"."+n.Name, "field "+n.Name+" "+typ)
+				}
+			}
+		}
+	case *ast.InterfaceType:
+		set(name, head+" interface")
+		a.interfaces[name] = true
+		for _, m := range t.Methods.List {
+			if len(m.Names) == 0 { // embedded interface or type constraint
+				set(name+"."+expr(fset, m.Type), "embedded "+expr(fset, m.Type))
+				continue
+			}
+			ft, ok := m.Type.(*ast.FuncType)
+			for _, n := range m.Names {
+				if ok {
+					set(name+"."+n.Name, "method "+n.Name+signature(fset, ft))
+				}
+			}
+		}
+	default:
+		if s.Assign.IsValid() {
+			set(name, head+" = "+expr(fset, s.Type))
+		} else {
+			set(name, head+" "+expr(fset, s.Type))
+		}
+	}
+}
+
+// compare returns the incompatible differences from old to new in the
+// package importPath.
+func compare(importPath string, old, new api) []Change {
+	var changes []Change
+	if len(old.decls) > 0 && len(new.decls) == 0 {
+		return []Change{{Kind: Removed, Package: importPath}}
+	}
+	for _, key := range sortedKeys(old.decls) {
+		n, ok := new.decls[key]
+		switch {
+		case !ok:
+			if parent, _, isMember := strings.Cut(key, "."); isMember {
+				if _, ok := new.decls[parent]; !ok {
+					continue // reported with its type
+				}
+			}
+			changes = append(changes, Change{Kind: Removed, Package: importPath, Symbol: key, Old: old.decls[key]})
+		case strings.Replace(old.decls[key], "func (*", "func (", 1) == n:
+			// A pointer receiver became a value receiver, which only adds
+			// the method to the value's method set.
+		case n != old.decls[key]:
+			changes = append(changes, Change{Kind: Changed, Package: importPath, Symbol: key, Old: old.decls[key], New: n})
+		}
+	}
+	for _, key := range sortedKeys(new.decls) {
+		parent, _, isMember := strings.Cut(key, ".")
+		if _, existed := old.decls[key]; existed || !isMember || !old.interfaces[parent] || !new.interfaces[parent] {
+			continue
+		}
+		changes = append(changes, Change{Kind: AddedToIface, Package: importPath, Symbol: key, New: new.decls[key]})
+	}
+	return changes
+}
+
+// receiver returns the type name of a method receiver or embedded field,
+// without type arguments, and "*" when it is a pointer.
+func receiver(e ast.Expr) (name, ptr string) {
+	if star, ok := e.(*ast.StarExpr); ok {
+		ptr, e = "*", star.X
+	}
+	switch t := e.(type) {
+	case *ast.IndexExpr:
+		e = t.X
+	case *ast.IndexListExpr:
+		e = t.X
+	}
+	switch t := e.(type) {
+	case *ast.Ident:
+		return t.Name, ptr
+	case *ast.SelectorExpr:
+		return t.Sel.Name, ptr
+	}
+	return "", ptr
+}
+
+// signature formats the parameter and result types of ft without their
+// names, which callers do not depend on: "(int, ...string) (bool, error)".
+func signature(fset *token.FileSet, ft *ast.FuncType) string {
+	s := "(" + strings.Join(fieldTypes(fset, ft.Params), ", ") + ")"
+	if results := fieldTypes(fset, ft.Results); len(results) == 1 {
+		s += " " + results[0]
+	} else if len(results) > 1 {
+		s += " (" + strings.Join(results, ", ") + ")"
+	}
+	return s
+}
+
+// typeParams formats a type parameter list, "[K comparable, V any]", or ""
+// when there is none.
+func typeParams(fset *token.FileSet, fl *ast.FieldList) string {
+	if fl == nil || len(fl.List) == 0 {
+		return ""
+	}
+	var params []string
+	for _, f := range fl.List {
+		for _, n := range f.Names {
+			params = append(params, n.Name+" "+expr(fset, f.Type))
+		}
+	}
+	return "[" + strings.Join(params, ", ") + "]"
+}
+
+// fieldTypes lists the type of each parameter in fl, once per name.
+func fieldTypes(fset *token.FileSet, fl *ast.FieldList) []string {
+	if fl == nil {
+		return nil
+	}
+	var types []string
+	for _, f := range fl.List {
+		t := expr(fset, f.Type)
+		for range max(len(f.Names), 1) {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+// expr prints e on a single line.
+func expr(fset *token.FileSet, e ast.Expr) string {
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, fset, e); err != nil {
+		return "?"
+	}
+	return strings.Join(strings.Fields(buf.String()), " ")
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,91 @@
+package goapi
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/nealwashere/ai-changelog-generator/internal/git"
+)
+
+// newRepo creates an empty repository in a temporary directory, with a git
+// identity and global config of its own so that the user's do not leak in.
+func newRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath(git.Binary); err != nil {
+		t.Skip("git is not installed")
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(home, ".gitconfig"))
+	for _, kv := range [][2]string{
+		{"GIT_AUTHOR_NAME", "Test"}, {"GIT_AUTHOR_EMAIL", "test@example.com"},
+		{"GIT_COMMITTER_NAME", "Test"}, {"GIT_COMMITTER_EMAIL", "test@example.com"},
+	} {
+		t.Setenv(kv[0], kv[1])
+	}
+	dir := t.TempDir()
+	cmd := exec.Command(git.Binary, "init", "-q", "-b", "main")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v\n%s", err, out)
+	}
+	return dir
+}
+
+// commitFiles writes files, a map of slash-separated paths to contents, into
+// repo and commits them, returning the new commit.
+func commitFiles(t *testing.T, repo string, files map[string]string) string {
+	t.Helper()
+	var names []string
+	for name, content := range files {
+		path := filepath.Join(repo, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	if err := git.CommitFiles(repo, "update", names...); err != nil {
+		t.Fatal(err)
+	}
+	sha, err := git.ResolveCommit(repo, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sha
+}
+
+func TestDiffSkipsBuildIgnoredFiles(t *testing.T) {
+	repo := newRepo(t)
+	// gen.go sorts before the package's own files and is a package main
+	// run with go run; it must not hide the package's API.
+	from := commitFiles(t, repo, map[string]string{
+		"go.mod":      "module example.com/widget\n",
+		"lib/gen.go":  "//go:build ignore\n\npackage main\n\nfunc main() {}\n",
+		"lib/lib.go":  "package lib\n\nfunc Open(name string) error { return nil }\n\nfunc Close() {}\n",
+		"lib/unix.go": "//go:build !windows\n\npackage lib\n\nfunc Sync() {}\n",
+	})
+	to := commitFiles(t, repo, map[string]string{
+		"lib/lib.go":  "package lib\n\nfunc Open(name string, flags int) error { return nil }\n",
+		"lib/unix.go": "//go:build !windows\n\npackage lib\n",
+	})
+
+	changes, err := Diff(repo, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"Close": Removed, "Open": Changed, "Sync": Removed}
+	if len(changes) != len(want) {
+		t.Fatalf("Diff = %v, want changes to %v", changes, want)
+	}
+	for _, c := range changes {
+		if c.Package != "example.com/widget/lib" || want[c.Symbol] != c.Kind {
+			t.Errorf("unexpected change %s", c)
+		}
+	}
+}
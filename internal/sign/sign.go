@@ -0,0 +1,88 @@
+// Package sign makes detached signatures of release files with external
+// signing tools, so that published release notes can be verified.
+package sign
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// A Signer writes a detached signature of a file next to it.
+type Signer interface {
+	// Name is the signing tool, e.g. "minisign", for messages.
+	Name() string
+	// Sign signs the file at path and returns the path of the signature,
+	// path with ".sig" appended.
+	Sign(path string) (string, error)
+}
+
+// New returns the signer called name, "minisign" or "cosign", using the
+// secret key in keyFile; an empty keyFile is the tool's default key, or for
+// cosign keyless signing. It fails when the tool is not installed.
+func New(name, keyFile string) (Signer, error) {
+	var s Signer
+	switch name {
+	case "minisign":
+		s = Minisign{Key: keyFile}
+	case "cosign":
+		s = Cosign{Key: keyFile}
+	default:
+		return nil, fmt.Errorf("unknown signer %q (want minisign or cosign)", name)
+	}
+	if _, err := exec.LookPath(name); err != nil {
+		return nil, fmt.Errorf("%s is not installed: %w", name, err)
+	}
+	return s, nil
+}
+
+// Minisign signs with minisign (https://jedisct1.github.io/minisign/). A
+// password-protected key is asked for on the terminal; unattended runs need
+// a key created without one (minisign -G -W).
+type Minisign struct {
+	Key string // secret key file; empty uses ~/.minisign/minisign.key
+}
+
+func (Minisign) Name() string { return "minisign" }
+
+func (m Minisign) Sign(path string) (string, error) {
+	sig := path + ".sig"
+	args := []string{"-S", "-m", path, "-x", sig}
+	if m.Key != "" {
+		args = append(args, "-s", m.Key)
+	}
+	return sig, run("minisign", args...)
+}
+
+// Cosign signs with sigstore's cosign (https://docs.sigstore.dev/). Without
+// a key it signs keylessly, which needs an OIDC identity, such as the one a
+// CI provider offers, and records the signature in the public transparency
+// log.
+type Cosign struct {
+	Key string // private key file or KMS URI; empty signs keylessly
+}
+
+func (Cosign) Name() string { return "cosign" }
+
+func (c Cosign) Sign(path string) (string, error) {
+	sig := path + ".sig"
+	args := []string{"sign-blob", "--yes", "--output-signature", sig}
+	if c.Key != "" {
+		args = append(args, "--key", c.Key)
+	}
+	return sig, run("cosign", append(args, path)...)
+}
+
+// run runs a signing tool attached to the terminal, so that it can ask for
+// a key password. Its output goes to stderr, keeping stdout for the
+// changelog.
+func run(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("signing with %s: %w", name, err)
+	}
+	return nil
+}
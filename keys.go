@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// apiKeys returns the keys given with --api-keys and --api-keys-file, in
+// order and without duplicates: comma-separated in the flag, one per line in
+// the file, where blank lines and #-comments are ignored.
+func apiKeys(cfg config) ([]string, error) {
+	var keys []string
+	seen := map[string]bool{}
+	add := func(k string) {
+		if k = strings.TrimSpace(k); k != "" && !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+
+	for _, k := range strings.Split(cfg.APIKeys, ",") {
+		add(k)
+	}
+	if cfg.APIKeysFile != "" {
+		info, err := os.Stat(cfg.APIKeysFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading API keys file: %w", err)
+		}
+		if runtime.GOOS != "windows" && info.Mode().Perm()&0o077 != 0 {
+			fmt.Fprintf(os.Stderr, "warning: %s is readable by other users; restrict it with chmod 600\n", cfg.APIKeysFile)
+		}
+		data, err := os.ReadFile(cfg.APIKeysFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading API keys file: %w", err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if line = strings.TrimSpace(line); !strings.HasPrefix(line, "#") {
+				add(line)
+			}
+		}
+		if len(keys) == 0 {
+			return nil, fmt.Errorf("%s lists no API keys", cfg.APIKeysFile)
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/nealwashere/ai-changelog-generator/internal/forge"
+	"github.com/nealwashere/ai-changelog-generator/internal/git"
+)
+
+// issueLabels looks up the GitHub labels of the issues and pull requests that
+// commits reference as #N. Enrichment is optional, so every failure is
+// reported as a warning and yields whatever labels were fetched so far.
+func issueLabels(repo string, commits []git.Commit) map[int][]string {
+	url, err := git.RemoteURL(repo, "origin")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: skipping label enrichment: %v\n", err)
+		return nil
+	}
+	owner, name, ok := forge.ParseGitHubRemote(url)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "warning: skipping label enrichment: origin %s is not a GitHub remote\n", url)
+		return nil
+	}
+
+	var texts []string
+	for _, c := range commits {
+		texts = append(texts, c.Subject, c.Body)
+	}
+	refs := forge.IssueRefs(texts...)
+	if len(refs) == 0 {
+		return nil
+	}
+
+	gh := forge.NewGitHub(owner, name, os.Getenv("GITHUB_TOKEN"))
+	labels := map[int][]string{}
+	for _, n := range refs {
+		l, err := gh.Labels(n)
+		if errors.Is(err, forge.ErrUnavailable) {
+			fmt.Fprintf(os.Stderr, "warning: stopping label enrichment: %v\n", err)
+			break
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: labels for #%d: %v\n", n, err)
+			continue
+		}
+		if len(l) > 0 {
+			labels[n] = l
+		}
+	}
+	fmt.Fprintf(os.Stderr, "info: fetched labels for %d of %d referenced issue(s)\n", len(labels), len(refs))
+	return labels
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/nealwashere/ai-changelog-generator/internal/git"
+)
+
+// releaseLockName is the lock file, in the repository's git directory, that
+// keeps two releases of the same repository from running at once.
+const releaseLockName = "changelog-release.lock"
+
+// lockPollInterval is how often a waiting release retries the lock.
+const lockPollInterval = 500 * time.Millisecond
+
+// acquireReleaseLock creates the release lock of repo, waiting up to timeout
+// for another release to finish. The returned function removes the lock.
+func acquireReleaseLock(repo string, timeout time.Duration) (func(), error) {
+	dir, err := git.GitDir(repo)
+	if err != nil {
+		return nil, fmt.Errorf("locating git directory: %w", err)
+	}
+	path := filepath.Join(dir, releaseLockName)
+	deadline := time.Now().Add(timeout)
+	waiting := false
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			host, _ := os.Hostname()
+			fmt.Fprintf(f, "pid %d on %s since %s\n", os.Getpid(), host, time.Now().Format(time.RFC3339))
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("creating release lock %s: %w", path, err)
+		}
+		holder, _ := os.ReadFile(path)
+		if pid, ok := staleLock(string(holder)); ok {
+			retry, err := takeOverLock(path, string(holder), pid)
+			if err != nil {
+				return nil, err
+			}
+			if retry {
+				continue
+			}
+			// Another release is taking the lock over; wait for it.
+		}
+		if !time.Now().Before(deadline) {
+			return nil, fmt.Errorf("another release holds %s (%s); wait for it to finish, raise --lock-timeout, or delete the file if that process is gone", path, strings.TrimSpace(string(holder)))
+		}
+		if !waiting {
+			fmt.Fprintf(os.Stderr, "info: waiting up to %s for the release holding %s to finish\n", timeout, path)
+			waiting = true
+		}
+		time.Sleep(lockPollInterval)
+	}
+}
+
+// takeOverLock removes the release lock at path if it still holds holder,
+// the lock of pid, which is no longer running. Waiters that find the same
+// stale lock take turns through a second lock file, so that only one of them
+// removes it and none removes the lock the first then creates. It reports
+// whether the caller should try the lock again; false means another release
+// is taking it over.
+func takeOverLock(path, holder string, pid int) (bool, error) {
+	guard := path + ".takeover"
+	g, err := os.OpenFile(guard, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if errors.Is(err, os.ErrExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("creating %s: %w", guard, err)
+	}
+	g.Close()
+	defer os.Remove(guard)
+
+	// Another release may have taken over and created a lock of its own
+	// since holder was read.
+	if again, _ := os.ReadFile(path); string(again) != holder {
+		return true, nil
+	}
+	fmt.Fprintf(os.Stderr, "info: removing the release lock %s of pid %d, which is no longer running\n", path, pid)
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return false, fmt.Errorf("removing stale release lock %s: %w", path, err)
+	}
+	return true, nil
+}
+
+// staleLock reports whether holder, the content of a release lock, names a
+// process on this host that is no longer running, and returns its pid. A
+// lock taken on another host, over a shared file system, is never stale.
+func staleLock(holder string) (int, bool) {
+	var pid int
+	var host string
+	if _, err := fmt.Sscanf(holder, "pid %d on %s since", &pid, &host); err != nil || pid <= 0 {
+		return 0, false
+	}
+	if self, err := os.Hostname(); err != nil || host != self {
+		return 0, false
+	}
+	return pid, !processRunning(pid)
+}
+
+// processRunning reports whether the process pid exists.
+func processRunning(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false // Windows looks the process up
+	}
+	if runtime.GOOS == "windows" {
+		return true
+	}
+	// Signal 0 checks for the process without signalling it; EPERM means it
+	// exists but belongs to someone else.
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAcquireReleaseLockHeld(t *testing.T) {
+	// A process that has exited, for a pid that is no longer running.
+	done := exec.Command(os.Args[0], "-test.run=^$")
+	if err := done.Run(); err != nil {
+		t.Fatal(err)
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name    string
+		pid     int
+		host    string
+		wantErr bool
+	}{
+		{"running process", os.Getpid(), host, true},
+		{"exited process", done.Process.Pid, host, false},
+		{"other host", done.Process.Pid, host + "-other", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := newTestRepo(t)
+			path := filepath.Join(repo, ".git", releaseLockName)
+			holder := fmt.Sprintf("pid %d on %s since 2026-01-02T03:04:05Z\n", tc.pid, tc.host)
+			if err := os.WriteFile(path, []byte(holder), 0644); err != nil {
+				t.Fatal(err)
+			}
+			release, err := acquireReleaseLock(repo, 0)
+			if tc.wantErr {
+				if err == nil || !strings.Contains(err.Error(), path) {
+					t.Fatalf("acquireReleaseLock error = %v, want one naming %s", err, path)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer release()
+			if data, _ := os.ReadFile(path); !strings.HasPrefix(string(data), fmt.Sprintf("pid %d ", os.Getpid())) {
+				t.Errorf("lock holds %q, want this process", data)
+			}
+		})
+	}
+}
+
+func TestAcquireReleaseLockConcurrentTakeover(t *testing.T) {
+	done := exec.Command(os.Args[0], "-test.run=^$")
+	if err := done.Run(); err != nil {
+		t.Fatal(err)
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := newTestRepo(t)
+	path := filepath.Join(repo, ".git", releaseLockName)
+	holder := fmt.Sprintf("pid %d on %s since 2026-01-02T03:04:05Z\n", done.Process.Pid, host)
+	if err := os.WriteFile(path, []byte(holder), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every taker finds the same stale lock; each must still hold the lock
+	// alone.
+	const takers = 4
+	var holding, overlaps atomic.Int32
+	var wg sync.WaitGroup
+	errs := make(chan error, takers)
+	for range takers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := acquireReleaseLock(repo, 10*time.Second)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if holding.Add(1) > 1 {
+				overlaps.Add(1)
+			}
+			time.Sleep(20 * time.Millisecond)
+			holding.Add(-1)
+			release()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if n := overlaps.Load(); n > 0 {
+		t.Errorf("%d taker(s) held the lock at the same time as another", n)
+	}
+	if _, err := os.Stat(path + ".takeover"); !os.IsNotExist(err) {
+		t.Errorf("takeover guard left behind: %v", err)
+	}
+}
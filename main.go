@@ -1,190 +1,2352 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/nealwashere/ai-changelog-generator/internal/ai"
 	"github.com/nealwashere/ai-changelog-generator/internal/git"
+	"github.com/nealwashere/ai-changelog-generator/internal/goapi"
+	"github.com/nealwashere/ai-changelog-generator/internal/sign"
 )
 
 const defaultModel = "claude-sonnet-4-6"
 
 type config struct {
-	Repo    string
-	Model   string
-	Output  string
-	Version string
-	MaxDiff int
-	APIKey  string
+	Repo       string
+	Model      string
+	Output     string
+	Version    string
+	MaxDiff    int
+	APIKey     string
+	APIVersion string
+	LogFormat  string
+	MaxSubject int
+	Single     string
+	Not        stringList
+
+	FromFragments     string
+	DebugDir          string
+	Yes               bool
+	SignChangelog     string
+	SignKey           string
+	Order             string
+	GoAPIDiff         bool
+	HeaderFile        string
+	Repos             stringList
+	InsertMarker      string
+	AutoDeepen        bool
+	EnrichLabels      bool
+	Locales           stringList
+	TranslateHeadings bool
+	SortBullets       string
+	Accumulate        bool
+	GitBin            string
+	MaxContext        int
+	Headline          bool
+	DiffContext       int
+	FunctionContext   bool
+	CommitsFile       string
+	Style             string
+	Clipboard         bool
+	PostProcess       string
+	TagMessage        string
+	CommitTemplate    string
+	SinceTag          string
+	RequireBranch     bool
+	Scopes            string
+	Compact           bool
+	GitHubOutput      bool
+	IgnoreWhitespace  bool
+	ValidateFormat    bool
+	PreviousEntries   int
+	PrevTagNotes      bool
+	Seed              int64
+	CiteCommits       bool
+	CiteFormat        string
+	LockTimeout       time.Duration
+	TOC               bool
+	APIKeys           string
+	APIKeysFile       string
+	Explain           string
+	FixMarkdown       bool
+	Replay            string
+	GoldenTest        string
+	GoldenMock        bool
+	Provider          string
+	OutputDir         string
+	Promote           bool
+	StatDetails       bool
+	Theme             string
+	ThemeFile         string
+	AllowSections     stringList
+	AlwaysSections    stringList
+	EmptySectionText  string
+	Patch             string
+	MaxRetryWait      time.Duration
+	NoStream          bool
+	FullChangelogLink bool
+	VerifyTag         bool
+	MaxDiffPerDir     int
+	MaxStatLines      int
+	MaxChars          int
+	ChangelogDiff     bool
+	Versioning        string
+	Prerelease        string
+	PrereleaseEntries string
+	Profile           bool
+	NoDiffFor         stringList
+	UnreleasedLabel   string
+	SinceLastRun      bool
+	SinceMergeBase    string
+	WorkingTree       bool
+	Staged            bool
+	IncludeExt        stringList
+	GitNote           string
+	IgnoreAuthor      stringList
+	IgnoreBots        bool
+	IgnoredDiff       string
+	Plan              bool
+	Format            string
+	Formats           stringList
+	Provenance        bool
+	ReleaseDryRun     bool
+	VersionFrom       string
+	MaxParallelGit    int
+	PreferCommits     bool
+	PreferThreshold   int
+	GitNoteExisting   string
+	ExcludeExt        stringList
+	JiraBaseURL       string
+	SplitByTags       bool
+	UpgradeTrailer    string
+	JiraProjects      stringList
+
+	selected []string          // resolved --commits-file SHAs
+	allowed  []string          // resolved --allow-sections titles
+	always   []string          // resolved --always-sections titles
+	link     string            // the --full-changelog-link line
+	jiraKeys []string          // resolved --jira-projects keys
+	icons    map[string]string // resolved --theme section icons; nil for plain
+	signer   sign.Signer       // resolved --sign-changelog signer
+	formats  []string          // resolved --formats, the first also in Format
+	omit     []string          // files left out of the diff, e.g. the changelog when superseding
+	skip     []string          // full SHAs of commits left out of the log
+	GitEnv   stringList
+
+	CheckHallucinations bool
+	Strict              bool
+}
+
+// Exit codes, so scripts can tell failure kinds apart.
+const (
+	exitError      = 1 // anything not covered below
+	exitValidation = 2 // bad flags, version, or repo path
+	exitNoChanges  = 3 // nothing to generate a changelog for
+	exitAPI        = 4 // the model API failed
+	exitGit        = 5 // a git command failed
+)
+
+// generator is shared by every generation in a run, so that runs producing
+// several outputs (e.g. one per --locale) are paced by the API's rate limits.
+var generator ai.Generator
+
+// verbose enables verbosef output.
+var verbose bool
+
+// verbosef prints an info line to stderr when --verbose is set.
+func verbosef(format string, args ...any) {
+	if verbose {
+		fmt.Fprintf(os.Stderr, "info: "+format+"\n", args...)
+	}
+}
+
+// errNoChanges reports an empty release range.
+var errNoChanges = errors.New("no changes to describe")
+
+// validationError marks errors caused by invalid input rather than by git or
+// the API.
+type validationError struct{ err error }
+
+func (e *validationError) Error() string { return e.err.Error() }
+func (e *validationError) Unwrap() error { return e.err }
+
+// invalid marks err as a validation error.
+func invalid(err error) error { return &validationError{err} }
+
+// flagUse is an option by name and whether it is set, for conflicting.
+type flagUse struct {
+	set  bool
+	name string
+}
+
+// conflicting returns the names of the options in uses that are set, for a
+// mode to reject in one message.
+func conflicting(uses ...flagUse) []string {
+	var names []string
+	for _, u := range uses {
+		if u.set {
+			names = append(names, u.name)
+		}
+	}
+	return names
+}
+
+// rangeFlags lists the options that choose the range of history to describe
+// or write it as a release. Modes that read their changes from somewhere
+// other than the repository's history reject them all.
+func rangeFlags(cfg config) []flagUse {
+	return []flagUse{
+		{cfg.Version != "", "--version"},
+		{cfg.Single != "" || cfg.Accumulate, "--single/--accumulate"},
+		{cfg.FromFragments != "", "--from-fragments"},
+		{cfg.CommitsFile != "", "--commits-file"},
+		{cfg.SinceTag != "", "--since-tag"},
+		{cfg.SinceLastRun, "--since-last-run"},
+		{cfg.SinceMergeBase != "", "--since-merge-base"},
+	}
+}
+
+// diffFlags lists the options that shape the diff git produces. Modes that
+// take a diff as given reject them, so that content --no-diff-for is meant
+// to withhold is not sent after all.
+func diffFlags(cfg config) []flagUse {
+	return []flagUse{
+		{len(cfg.NoDiffFor) > 0, "--no-diff-for"},
+		{len(cfg.IncludeExt) > 0, "--include-ext"},
+		{len(cfg.ExcludeExt) > 0, "--exclude-ext"},
+		{cfg.MaxDiffPerDir > 0, "--max-diff-per-dir"},
+		{cfg.IgnoreWhitespace, "--ignore-whitespace"},
+		{cfg.DiffContext != 3, "--diff-context"},
+		{cfg.FunctionContext, "--function-context"},
+	}
+}
+
+// exitCode maps an error returned by run to the process exit code.
+func exitCode(err error) int {
+	var ve *validationError
+	var ae *ai.APIError
+	var ge *git.Error
+	switch {
+	case errors.As(err, &ve):
+		return exitValidation
+	case errors.Is(err, errNoChanges):
+		return exitNoChanges
+	case errors.As(err, &ae):
+		return exitAPI
+	case errors.As(err, &ge):
+		return exitGit
+	}
+	return exitError
+}
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(exitCode(err))
+	}
+}
+
+func run() error {
+	var cfg config
+
+	flag.StringVar(&cfg.Repo, "repo", ".", "Path to git repo")
+	flag.StringVar(&cfg.Repo, "r", ".", "Path to git repo (shorthand)")
+	flag.Var(&cfg.Repos, "repos", "Aggregate the changelog across this repo (repeatable; preview mode only)")
+	flag.StringVar(&cfg.Model, "model", defaultModel, "Anthropic model ID")
+	flag.StringVar(&cfg.Model, "m", defaultModel, "Anthropic model ID (shorthand)")
+	flag.StringVar(&cfg.Output, "output", "", "Output file path (default: stdout)")
+	flag.StringVar(&cfg.Output, "o", "", "Output file path (shorthand)")
+	flag.StringVar(&cfg.OutputDir, "output-dir", "", "Write output files under their conventional names (CHANGELOG.md, CHANGELOG.de.md, NEWS, ...) into this directory")
+	flag.StringVar(&cfg.Version, "version", "", "Release version (e.g. v1.2.0); updates CHANGELOG.md and creates a git tag")
+	flag.StringVar(&cfg.Version, "v", "", "Release version (shorthand)")
+	flag.StringVar(&cfg.VersionFrom, "version-from", "", "Read the release version from this file (VERSION, or a \"// +version\" comment in go.mod) instead of --version")
+	flag.StringVar(&cfg.GitBin, "git-bin", "", "git executable to run (default: $GIT_BINARY or git on PATH)")
+	flag.Var(&cfg.GitEnv, "git-env", "Extra KEY=VALUE environment entry for git commands (repeatable)")
+	flag.IntVar(&cfg.MaxDiff, "max-diff", 2000, "Line threshold for full diff inclusion")
+	flag.Var(&cfg.NoDiffFor, "no-diff-for", "Leave the diff content of files matching this git pathspec pattern out of the prompt; commits and stat still show them (repeatable)")
+	flag.BoolVar(&cfg.PreferCommits, "prefer-commits", false, "Leave out the full diff, even under --max-diff, when enough commits are descriptive conventional commits")
+	flag.IntVar(&cfg.PreferThreshold, "prefer-commits-threshold", 90, "Percentage of descriptive conventional commits at which --prefer-commits leaves out the full diff")
+	flag.IntVar(&cfg.MaxParallelGit, "max-parallel-git", 1, "Run up to this many independent git commands at once while gathering changes; 1 runs them one after another")
+	flag.IntVar(&cfg.MaxStatLines, "max-stat-lines", 1000, "Summarize the diff stat by top-level directory when it has more lines than this; 0 never summarizes")
+	flag.IntVar(&cfg.MaxDiffPerDir, "max-diff-per-dir", 0, "Cap the changed lines each top-level directory contributes to the full diff; 0 disables the cap")
+	flag.IntVar(&cfg.MaxContext, "max-context", 200000, "Model context window in tokens; prompts that don't fit are trimmed or rejected before sending")
+	flag.IntVar(&cfg.DiffContext, "diff-context", 3, "Lines of context around each change in the full diff (git diff -U)")
+	flag.BoolVar(&cfg.FunctionContext, "function-context", false, "Include the whole enclosing function as context in the full diff (git diff -W)")
+	flag.Var(&cfg.IncludeExt, "include-ext", `Limit the diff to files with these extensions, e.g. go,ts ("none" for files without one; repeatable)`)
+	flag.Var(&cfg.ExcludeExt, "exclude-ext", `Leave files with these extensions out of the diff, e.g. md,yaml ("none" for files without one; repeatable)`)
+	flag.BoolVar(&cfg.IgnoreWhitespace, "ignore-whitespace", false, "Ignore whitespace-only changes in the diff and the --max-diff line count (git diff -w)")
+	flag.StringVar(&cfg.Provider, "provider", "", "Model provider: anthropic, or fake for offline testing (default: $CHANGELOG_PROVIDER or anthropic)")
+	flag.StringVar(&cfg.APIKey, "api-key", "", "Anthropic API key (default: $ANTHROPIC_API_KEY)")
+	flag.StringVar(&cfg.APIKeys, "api-keys", "", "Comma-separated Anthropic API keys to rotate through round-robin, e.g. for long backfills")
+	flag.StringVar(&cfg.APIKeysFile, "api-keys-file", "", "File of Anthropic API keys to rotate through, one per line")
+	flag.StringVar(&cfg.APIVersion, "anthropic-version", "", "Override the anthropic-version API header (YYYY-MM-DD)")
+	flag.Int64Var(&cfg.Seed, "seed", 0, "Sampling seed for providers that support one; the Anthropic API does not, so it is ignored with a warning")
+	flag.StringVar(&cfg.LogFormat, "log-format", string(ai.LogOneline), "Commit detail in the prompt: oneline, with-author, with-date, full")
+	flag.IntVar(&cfg.MaxSubject, "max-subject-length", 200, "Truncate commit subjects longer than this many characters (0 disables)")
+	flag.StringVar(&cfg.Versioning, "versioning", string(schemeSemver), "Version scheme for --version validation: semver (v1.2.0) or calver (2026.02.0)")
+	flag.StringVar(&cfg.Prerelease, "prerelease", "", "With --version, release the next pre-release of it with this identifier, e.g. rc for v1.3.0-rc.1, -rc.2, ...")
+	flag.StringVar(&cfg.PrereleaseEntries, "prerelease-entries", "keep", "When releasing a final version after its pre-releases: keep their entries, or supersede them with one entry covering everything since the last final release")
+	flag.StringVar(&cfg.Style, "style", string(ai.StyleKeepAChangelog), "Entry format: keep-a-changelog (CHANGELOG.md) or news (GNU-style NEWS file of prose)")
+	flag.StringVar(&cfg.Format, "format", "markdown", "Preview output format: markdown, html for a fragment to embed in a page, or json")
+	flag.Var(&cfg.Formats, "formats", "Write the preview in each of these formats from one generation, e.g. md,html,json, one file each (repeatable)")
+	flag.BoolVar(&cfg.Plan, "plan", false, "Print what a run would cover (commits, changed lines, breaking changes, diff mode) and exit without calling the model")
+	flag.BoolVar(&cfg.Headline, "headline", false, "Print a one-sentence plain-text release summary instead of a changelog (preview only)")
+	flag.StringVar(&cfg.GitNote, "git-note", "", "With --version, attach the entry to the release commit as a git note under this ref (e.g. changelog) instead of updating the changelog file")
+	flag.StringVar(&cfg.GitNoteExisting, "git-note-existing", "error", "What --git-note does when the commit already has a note: error, append, or overwrite")
+	flag.BoolVar(&cfg.ReleaseDryRun, "release-dry-run", false, "With --version, generate the entry, print the changelog diff and the git commands a release would run, and change nothing")
+	flag.BoolVar(&cfg.ChangelogDiff, "changelog-diff", false, "With --version, print a unified diff of the changelog update instead of writing, committing, and tagging")
+	flag.BoolVar(&cfg.VerifyTag, "verify-tag", false, "After a release, check that the tag is annotated, carries the requested message, and points at the release commit")
+	flag.StringVar(&cfg.CommitTemplate, "commit-message-template", "", `Message of the release commit; {version} and {date} are replaced by the version and today's date (default "Release {version}")`)
+	flag.StringVar(&cfg.TagMessage, "tag-message", "", `Annotation of the release tag; "-" uses the generated changelog entry (default "Release <version>")`)
+	flag.StringVar(&cfg.SinceTag, "since-tag", "", "Diff from this tag instead of the auto-detected last release tag; also the baseline for --version validation")
+	flag.StringVar(&cfg.SinceMergeBase, "since-merge-base", "", "Preview what the current branch adds: diff from the merge base of this ref (e.g. main) and HEAD")
+	flag.BoolVar(&cfg.WorkingTree, "working-tree", false, "Preview the uncommitted changes: diff HEAD against the working tree (tracked files, staged and unstaged)")
+	flag.BoolVar(&cfg.Staged, "staged", false, "With --working-tree, describe only the staged changes")
+	flag.BoolVar(&cfg.SinceLastRun, "since-last-run", false, "Preview the changes since the HEAD recorded by the previous --since-last-run (first run: since the last tag)")
+	flag.StringVar(&cfg.Single, "single", "", "Generate a changelog fragment for a single commit (written to changelog.d/<sha>.md)")
+	flag.Var(&cfg.Not, "not", "Exclude commits reachable from this ref (repeatable)")
+	flag.BoolVar(&cfg.Promote, "promote", false, "With --version, move the Unreleased section into the new entry, dropping bullets it already has")
+	flag.BoolVar(&cfg.Accumulate, "accumulate", false, "Add notes for one commit (HEAD, or --single) to the Unreleased section and commit")
+	flag.Var(&cfg.IgnoreAuthor, "ignore-author", "Leave out commits whose author name or email contains this text, ignoring case (repeatable)")
+	flag.BoolVar(&cfg.IgnoreBots, "ignore-bots", false, "Leave out commits by bots: GitHub Apps ([bot] accounts) and known dependency updaters")
+	flag.StringVar(&cfg.IgnoredDiff, "ignored-diff", "include", "Whether the diff still covers the commits left out by --ignore-author/--ignore-bots: include or exclude")
+	flag.StringVar(&cfg.CommitsFile, "commits-file", "", "Describe only the commits listed in this file (one SHA per line) instead of a range")
+	flag.StringVar(&cfg.FromFragments, "from-fragments", "", "Release from the changelog fragments in this directory instead of the diff (requires --version)")
+	flag.BoolVar(&cfg.Clipboard, "clipboard", false, "Also copy the generated changelog to the system clipboard (preview only)")
+	flag.BoolVar(&cfg.GitHubOutput, "github-output", false, "After a release, write version and changelog_file step outputs to $GITHUB_OUTPUT")
+	flag.StringVar(&cfg.Explain, "explain", "", "Also write the changelog with a rationale under each bullet to this file; the normal output stays clean")
+	flag.StringVar(&cfg.Patch, "patch", "", "Preview the changelog for this patch file (git format-patch mbox or unified diff) instead of the repository")
+	flag.StringVar(&cfg.Replay, "replay", "", "Send this saved prompt (e.g. prompt.md from --debug-dir) to the model verbatim instead of reading the repository")
+	flag.StringVar(&cfg.GoldenTest, "golden-test", "", "Run every case under this directory (prompt.md and expected.md) and report where the output differs from the expectation")
+	flag.BoolVar(&cfg.GoldenMock, "golden-mock", false, "With --golden-test, answer each case with its response.md instead of calling the API")
+	flag.StringVar(&cfg.DebugDir, "debug-dir", "", "Write the exact prompt, raw response, and request metadata to this directory")
+	flag.BoolVar(&cfg.TOC, "toc", false, "Keep a table of contents linking every release at the top of CHANGELOG.md")
+	flag.StringVar(&cfg.UnreleasedLabel, "unreleased-label", defaultUnreleasedLabel, `Label of the section collecting unreleased changes, as in "## [Unreleased]"`)
+	flag.StringVar(&cfg.Order, "order", "newest-first", "Order of the releases in the changelog file: newest-first, or oldest-first to add new entries at the end")
+	flag.StringVar(&cfg.InsertMarker, "insert-marker", defaultInsertMarker, "Line in the output file below which new entries are inserted, if present")
+	flag.BoolVar(&cfg.AutoDeepen, "auto-deepen", false, "Fetch full history automatically when the repo is a shallow clone")
+	flag.BoolVar(&cfg.EnrichLabels, "enrich-labels", false, "Fetch GitHub labels of referenced issues/PRs and group bullets by label")
+	flag.Var(&cfg.Locales, "locale", "Write the changelog in this language, as a BCP-47 tag such as de or pt-BR (repeatable; each goes to CHANGELOG.<locale>.md)")
+	flag.BoolVar(&cfg.TranslateHeadings, "translate-headings", false, "With --locale, translate the ### section headings too")
+	flag.IntVar(&cfg.PreviousEntries, "previous-entries", 0, "Show the model the newest N entries of the existing changelog so it does not repeat them (0 disables)")
+	flag.BoolVar(&cfg.GoAPIDiff, "go-api-diff", false, "Compare the exported API of the Go packages in the range and give removed or changed symbols to the model as breaking changes")
+	flag.BoolVar(&cfg.PrevTagNotes, "include-prev-tag-notes", false, "Show the model the annotation of the last release tag, the range start, so it keeps the same terminology")
+	flag.IntVar(&cfg.MaxChars, "max-chars", 0, "Limit the entry to this many characters, keeping breaking changes, Added, and Fixed first and trimming the rest; 0 means no limit")
+	flag.BoolVar(&cfg.Compact, "compact", false, "Fold dependency bumps and trivial changes into single bullets")
+	flag.StringVar(&cfg.Scopes, "scopes", "", "Render conventional-commit scopes: prefix (**api:** on each bullet), group (bullets grouped by scope), or ignore")
+	flag.BoolVar(&cfg.CiteCommits, "cite-commits", false, "End each bullet with the SHAs of the commits it describes; citations of unknown commits are removed")
+	flag.StringVar(&cfg.CiteFormat, "cite-format", ai.DefaultCiteFormat, "Citation format for --cite-commits; {shas} is replaced by the comma-separated SHAs")
+	flag.StringVar(&cfg.SortBullets, "sort-bullets", "", "Sort bullets within each section: alpha or pr (by referenced #number)")
+	flag.BoolVar(&cfg.FixMarkdown, "fix-markdown", false, "Normalize bullet markers, blank lines, and heading spacing of the generated markdown")
+	flag.StringVar(&cfg.UpgradeTrailer, "upgrade-notes-trailer", "Upgrade-Notes", "Commit trailer whose values are added word for word as an ### Upgrade Notes section; empty turns it off")
+	flag.BoolVar(&cfg.SplitByTags, "split-by-tags", false, "Preview the range as one output with a ## [version] entry for each tag inside it, e.g. with --since-tag v1.0.0")
+	flag.StringVar(&cfg.JiraBaseURL, "jira-base-url", "", "Link Jira issue keys such as PROJ-123 in the entry to this Jira site, e.g. https://acme.atlassian.net")
+	flag.Var(&cfg.JiraProjects, "jira-projects", "With --jira-base-url, link only keys of these Jira projects, e.g. PROJ,OPS (repeatable)")
+	flag.Var(&cfg.AllowSections, "allow-sections", "Keep only these ### sections of the entry, e.g. Added,Changed,Fixed (repeatable)")
+	flag.Var(&cfg.AlwaysSections, "always-sections", "Always include these ### sections, e.g. Security, with a placeholder bullet when the model found nothing (repeatable)")
+	flag.StringVar(&cfg.EmptySectionText, "empty-section-text", "", `Placeholder bullet for an empty --always-sections section (default per section, e.g. "No security changes.")`)
+	flag.StringVar(&cfg.Theme, "theme", "plain", "Section heading style: plain, or emoji to prefix headings with an icon (e.g. \"### ✨ Added\")")
+	flag.StringVar(&cfg.ThemeFile, "theme-file", "", "With --theme emoji, file of \"Section = icon\" lines overriding or adding icons")
+	flag.BoolVar(&cfg.FullChangelogLink, "full-changelog-link", false, "End the entry with a \"**Full Changelog**:\" link to the GitHub compare page of the range")
+	flag.BoolVar(&cfg.Provenance, "provenance", false, "End the entry with an HTML comment recording the tool version, model, input range, and prompt hashes")
+	flag.BoolVar(&cfg.StatDetails, "include-stat-details", false, "Append the diff stat to the entry as a collapsed <details> block")
+	flag.StringVar(&cfg.PostProcess, "post-process", "", "Shell command to pipe the generated changelog through (stdin to stdout) before it is used")
+	flag.DurationVar(&cfg.MaxRetryWait, "max-retry-wait", ai.DefaultMaxRetryWait, "Longest retry-after delay of a rate-limited (429) request to wait out before retrying; longer delays fail the run")
+	flag.BoolVar(&cfg.NoStream, "no-stream", false, "Request each response whole instead of streaming it, for proxies that buffer or break server-sent events; output appears once generation finishes")
+	flag.DurationVar(&cfg.LockTimeout, "lock-timeout", 0, "How long a release waits for another release of the same repo to finish (e.g. 2m); 0 fails at once")
+	flag.BoolVar(&cfg.RequireBranch, "require-branch", false, "Refuse to release unless the default branch of origin is checked out")
+	flag.StringVar(&cfg.SignChangelog, "sign-changelog", "", "Write a detached signature of the changelog file next to it as <file>.sig, made with minisign or cosign")
+	flag.StringVar(&cfg.SignKey, "sign-key", "", "Secret key file (or cosign KMS URI) for --sign-changelog; default: the signer's own default, keyless for cosign")
+	flag.BoolVar(&cfg.Yes, "yes", false, "Skip the interactive release confirmation")
+	flag.StringVar(&cfg.HeaderFile, "changelog-header-file", "", "File whose contents become the preamble when CHANGELOG.md is created")
+	flag.BoolVar(&cfg.CheckHallucinations, "check-hallucinations", false, "Flag bullets that reference files or identifiers absent from the input")
+	flag.BoolVar(&cfg.ValidateFormat, "strict-keepachangelog", false, "Validate the output against Keep a Changelog and ask the model once to repair violations")
+	flag.BoolVar(&cfg.Strict, "strict", false, "Fail the run when a post-generation check reports problems")
+	flag.BoolVar(&cfg.Profile, "profile", false, "Print the estimated tokens of each prompt section (commits, diff stat, full diff, ...) to stderr")
+	flag.BoolVar(&verbose, "verbose", false, "Print extra diagnostics to stderr; includes --profile")
+	flag.Parse()
+
+	// The fragments are in the repository, as --single writes them there,
+	// wherever the tool is run from.
+	if cfg.FromFragments != "" && !filepath.IsAbs(cfg.FromFragments) {
+		dir, err := filepath.Abs(filepath.Join(cfg.Repo, cfg.FromFragments))
+		if err != nil {
+			return invalid(fmt.Errorf("resolving --from-fragments %q: %w", cfg.FromFragments, err))
+		}
+		cfg.FromFragments = dir
+	}
+	// Release and accumulate mode commit --output, so it names a file in the
+	// repository too; a preview writes it where the user asked.
+	if cfg.Output != "" && !filepath.IsAbs(cfg.Output) && (cfg.Version != "" || cfg.VersionFrom != "" || cfg.Accumulate) {
+		path, err := filepath.Abs(filepath.Join(cfg.Repo, cfg.Output))
+		if err != nil {
+			return invalid(fmt.Errorf("resolving --output %q: %w", cfg.Output, err))
+		}
+		cfg.Output = path
+	}
+
+	generator.Logf = verbosef
+	generator.MaxRetryWait = cfg.MaxRetryWait
+	generator.NoStream = cfg.NoStream
+
+	// Resolve provider: flag > env var > anthropic.
+	if cfg.Provider == "" {
+		cfg.Provider = os.Getenv("CHANGELOG_PROVIDER")
+	}
+	provider, err := ai.ParseProvider(cfg.Provider)
+	if err != nil {
+		return invalid(err)
+	}
+	generator.Provider = provider
+	if provider != nil {
+		fmt.Fprintf(os.Stderr, "info: using the %s provider; no model is called\n", cfg.Provider)
+	}
+
+	// Resolve API key: flag > env var; several keys replace both.
+	keys, err := apiKeys(cfg)
+	if err != nil {
+		return invalid(err)
+	}
+	if len(keys) > 0 {
+		if cfg.APIKey != "" {
+			return invalid(fmt.Errorf("--api-key cannot be combined with --api-keys or --api-keys-file"))
+		}
+		generator.Keys = keys
+		cfg.APIKey = keys[0] // for calls outside the generator, such as token counting
+		verbosef("using %d API key(s) round-robin", len(keys))
+	}
+	if cfg.APIKey == "" {
+		cfg.APIKey = os.Getenv("ANTHROPIC_API_KEY")
+	}
+	if cfg.APIKey == "" && generator.Provider == nil && !cfg.GoldenMock && !cfg.Plan {
+		return invalid(fmt.Errorf("no API key provided; set --api-key or $ANTHROPIC_API_KEY%s", otherProviderHint()))
+	}
+
+	if cfg.Seed != 0 {
+		// Kept so that invocations shared with seed-capable tools keep working.
+		fmt.Fprintln(os.Stderr, "warning: --seed is ignored: the Anthropic API has no sampling seed")
+	}
+
+	logFormat, err := ai.ParseLogFormat(cfg.LogFormat)
+	if err != nil {
+		return invalid(err)
+	}
+	scheme, err := parseVersionScheme(cfg.Versioning)
+	if err != nil {
+		return invalid(err)
+	}
+	style, err := ai.ParseStyle(cfg.Style)
+	if err != nil {
+		return invalid(err)
+	}
+	if style == ai.StyleNews && cfg.SortBullets != "" {
+		return invalid(fmt.Errorf("--sort-bullets has no effect on --style news, which has no bullets"))
+	}
+	if cfg.CiteCommits && (style == ai.StyleNews || cfg.FromFragments != "") {
+		return invalid(fmt.Errorf("--cite-commits needs bullets and input commits, so it cannot be used with --style news or --from-fragments"))
+	}
+	if cfg.CiteCommits && !strings.Contains(cfg.CiteFormat, "{shas}") {
+		return invalid(fmt.Errorf("--cite-format %q must contain {shas}", cfg.CiteFormat))
+	}
+	if label := strings.TrimSpace(cfg.UnreleasedLabel); label == "" || strings.ContainsAny(label, "[]\r\n") {
+		return invalid(fmt.Errorf("--unreleased-label %q must be non-empty and cannot contain brackets or line breaks", cfg.UnreleasedLabel))
+	}
+	cfg.UnreleasedLabel = strings.TrimSpace(cfg.UnreleasedLabel)
+	if cfg.Order != "newest-first" && cfg.Order != "oldest-first" {
+		return invalid(fmt.Errorf("unknown --order %q (want newest-first or oldest-first)", cfg.Order))
+	}
+	if cfg.MaxStatLines < 0 {
+		return invalid(fmt.Errorf("--max-stat-lines must not be negative"))
+	}
+	if strings.ContainsAny(cfg.UpgradeTrailer, ": \t\r\n") {
+		return invalid(fmt.Errorf("--upgrade-notes-trailer %q must be a trailer key such as Upgrade-Notes, without the colon", cfg.UpgradeTrailer))
+	}
+	if cfg.MaxChars < 0 {
+		return invalid(fmt.Errorf("--max-chars must not be negative"))
+	}
+	if cfg.MaxChars > 0 && (style == ai.StyleNews || cfg.Headline) {
+		return invalid(fmt.Errorf("--max-chars trims ### sections and cannot be used with --style news or --headline"))
+	}
+	if cfg.MaxDiffPerDir < 0 {
+		return invalid(fmt.Errorf("--max-diff-per-dir must not be negative"))
+	}
+	if cfg.Explain != "" && (style == ai.StyleNews || cfg.Headline) {
+		return invalid(fmt.Errorf("--explain annotates bullets and cannot be used with --style news or --headline"))
+	}
+	if style == ai.StyleNews && cfg.TOC {
+		return invalid(fmt.Errorf("--toc links ## [version] headings and cannot be used with --style news"))
+	}
+	if style == ai.StyleNews && cfg.ValidateFormat {
+		return invalid(fmt.Errorf("--strict-keepachangelog cannot be used with --style news"))
+	}
+	if cfg.Scopes != "" {
+		if _, err := ai.ParseScopeStyle(cfg.Scopes); err != nil {
+			return invalid(err)
+		}
+		if style == ai.StyleNews {
+			return invalid(fmt.Errorf("--scopes has no effect on --style news, which has no bullets"))
+		}
+	}
+	for _, v := range cfg.AllowSections {
+		for _, title := range strings.Split(v, ",") {
+			if title = strings.TrimSpace(title); title != "" {
+				cfg.allowed = append(cfg.allowed, title)
+			}
+		}
+	}
+	if len(cfg.AllowSections) > 0 && (len(cfg.allowed) == 0 || style == ai.StyleNews) {
+		return invalid(fmt.Errorf("--allow-sections needs section titles and cannot be used with --style news, which has no sections"))
+	}
+	for _, v := range cfg.JiraProjects {
+		for _, key := range strings.Split(v, ",") {
+			if key = strings.TrimSpace(key); key == "" {
+				continue
+			} else if err := ai.ValidateJiraKey(key); err != nil {
+				return invalid(fmt.Errorf("--jira-projects: %w", err))
+			}
+			cfg.jiraKeys = append(cfg.jiraKeys, key)
+		}
+	}
+	if cfg.JiraBaseURL != "" {
+		if u, err := url.Parse(cfg.JiraBaseURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return invalid(fmt.Errorf("--jira-base-url %q must be an http or https URL", cfg.JiraBaseURL))
+		}
+		if style == ai.StyleNews {
+			return invalid(fmt.Errorf("--jira-base-url writes markdown links and cannot be used with --style news"))
+		}
+	} else if len(cfg.JiraProjects) > 0 {
+		return invalid(fmt.Errorf("--jira-projects needs --jira-base-url"))
+	}
+	for _, v := range cfg.AlwaysSections {
+		for _, title := range strings.Split(v, ",") {
+			if title = strings.TrimSpace(title); title != "" {
+				cfg.always = append(cfg.always, title)
+			}
+		}
+	}
+	if len(cfg.AlwaysSections) > 0 && (len(cfg.always) == 0 || style == ai.StyleNews) {
+		return invalid(fmt.Errorf("--always-sections needs section titles and cannot be used with --style news, which has no sections"))
+	}
+	if cfg.EmptySectionText != "" && len(cfg.always) == 0 {
+		return invalid(fmt.Errorf("--empty-section-text requires --always-sections"))
+	}
+	for _, title := range cfg.always {
+		if len(cfg.allowed) > 0 && !slices.ContainsFunc(cfg.allowed, func(a string) bool { return strings.EqualFold(a, title) }) {
+			return invalid(fmt.Errorf("--always-sections %s is not among --allow-sections, which would drop it", title))
+		}
+	}
+	if cfg.icons, err = themeIcons(cfg); err != nil {
+		return invalid(err)
+	}
+	if cfg.icons != nil && style == ai.StyleNews {
+		return invalid(fmt.Errorf("--theme emoji decorates ### headings and cannot be used with --style news"))
+	}
+	switch ai.BulletOrder(cfg.SortBullets) {
+	case "", ai.OrderAlpha, ai.OrderPR:
+	default:
+		return invalid(fmt.Errorf("unknown --sort-bullets order %q (want alpha or pr)", cfg.SortBullets))
+	}
+	// The headline is printed as the model wrote it; none of the rewrites of
+	// an entry apply to it, so asking for one is a mistake, not a no-op.
+	if cfg.Headline && (cfg.PostProcess != "" || cfg.SortBullets != "" || cfg.CiteCommits || len(cfg.allowed) > 0 || len(cfg.always) > 0 ||
+		cfg.icons != nil || cfg.JiraBaseURL != "" || cfg.FullChangelogLink || cfg.FixMarkdown || cfg.StatDetails || cfg.ValidateFormat) {
+		return invalid(fmt.Errorf("--headline prints the model's sentence as is and cannot be used with --post-process, --sort-bullets, --cite-commits, --allow-sections, --always-sections, --theme emoji, --jira-base-url, --full-changelog-link, --fix-markdown, --include-stat-details, or --strict-keepachangelog"))
+	}
+	if cfg.APIVersion != "" {
+		if err := ai.ValidateAPIVersion(cfg.APIVersion); err != nil {
+			return invalid(err)
+		}
+	}
+
+	for _, l := range cfg.Locales {
+		if err := ai.ValidateLocale(l); err != nil {
+			return invalid(err)
+		}
+	}
+
+	for _, v := range cfg.Formats {
+		for _, f := range strings.Split(v, ",") {
+			if f = strings.TrimSpace(f); f == "md" {
+				f = "markdown"
+			}
+			if f != "" && !slices.Contains(cfg.formats, f) {
+				cfg.formats = append(cfg.formats, f)
+			}
+		}
+	}
+	if len(cfg.formats) > 0 {
+		if cfg.Format != "markdown" {
+			return invalid(fmt.Errorf("--formats lists every output format; it cannot be combined with --format"))
+		}
+		if cfg.Output == "" && cfg.OutputDir == "" {
+			return invalid(fmt.Errorf("--formats writes one file per format and needs --output or --output-dir"))
+		}
+		cfg.Format = cfg.formats[0]
+	}
+	for _, f := range append([]string{cfg.Format}, cfg.formats...) {
+		switch {
+		case f != "markdown" && f != "html" && f != "json":
+			return invalid(fmt.Errorf("unknown output format %q (want markdown, html, or json)", f))
+		case f != "markdown" && (cfg.Version != "" || cfg.Single != "" || cfg.Accumulate || style == ai.StyleNews || cfg.Headline || cfg.StatDetails):
+			return invalid(fmt.Errorf("the %s format renders a Keep a Changelog preview and cannot be used with --version, --single, --accumulate, --style news, --headline, or --include-stat-details", f))
+		}
+	}
+
+	if cfg.GoldenMock && cfg.GoldenTest == "" {
+		return invalid(fmt.Errorf("--golden-mock requires --golden-test"))
+	}
+	if cfg.GoldenTest != "" {
+		if cfg.Replay != "" {
+			return invalid(fmt.Errorf("--golden-test and --replay cannot be combined"))
+		}
+		return runGoldenTest(cfg, style)
+	}
+	if cfg.OutputDir != "" {
+		if cfg.Output != "" {
+			return invalid(fmt.Errorf("--output and --output-dir cannot be combined"))
+		}
+		if err := os.MkdirAll(cfg.OutputDir, 0755); err != nil {
+			return fmt.Errorf("creating output directory: %w", err)
+		}
+		if cfg.Single == "" {
+			cfg.Output = filepath.Join(cfg.OutputDir, outputName(cfg, style))
+		}
+	}
+	if cfg.SignKey != "" && cfg.SignChangelog == "" {
+		return invalid(fmt.Errorf("--sign-key requires --sign-changelog"))
+	}
+	if cfg.SignChangelog != "" {
+		switch {
+		case cfg.GitNote != "":
+			return invalid(fmt.Errorf("--sign-changelog signs the changelog file, which --git-note does not write"))
+		case cfg.Single != "":
+			return invalid(fmt.Errorf("--sign-changelog cannot be used with --single or --accumulate"))
+		case cfg.Version == "" && cfg.Output == "":
+			return invalid(fmt.Errorf("--sign-changelog needs a file to sign: pass --version, --output, or --output-dir"))
+		}
+		if cfg.signer, err = sign.New(cfg.SignChangelog, cfg.SignKey); err != nil {
+			return invalid(fmt.Errorf("--sign-changelog: %w", err))
+		}
+	}
+	if cfg.SplitByTags && (cfg.Version != "" || cfg.Single != "" || cfg.Accumulate || cfg.FromFragments != "" || cfg.SinceLastRun || cfg.CommitsFile != "" ||
+		len(cfg.Repos) > 0 || cfg.WorkingTree || cfg.Patch != "" || cfg.Replay != "" || cfg.Plan || cfg.Headline) {
+		return invalid(fmt.Errorf("--split-by-tags is a preview of a tag range and cannot be combined with --version, --single, --accumulate, --from-fragments, --since-last-run, --commits-file, --repos, --working-tree, --patch, --replay, --plan, or --headline"))
+	}
+	if cfg.Replay != "" {
+		return runReplay(cfg, style)
+	}
+	if cfg.Patch != "" {
+		return runPatch(cfg, logFormat)
+	}
+
+	if cfg.IgnoredDiff != "include" && cfg.IgnoredDiff != "exclude" {
+		return invalid(fmt.Errorf("unknown --ignored-diff %q (want include or exclude)", cfg.IgnoredDiff))
+	}
+
+	if cfg.PreferThreshold < 1 || cfg.PreferThreshold > 100 {
+		return invalid(fmt.Errorf("--prefer-commits-threshold must be between 1 and 100, got %d", cfg.PreferThreshold))
+	}
+	if cfg.MaxParallelGit < 1 {
+		return invalid(fmt.Errorf("--max-parallel-git must be at least 1"))
+	}
+	for _, pattern := range cfg.IgnoreAuthor {
+		if strings.TrimSpace(pattern) == "" {
+			return invalid(fmt.Errorf("--ignore-author must not be empty"))
+		}
+	}
+
+	// Resolve git binary: flag > env var > PATH.
+	if cfg.GitBin == "" {
+		cfg.GitBin = os.Getenv("GIT_BINARY")
+	}
+	if cfg.GitBin != "" {
+		git.Binary = cfg.GitBin
+	}
+	if err := git.CheckBinary(); err != nil {
+		return invalid(err)
+	}
+	for _, kv := range cfg.GitEnv {
+		if !strings.Contains(kv, "=") {
+			return invalid(fmt.Errorf("--git-env %q must be in KEY=VALUE form", kv))
+		}
+	}
+	git.Env = cfg.GitEnv
+
+	header := defaultChangelogHeader
+	if cfg.HeaderFile != "" {
+		data, err := os.ReadFile(cfg.HeaderFile)
+		if err != nil {
+			return invalid(fmt.Errorf("reading changelog header: %w", err))
+		}
+		header = string(data)
+	}
+
+	if cfg.VersionFrom != "" {
+		if cfg.Version != "" {
+			return invalid(fmt.Errorf("--version and --version-from cannot be combined"))
+		}
+		// Like the version tags, the file belongs to the repository.
+		path := cfg.VersionFrom
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(cfg.Repo, path)
+		}
+		if cfg.Version, err = readVersionFile(path); err != nil {
+			return invalid(err)
+		}
+		fmt.Fprintf(os.Stderr, "info: version %s from %s\n", cfg.Version, cfg.VersionFrom)
+	}
+
+	if len(cfg.Repos) > 0 {
+		if cfg.Version != "" || cfg.Single != "" || cfg.FromFragments != "" || len(cfg.Not) > 0 || cfg.SinceLastRun || cfg.WorkingTree || cfg.Plan || cfg.GoAPIDiff {
+			return invalid(fmt.Errorf("--repos supports preview mode only; it cannot be combined with --version, --single, --from-fragments, --not, --since-last-run, --working-tree, --plan, or --go-api-diff"))
+		}
+		return runRepos(cfg, logFormat)
+	}
+
+	if cfg.Repo, err = checkRepo(cfg.Repo); err != nil {
+		return err
+	}
+	if cfg.Staged && !cfg.WorkingTree {
+		return invalid(fmt.Errorf("--staged requires --working-tree"))
+	}
+	if cfg.WorkingTree {
+		return runWorkingTree(cfg, logFormat)
+	}
+
+	if cfg.Accumulate && cfg.Single == "" {
+		cfg.Single = "HEAD" // post-merge hook: the merged commit
+	}
+	if cfg.Single != "" && cfg.Version != "" {
+		return invalid(fmt.Errorf("--single and --accumulate cannot be used with --version"))
+	}
+	if cfg.Single != "" && len(cfg.Locales) > 1 {
+		return invalid(fmt.Errorf("--single accepts at most one --locale"))
+	}
+	if cfg.Clipboard && (cfg.Version != "" || cfg.Single != "") {
+		return invalid(fmt.Errorf("--clipboard is a preview option and cannot be combined with --version, --single, or --accumulate"))
+	}
+	if cfg.Headline && (cfg.Version != "" || cfg.Single != "") {
+		return invalid(fmt.Errorf("--headline is a preview mode and cannot be combined with --version, --single, or --accumulate"))
+	}
+	if style == ai.StyleNews && cfg.Single != "" {
+		return invalid(fmt.Errorf("--single and --accumulate write Keep a Changelog fragments and cannot be used with --style news"))
+	}
+	if cfg.FullChangelogLink && (style == ai.StyleNews || cfg.Single != "" || cfg.CommitsFile != "" || len(cfg.Repos) > 0) {
+		return invalid(fmt.Errorf("--full-changelog-link links a range of one repository and cannot be used with --style news, --single, --accumulate, --commits-file, or --repos"))
+	}
+	if len(cfg.always) > 0 && cfg.Single != "" {
+		return invalid(fmt.Errorf("--always-sections completes a release entry and cannot be used with --single or --accumulate, whose fragments would carry the placeholders"))
+	}
+	if cfg.Provenance && (style == ai.StyleNews || cfg.Headline || cfg.Single != "") {
+		return invalid(fmt.Errorf("--provenance adds an HTML comment to a release entry and cannot be used with --style news, --headline, --single, or --accumulate"))
+	}
+	if cfg.StatDetails && (style == ai.StyleNews || cfg.Single != "") {
+		return invalid(fmt.Errorf("--include-stat-details adds an HTML block to a release entry and cannot be used with --style news, --single, or --accumulate"))
+	}
+	if cfg.Promote && (cfg.Version == "" || style == ai.StyleNews) {
+		return invalid(fmt.Errorf("--promote requires --version and a Keep a Changelog file with an unreleased section"))
+	}
+	if cfg.ReleaseDryRun && cfg.Version == "" {
+		return invalid(fmt.Errorf("--release-dry-run shows what a release would do and requires --version"))
+	}
+	if cfg.ChangelogDiff && cfg.Version == "" {
+		return invalid(fmt.Errorf("--changelog-diff shows the update a release would make and requires --version"))
+	}
+	if cfg.Prerelease != "" {
+		switch {
+		case cfg.Version == "":
+			return invalid(fmt.Errorf("--prerelease requires --version, the final version being prepared"))
+		case scheme != schemeSemver:
+			return invalid(fmt.Errorf("--prerelease requires --versioning semver"))
+		case strings.Contains(cfg.Version, "-"):
+			return invalid(fmt.Errorf("--version %s already has a pre-release; pass the final version and let --prerelease number it", cfg.Version))
+		case !prereleaseIDRe.MatchString(cfg.Prerelease):
+			return invalid(fmt.Errorf("--prerelease %q must be a single identifier of letters, digits, and hyphens that starts with a letter, e.g. rc or beta", cfg.Prerelease))
+		}
+	}
+	if cfg.PrereleaseEntries != "keep" && cfg.PrereleaseEntries != "supersede" {
+		return invalid(fmt.Errorf("unknown --prerelease-entries %q (want keep or supersede)", cfg.PrereleaseEntries))
+	}
+	if err := checkGitNote(cfg); err != nil {
+		return err
+	}
+	if cfg.VerifyTag && cfg.Version == "" {
+		return invalid(fmt.Errorf("--verify-tag requires --version"))
+	}
+	if cfg.TagMessage != "" && cfg.Version == "" {
+		return invalid(fmt.Errorf("--tag-message requires --version"))
+	}
+	if cfg.CommitTemplate != "" {
+		if cfg.Version == "" {
+			return invalid(fmt.Errorf("--commit-message-template requires --version"))
+		}
+		if strings.TrimSpace(releaseCommitMessage(cfg, time.Now())) == "" {
+			return invalid(fmt.Errorf("--commit-message-template %q renders an empty commit message", cfg.CommitTemplate))
+		}
+	}
+	if cfg.SinceLastRun && (cfg.Version != "" || cfg.Single != "" || cfg.SinceTag != "" || cfg.CommitsFile != "") {
+		return invalid(fmt.Errorf("--since-last-run is a preview mode and cannot be combined with --version, --single, --accumulate, --since-tag, or --commits-file"))
+	}
+	if cfg.SinceMergeBase != "" && (cfg.Version != "" || cfg.Single != "" || cfg.SinceTag != "" || cfg.SinceLastRun || cfg.CommitsFile != "") {
+		return invalid(fmt.Errorf("--since-merge-base is a preview mode and cannot be combined with --version, --single, --accumulate, --since-tag, --since-last-run, or --commits-file"))
+	}
+	if cfg.SinceTag != "" && cfg.Single != "" {
+		return invalid(fmt.Errorf("--since-tag cannot be combined with --single or --accumulate"))
+	}
+	if cfg.FromFragments != "" && cfg.Version == "" {
+		return invalid(fmt.Errorf("--from-fragments requires --version"))
+	}
+
+	if cfg.PreviousEntries < 0 {
+		return invalid(fmt.Errorf("--previous-entries must not be negative"))
+	}
+	if cfg.GitHubOutput && cfg.Version == "" {
+		return invalid(fmt.Errorf("--github-output requires --version"))
+	}
+	if cfg.RequireBranch && cfg.Version == "" {
+		return invalid(fmt.Errorf("--require-branch requires --version"))
+	}
+
+	if cfg.Version != "" {
+		if err := checkConfirmable(cfg, interactive()); err != nil {
+			return err
+		}
+	}
+
+	if err := ensureFullHistory(cfg, cfg.Repo); err != nil {
+		return err
+	}
+	if cfg.Version != "" && (cfg.RequireBranch || verbose) {
+		if err := checkReleaseBranch(cfg); err != nil {
+			return err
+		}
+	}
+	if cfg.Version != "" {
+		// Held from before the last tag is read until the new tag exists, so
+		// concurrent releases cannot both validate against the same tag.
+		unlock, err := acquireReleaseLock(cfg.Repo, cfg.LockTimeout)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
+	for _, ref := range cfg.Not {
+		if _, err := git.ResolveCommit(cfg.Repo, ref); err != nil {
+			return invalid(fmt.Errorf("--not: %w", err))
+		}
+	}
+
+	if cfg.CommitsFile != "" {
+		if cfg.Single != "" || cfg.FromFragments != "" || len(cfg.Not) > 0 || cfg.GoAPIDiff {
+			return invalid(fmt.Errorf("--commits-file cannot be combined with --single, --accumulate, --from-fragments, --not, or --go-api-diff"))
+		}
+		if cfg.selected, err = readCommitsFile(cfg.Repo, cfg.CommitsFile); err != nil {
+			return invalid(err)
+		}
+		fmt.Fprintf(os.Stderr, "info: describing %d selected commit(s) from %s\n", len(cfg.selected), cfg.CommitsFile)
+	}
+
+	// fromGit is empty when there are no prior tags (git functions handle this).
+	// fromDesc is a human-readable label used in the AI prompt.
+	var fromGit, fromDesc, lastTag string
+	toGit := "HEAD"
+	superseded := false // --prerelease-entries supersede applies to this release
+
+	if cfg.Single != "" {
+		// Fragment mode: the range is just the one commit, sha^..sha.
+		sha, err := git.ResolveCommit(cfg.Repo, cfg.Single)
+		if err != nil {
+			return invalid(err)
+		}
+		if fromGit, err = git.Parent(cfg.Repo, sha); err != nil {
+			return fmt.Errorf("getting parent of %s: %w", cfg.Single, err)
+		}
+		toGit = sha
+		fromDesc = fromGit
+		if fromGit == "" {
+			fromDesc = "the beginning of the repository"
+		}
+	} else {
+		if cfg.SinceTag != "" {
+			if _, err := git.ResolveCommit(cfg.Repo, "refs/tags/"+cfg.SinceTag); err != nil {
+				return invalid(fmt.Errorf("--since-tag: no tag %q in %s", cfg.SinceTag, cfg.Repo))
+			}
+			lastTag = cfg.SinceTag
+		} else if lastTag, err = git.LastReleaseTag(cfg.Repo); err != nil {
+			// Returns "" when no tags exist yet.
+			return fmt.Errorf("getting last release tag: %w", err)
+		}
+
+		if cfg.SinceTag != "" {
+			fmt.Fprintf(os.Stderr, "info: diffing since tag %s (--since-tag)\n", lastTag)
+		} else if lastTag == "" {
+			fmt.Fprintln(os.Stderr, "info: no prior release tags found — will diff entire history")
+		} else {
+			fmt.Fprintf(os.Stderr, "info: last release tag: %s\n", lastTag)
+		}
+
+		// A version read from a file follows the tags' "v" convention.
+		if cfg.VersionFrom != "" {
+			if v := matchTagPrefix(cfg.Version, lastTag); v != cfg.Version {
+				fmt.Fprintf(os.Stderr, "info: releasing %s as %s to match the last tag %s\n", cfg.Version, v, lastTag)
+				cfg.Version = v
+			}
+		}
+
+		if cfg.Prerelease != "" {
+			if cfg.Version, err = nextPrerelease(cfg.Repo, cfg.Version, cfg.Prerelease); err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "info: pre-release version: %s\n", cfg.Version)
+		}
+
+		// Validate the requested version against the last tag.
+		if cfg.Version != "" {
+			if err := validateNewVersion(scheme, cfg.Version, lastTag); err != nil {
+				return invalid(err)
+			}
+		}
+
+		// A final release can replace the entries of the pre-releases before
+		// it with one covering the whole way from the last final release.
+		if cfg.Version != "" && cfg.Prerelease == "" && cfg.PrereleaseEntries == "supersede" && cfg.SinceTag == "" && scheme == schemeSemver {
+			if last, err := parseSemver(lastTag); err == nil && last.pre != "" {
+				stable, err := git.LastStableTag(cfg.Repo)
+				if err != nil {
+					return fmt.Errorf("getting last final release tag: %w", err)
+				}
+				superseded = true
+				lastTag = stable
+				if cfg.omit, cfg.skip, err = prereleaseCommits(cfg, changelogFile(cfg, style), stable); err != nil {
+					return err
+				}
+				if stable == "" {
+					fmt.Fprintln(os.Stderr, "info: superseding pre-release entries; no final release yet — will diff entire history")
+				} else {
+					fmt.Fprintf(os.Stderr, "info: superseding pre-release entries; diffing since the last final release %s\n", stable)
+				}
+			}
+		}
+
+		// Run right after tagging, the range is empty; say why instead of
+		// sending the model nothing to describe. Other starting points and
+		// --commits-file do not use the tag as the start of the range.
+		if lastTag != "" && cfg.SinceMergeBase == "" && !cfg.SinceLastRun && cfg.CommitsFile == "" {
+			tagged, err := git.ResolveCommit(cfg.Repo, "refs/tags/"+lastTag)
+			if err != nil {
+				return err
+			}
+			head, err := git.ResolveCommit(cfg.Repo, "HEAD")
+			if err != nil {
+				return err
+			}
+			if tagged == head {
+				return fmt.Errorf("%w: HEAD is already tagged as %s; nothing to release", errNoChanges, lastTag)
+			}
+		}
+
+		fromGit = lastTag
+		fromDesc = lastTag
+		if lastTag == "" {
+			fromDesc = "the beginning of the repository"
+		}
+	}
+
+	// --since-merge-base describes a branch on its own terms, from where it
+	// forked off ref, whatever the tags say.
+	if cfg.SinceMergeBase != "" {
+		if _, err := git.ResolveCommit(cfg.Repo, cfg.SinceMergeBase); err != nil {
+			return invalid(fmt.Errorf("--since-merge-base: %w", err))
+		}
+		base, err := git.MergeBase(cfg.Repo, cfg.SinceMergeBase, "HEAD")
+		if err != nil {
+			return err
+		}
+		if base == "" {
+			return invalid(fmt.Errorf("--since-merge-base: HEAD and %s have no common history", cfg.SinceMergeBase))
+		}
+		head, err := git.ResolveCommit(cfg.Repo, "HEAD")
+		if err != nil {
+			return invalid(err)
+		}
+		if base == head {
+			return fmt.Errorf("%w: HEAD is already part of %s", errNoChanges, cfg.SinceMergeBase)
+		}
+		short, err := git.ShortSHA(cfg.Repo, base)
+		if err != nil {
+			return err
+		}
+		fromGit = base
+		fromDesc = fmt.Sprintf("the merge base of %s and HEAD (%s)", cfg.SinceMergeBase, short)
+		fmt.Fprintf(os.Stderr, "info: diffing since %s\n", fromDesc)
+	}
+
+	// --since-last-run starts where the previous run ended; the tag range
+	// above is the fallback for the first run.
+	var headSHA string
+	if cfg.SinceLastRun {
+		if headSHA, err = git.ResolveCommit(cfg.Repo, "HEAD"); err != nil {
+			return invalid(err)
+		}
+		last, err := readLastRun(cfg.Repo)
+		if err != nil {
+			return err
+		}
+		if last == headSHA {
+			return fmt.Errorf("%w: HEAD has not moved since the last run", errNoChanges)
+		}
+		if last != "" {
+			fromGit = last
+			if fromDesc, err = git.ShortSHA(cfg.Repo, last); err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "info: changes since the last run at %s\n", fromDesc)
+		} else {
+			fmt.Fprintln(os.Stderr, "info: first run with --since-last-run; starting from the last release tag")
+		}
+		toGit = headSHA // so the recorded state is exactly what was described
+	}
+
+	if cfg.SplitByTags {
+		return runSplitByTags(cfg, baseRequest(cfg, logFormat), style, fromGit, fromDesc, toGit)
+	}
+
+	var changes ai.Changes
+	var fragments []ai.Fragment
+
+	if cfg.FromFragments != "" {
+		// Fragment assembly: the fragments replace the commit log and diff.
+		fragments, err = readFragments(cfg.FromFragments)
+		if err != nil {
+			return err
+		}
+		if len(fragments) == 0 {
+			return fmt.Errorf("%w: no fragments found in %s", errNoChanges, cfg.FromFragments)
+		}
+		fmt.Fprintf(os.Stderr, "info: assembling %d fragment(s) from %s\n", len(fragments), cfg.FromFragments)
+	} else {
+		if changes, err = gather(cfg, cfg.Repo, fromGit, toGit); err != nil {
+			return err
+		}
+		if len(changes.Commits) == 0 {
+			return fmt.Errorf("%w: no commits between %s and %s", errNoChanges, fromDesc, toGit)
+		}
+	}
+
+	// A person at a terminal confirms or changes the version before anything
+	// is generated or tagged. Without a terminal to ask at, only --yes lets
+	// the release go ahead.
+	if cfg.Version != "" {
+		if cfg.Version, err = confirmRelease(cfg, interactive(), os.Stdin, os.Stderr, scheme, lastTag, toGit, changes); err != nil {
+			return err
+		}
+	}
+
+	if cfg.FullChangelogLink {
+		if cfg.link, err = fullChangelogLink(cfg, fromGit, toGit); err != nil {
+			return err
+		}
+	}
+
+	req := baseRequest(cfg, logFormat)
+	req.From = fromDesc
+	req.To = toGit
+	// Fragments carry only sections, without a version header.
+	if cfg.Single == "" {
+		req.VersionHeader = versionHeader(style, cfg.Version, cfg.UnreleasedLabel, time.Now())
+	}
+	req.Commits = changes.Commits
+	req.DiffStat = changes.DiffStat
+	req.FullDiff = changes.FullDiff
+	req.Fragments = fragments
+	if cfg.Plan {
+		printPlan(os.Stdout, cfg, req)
+		return nil
+	}
+	if cfg.EnrichLabels {
+		req.IssueLabels = issueLabels(cfg.Repo, changes.Commits)
+	}
+	if cfg.PreviousEntries > 0 {
+		if req.PreviousEntries, err = readPreviousEntries(cfg, style, cfg.PreviousEntries); err != nil {
+			return err
+		}
+	}
+	if cfg.GoAPIDiff {
+		if req.APIChanges, err = goAPIChanges(cfg.Repo, fromGit, toGit); err != nil {
+			return err
+		}
+	}
+	if cfg.PrevTagNotes {
+		if lastTag == "" || fromGit != lastTag {
+			fmt.Fprintln(os.Stderr, "info: --include-prev-tag-notes: the range does not start at a release tag; no notes added")
+		} else if req.PreviousNotes, err = previousTagNotes(cfg.Repo, lastTag); err != nil {
+			return err
+		}
+	}
+
+	if cfg.Version != "" {
+		// Release mode: buffer output → prepend to CHANGELOG.md → create tag.
+		changelogPath := changelogFile(cfg, style)
+		opts := changelogOptions{Header: header, Marker: cfg.InsertMarker, TOC: cfg.TOC, Unreleased: cfg.UnreleasedLabel, Promote: cfg.Promote, OldestFirst: cfg.Order == "oldest-first"}
+		if style == ai.StyleNews {
+			opts.Entry = newsEntryPrefix
+			opts.Unreleased = ""
+			if cfg.HeaderFile == "" {
+				opts.Header = ""
+			}
+		}
+		if superseded {
+			opts.Drop = prereleaseHeadingPrefix(style, cfg.Version)
+		}
+
+		// Generate every locale before writing any, so an API failure
+		// leaves no file half-updated.
+		locales := localeList(cfg)
+		entries := make([]string, len(locales))
+		for i, locale := range locales {
+			req.Locale = locale
+			if entries[i], err = generate(cfg, req, io.Discard); err != nil {
+				return err
+			}
+		}
+
+		tagMessage := "Release " + cfg.Version
+		switch cfg.TagMessage {
+		case "":
+		case "-":
+			tagMessage = strings.TrimSpace(entries[0]) + "\n"
+		default:
+			tagMessage = cfg.TagMessage
+		}
+
+		if cfg.ReleaseDryRun {
+			return releaseDryRun(cfg, changelogPath, locales, entries, opts, fragments, tagMessage)
+		}
+		if cfg.ChangelogDiff {
+			if err := printChangelogDiff(cfg, changelogPath, locales, entries, opts); err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "info: --changelog-diff: nothing was written, committed, or tagged\n")
+			return nil
+		}
+
+		// With --git-note the entry goes into a note on HEAD instead, and
+		// there is no release commit: the tag goes on HEAD as it is.
+		var commitPaths []string
+		releaseCommit := releaseCommitMessage(cfg, time.Now())
+		if cfg.GitNote != "" {
+			if err := writeNote(cfg, entries[0]); err != nil {
+				return err
+			}
+			releaseCommit = ""
+		} else {
+			for i, locale := range locales {
+				path := localizedPath(changelogPath, locale)
+				if err := updateChangelogFile(path, entries[i], opts); err != nil {
+					return fmt.Errorf("updating %s: %w", path, err)
+				}
+				fmt.Fprintf(os.Stderr, "info: updated %s\n", path)
+				commitPaths = append(commitPaths, path)
+				if cfg.signer != nil {
+					sig, err := signFile(cfg, path)
+					if err != nil {
+						return err
+					}
+					commitPaths = append(commitPaths, sig)
+				}
+			}
+
+			if cfg.FromFragments != "" {
+				if err := removeFragments(cfg.FromFragments, fragments); err != nil {
+					return err
+				}
+				fmt.Fprintf(os.Stderr, "info: removed %d fragment(s) from %s\n", len(fragments), cfg.FromFragments)
+				commitPaths = append(commitPaths, cfg.FromFragments)
+			}
+
+			if err := git.CommitFiles(cfg.Repo, releaseCommit, commitPaths...); err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "info: committed %s\n", strings.Join(commitPaths, ", "))
+		}
+
+		if err := git.CreateTag(cfg.Repo, cfg.Version, tagMessage); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "info: created tag %s\n", cfg.Version)
+		if cfg.VerifyTag {
+			sha, err := verifyTag(cfg.Repo, cfg.Version, tagMessage, releaseCommit)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "info: verified tag %s (tag object %s) on the release commit\n", cfg.Version, sha)
+		}
+
+		if cfg.GitHubOutput {
+			outputs := [][2]string{{"version", cfg.Version}}
+			if len(commitPaths) > 0 {
+				outputs = append(outputs, [2]string{"changelog_file", commitPaths[0]})
+			}
+			outputs = append(outputs, [2]string{"prerelease", strconv.FormatBool(cfg.Prerelease != "")})
+			if err := githubOutput(outputs...); err != nil {
+				return err
+			}
+		}
+		if cfg.GitNote != "" {
+			fmt.Fprintf(os.Stderr, "next: git push --tags && git push origin %s\n", noteRef(cfg.GitNote))
+			return nil
+		}
+		fmt.Fprintf(os.Stderr, "next: git push && git push --tags\n")
+		return nil
+	}
+
+	if cfg.Single != "" {
+		// Fragment mode: buffer output → write changelog.d/<sha>.md, or with
+		// --accumulate merge it into the Unreleased section and commit.
+		if len(cfg.Locales) == 1 {
+			req.Locale = cfg.Locales[0]
+		}
+		short, err := git.ShortSHA(cfg.Repo, toGit)
+		if err != nil {
+			return err
+		}
+
+		if cfg.Accumulate {
+			return accumulate(cfg, req, short, changelogOptions{Header: header, Marker: cfg.InsertMarker, TOC: cfg.TOC, Unreleased: cfg.UnreleasedLabel, OldestFirst: cfg.Order == "oldest-first"})
+		}
+
+		entry, err := generate(cfg, req, io.Discard)
+		if err != nil {
+			return err
+		}
+
+		fragmentPath := cfg.Output
+		switch {
+		case cfg.OutputDir != "":
+			fragmentPath = filepath.Join(cfg.OutputDir, short+".md")
+		case fragmentPath == "":
+			fragmentPath = filepath.Join(cfg.Repo, "changelog.d", short+".md")
+		}
+		if err := os.MkdirAll(filepath.Dir(fragmentPath), 0755); err != nil {
+			return fmt.Errorf("creating fragment directory: %w", err)
+		}
+		if err := os.WriteFile(fragmentPath, []byte(strings.TrimSpace(entry)+"\n"), 0644); err != nil {
+			return fmt.Errorf("writing fragment: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "info: wrote fragment %s\n", fragmentPath)
+		return nil
+	}
+
+	if err := preview(cfg, req); err != nil {
+		return err
+	}
+	if cfg.SinceLastRun {
+		return writeLastRun(cfg.Repo, headSHA)
+	}
+	return nil
+}
+
+// printChangelogDiff prints to stdout the unified diff of the update that
+// release mode would make to each localized changelog, for --changelog-diff
+// and --release-dry-run. Nothing is written.
+func printChangelogDiff(cfg config, changelogPath string, locales, entries []string, opts changelogOptions) error {
+	for i, locale := range locales {
+		path := localizedPath(changelogPath, locale)
+		before, after, err := updatedChangelog(path, entries[i], opts)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", path, err)
+		}
+		fmt.Print(unifiedDiff(repoRelative(cfg.Repo, path), before, after))
+	}
+	return nil
+}
+
+// accumulate generates notes for the single commit in req and merges them
+// into the Unreleased section of the changelog, then commits the file.
+// A commit whose marker is already in the changelog is skipped.
+func accumulate(cfg config, req ai.Request, short string, opts changelogOptions) error {
+	changelogPath := changelogFile(cfg, ai.StyleKeepAChangelog)
+	existing, err := os.ReadFile(changelogPath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	marker := commitMarker(req.To) // full SHA: abbreviations can grow over time
+	if strings.Contains(string(existing), marker) {
+		fmt.Fprintf(os.Stderr, "info: %s is already in %s — nothing to do\n", short, changelogPath)
+		return nil
+	}
+	// The commit a previous run made, or any other that only edits the
+	// changelog, has nothing to add to it.
+	if own, err := changelogOnlyCommit(cfg.Repo, req, changelogPath); err != nil {
+		return err
+	} else if own {
+		fmt.Fprintf(os.Stderr, "info: %s only updates %s — nothing to do\n", short, changelogPath)
+		return nil
+	}
+
+	entry, err := generate(cfg, req, io.Discard)
+	if err != nil {
+		return err
+	}
+
+	content := accumulateEntry(string(existing), entry, marker, opts)
+	if opts.TOC {
+		content = updateTOC(content)
+	}
+	if err := os.WriteFile(changelogPath, []byte(content), 0644); err != nil {
+		return fmt.Errorf("updating %s: %w", changelogPath, err)
+	}
+	fmt.Fprintf(os.Stderr, "info: added %s to the %s section of %s\n", short, opts.Unreleased, changelogPath)
+
+	if err := git.CommitFiles(cfg.Repo, accumulateSubject+short, changelogPath); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "info: committed %s\n", changelogPath)
+	return nil
+}
+
+// accumulateSubject starts the subject of the commits --accumulate makes.
+const accumulateSubject = "Update changelog for "
+
+// changelogOnlyCommit reports whether the commit req describes is one that
+// --accumulate made, or one that changes nothing but changelogPath.
+func changelogOnlyCommit(repo string, req ai.Request, changelogPath string) (bool, error) {
+	if len(req.Commits) == 1 && strings.HasPrefix(req.Commits[0].Subject, accumulateSubject) {
+		return true, nil
+	}
+	files, err := git.ChangedFiles(repo, "", "", git.DiffOptions{Only: []string{req.To}})
+	if err != nil {
+		return false, fmt.Errorf("listing the files of %s: %w", req.To, err)
+	}
+	return len(files) == 1 && files[0] == repoRelative(repo, changelogPath), nil
+}
+
+// prereleaseCommits returns what a final release superseding its
+// pre-releases leaves out of the range since stable: the changelog files at
+// changelogPath, one per --locale, whose pre-release entries it replaces,
+// and the release commits of the pre-release tags in between, which change
+// nothing else.
+func prereleaseCommits(cfg config, changelogPath, stable string) (omit, skip []string, err error) {
+	for _, locale := range localeList(cfg) {
+		rel := repoRelative(cfg.Repo, localizedPath(changelogPath, locale))
+		if !filepath.IsAbs(rel) && !strings.HasPrefix(rel, "..") {
+			omit = append(omit, rel)
+		}
+	}
+	if len(omit) == 0 {
+		return nil, nil, nil // not in the repository
+	}
+	tags, err := git.TagsInRange(cfg.Repo, stable, "HEAD")
+	if err != nil {
+		return nil, nil, fmt.Errorf("listing the pre-release tags: %w", err)
+	}
+	for _, t := range tags {
+		if !strings.Contains(t.Name, "-") {
+			continue
+		}
+		files, err := git.ChangedFiles(cfg.Repo, "", "", git.DiffOptions{Only: []string{t.Commit}})
+		if err != nil {
+			return nil, nil, fmt.Errorf("listing the files of %s: %w", t.Name, err)
+		}
+		if len(files) > 0 && !slices.ContainsFunc(files, func(f string) bool { return !slices.Contains(omit, f) }) {
+			fmt.Fprintf(os.Stderr, "info: leaving out the release commit of %s\n", t.Name)
+			skip = append(skip, t.Commit)
+		}
+	}
+	return omit, skip, nil
+}
+
+// outputName is the file name --output-dir gives the output: HEADLINE.txt
+// for --headline, NEWS for --style news, and otherwise CHANGELOG with the
+// extension of --format, e.g. CHANGELOG.md. Each --locale gets its own file
+// named by localizedPath, e.g. CHANGELOG.de.md.
+func outputName(cfg config, style ai.Style) string {
+	switch {
+	case cfg.Headline:
+		return "HEADLINE.txt"
+	case style == ai.StyleNews:
+		return "NEWS"
+	}
+	return formatPath("CHANGELOG.md", cfg.Format)
+}
+
+// formatPath returns path with the file extension of format: .md, .html, or
+// .json.
+func formatPath(path, format string) string {
+	ext := map[string]string{"markdown": ".md", "html": ".html", "json": ".json"}[format]
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ext
+}
+
+// releaseCommitMessage is the message of the release commit: "Release
+// <version>", or --commit-message-template with {version} and {date}, the
+// YYYY-MM-DD form of date, filled in.
+func releaseCommitMessage(cfg config, date time.Time) string {
+	if cfg.CommitTemplate == "" {
+		return "Release " + cfg.Version
+	}
+	return strings.NewReplacer("{version}", cfg.Version, "{date}", date.Format("2006-01-02")).Replace(cfg.CommitTemplate)
+}
+
+// changelogFile returns the changelog that release and accumulate modes
+// update: --output, or CHANGELOG.md (NEWS for --style news) in the repo. In
+// preview mode --output names the preview, so the repo's file is returned.
+func changelogFile(cfg config, style ai.Style) string {
+	if cfg.Output != "" && (cfg.Version != "" || cfg.Accumulate) {
+		return cfg.Output
+	}
+	if style == ai.StyleNews {
+		return filepath.Join(cfg.Repo, "NEWS")
+	}
+	return filepath.Join(cfg.Repo, "CHANGELOG.md")
+}
+
+// previousTagNotes returns the annotation of tag for --include-prev-tag-notes,
+// or "" for a lightweight tag, which has none, and for the bare
+// "Release <version>" message this tool writes by default, which says nothing
+// about the release.
+func previousTagNotes(repo, tag string) (string, error) {
+	t, ok, err := git.LookupTag(repo, tag)
+	if err != nil {
+		return "", fmt.Errorf("reading tag %s: %w", tag, err)
+	}
+	switch {
+	case !ok || t.Type != "tag":
+		fmt.Fprintf(os.Stderr, "info: %s is a lightweight tag without notes\n", tag)
+		return "", nil
+	case strings.TrimSpace(t.Message) == "" || strings.TrimSpace(t.Message) == "Release "+tag:
+		fmt.Fprintf(os.Stderr, "info: tag %s has no release notes beyond its title\n", tag)
+		return "", nil
+	}
+	fmt.Fprintf(os.Stderr, "info: including the release notes of tag %s\n", tag)
+	return strings.TrimSpace(t.Message), nil
+}
+
+// maxAPIChanges bounds the --go-api-diff changes listed in the prompt; a
+// release removing more than this is better summarized than enumerated.
+const maxAPIChanges = 100
+
+// goAPIChanges returns the incompatible changes to the exported Go API
+// between from and to for --go-api-diff, one line each for the prompt.
+func goAPIChanges(repo, from, to string) ([]string, error) {
+	if from == "" {
+		fmt.Fprintln(os.Stderr, "info: --go-api-diff: no earlier release to compare the API with")
+		return nil, nil
+	}
+	changes, err := goapi.Diff(repo, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("--go-api-diff: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "info: --go-api-diff: %d incompatible change(s) to the exported Go API\n", len(changes))
+	var lines []string
+	for i, c := range changes {
+		if i == maxAPIChanges {
+			lines = append(lines, fmt.Sprintf("… and %d more", len(changes)-maxAPIChanges))
+			break
+		}
+		verbosef("--go-api-diff: %s", c)
+		lines = append(lines, c.String())
+	}
+	return lines, nil
+}
+
+// readPreviousEntries returns the newest n entries of the existing changelog
+// for --previous-entries, at its top or, with --order oldest-first, at its
+// end, or "" when it does not exist yet.
+func readPreviousEntries(cfg config, style ai.Style, n int) (string, error) {
+	path := changelogFile(cfg, style)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("reading previous entries: %w", err)
+	}
+	prefix := "## ["
+	if style == ai.StyleNews {
+		prefix = newsEntryPrefix
+	}
+	entries := previousEntries(string(data), n, prefix)
+	if cfg.Order == "oldest-first" {
+		entries = lastEntries(string(data), n, prefix)
+	}
+	if entries != "" {
+		fmt.Fprintf(os.Stderr, "info: including up to %d previous entries from %s\n", n, path)
+	}
+	return entries, nil
 }
 
-func main() {
-	if err := run(); err != nil {
-		fmt.Fprintln(os.Stderr, "error:", err)
-		os.Exit(1)
+// otherProviderKeys are API key variables of providers this tool does not
+// talk to; they are a common reason $ANTHROPIC_API_KEY is missing.
+var otherProviderKeys = []string{"OPENAI_API_KEY", "GEMINI_API_KEY", "GOOGLE_API_KEY"}
+
+// otherProviderHint explains, when another provider's key is set, that it is
+// not used.
+func otherProviderHint() string {
+	var set []string
+	for _, name := range otherProviderKeys {
+		if os.Getenv(name) != "" {
+			set = append(set, "$"+name)
+		}
+	}
+	if len(set) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (%s is set, but only the Anthropic API is supported)", strings.Join(set, " and "))
+}
+
+// baseRequest returns a Request carrying the model settings from cfg; callers
+// fill in the range and changes.
+func baseRequest(cfg config, logFormat ai.LogFormat) ai.Request {
+	return ai.Request{
+		APIKey:     cfg.APIKey,
+		Model:      cfg.Model,
+		APIVersion: cfg.APIVersion,
+		LogFormat:  logFormat,
+		MaxSubject: cfg.MaxSubject,
+		Style:      ai.Style(cfg.Style), // validated by run
+		Scopes:     ai.ScopeStyle(cfg.Scopes),
+
+		TranslateHeadings: cfg.TranslateHeadings,
+		Headline:          cfg.Headline,
+		Explain:           cfg.Explain != "",
+		Compact:           cfg.Compact,
+		MaxChars:          cfg.MaxChars,
+		Cite:              cfg.CiteCommits,
+	}
+}
+
+// preview streams the changelog for req to stdout or the --output file
+// without touching the repository. With several --locale values, each
+// language goes to its own localized --output path, or to stdout in turn.
+func preview(cfg config, req ai.Request) error {
+	return previewWith(cfg, req, generate)
+}
+
+// generateFunc produces the changelog for req, writing it to out, as
+// generate does.
+type generateFunc func(cfg config, req ai.Request, out io.Writer) (string, error)
+
+// previewWith is preview with gen producing the text of each language, so
+// that --split-by-tags can assemble several entries into one output.
+func previewWith(cfg config, req ai.Request, gen generateFunc) error {
+	locales := localeList(cfg)
+	texts := make([]string, len(locales))
+	var written []string
+	for i, locale := range locales {
+		req.Locale = locale
+		path := localizedPath(cfg.Output, locale)
+		if len(cfg.formats) > 0 {
+			path = formatPath(path, cfg.Format)
+		}
+		var err error
+		if texts[i], err = previewOne(cfg, req, gen, path, i > 0); err != nil {
+			return err
+		}
+		written = append(written, path)
+		// The other --formats are rendered from the same text.
+		for _, f := range cfg.formats[min(1, len(cfg.formats)):] {
+			path := formatPath(localizedPath(cfg.Output, locale), f)
+			err := writeAtomic(path, func(w io.Writer) error {
+				_, err := io.WriteString(w, render(cfg, f, texts[i]))
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "info: wrote the %s format to %s\n", f, path)
+			written = append(written, path)
+		}
+	}
+	if cfg.signer != nil {
+		for _, path := range written {
+			if _, err := signFile(cfg, path); err != nil {
+				return err
+			}
+		}
+	}
+	if cfg.Clipboard {
+		clip(render(cfg, cfg.Format, strings.Join(texts, "\n")))
+	}
+	return nil
+}
+
+// signFile writes the --sign-changelog signature of path and returns its
+// path.
+func signFile(cfg config, path string) (string, error) {
+	sig, err := cfg.signer.Sign(path)
+	if err != nil {
+		return "", fmt.Errorf("signing %s: %w", path, err)
+	}
+	fmt.Fprintf(os.Stderr, "info: signed %s with %s: %s\n", path, cfg.signer.Name(), sig)
+	return sig, nil
+}
+
+// clip copies text to the clipboard for --clipboard. A missing clipboard
+// tool only warns: the changelog has already been printed or written.
+func clip(text string) {
+	if err := copyToClipboard(text); err != nil {
+		fmt.Fprintf(os.Stderr, "warning: not copied to the clipboard: %v\n", err)
+		return
+	}
+	fmt.Fprintln(os.Stderr, "info: copied to the clipboard")
+}
+
+// previewOne streams a single generation by gen to path, or to stdout when
+// path is empty, and returns the text. separate prints a blank line first to
+// split consecutive stdout runs. A file is written with writeAtomic, so
+// readers never see a partial changelog and a failed run leaves any previous
+// file intact.
+func previewOne(cfg config, req ai.Request, gen generateFunc, path string, separate bool) (string, error) {
+	if path == "" {
+		if separate {
+			fmt.Fprintln(os.Stdout)
+		}
+		logLocale(req)
+		return gen(cfg, req, os.Stdout)
+	}
+
+	logLocale(req)
+	var text string
+	err := writeAtomic(path, func(w io.Writer) error {
+		var err error
+		text, err = gen(cfg, req, w)
+		return err
+	})
+	return text, err
+}
+
+// writeAtomic writes path with write through a temporary file in the same
+// directory that is renamed over path once complete, so that readers never
+// see a partial file. On error path is left as it was.
+func writeAtomic(path string, write func(w io.Writer) error) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("opening output file: %w", err)
+	}
+	defer os.Remove(f.Name()) // no-op after a successful rename
+	defer f.Close()
+
+	if err := write(f); err != nil {
+		return err
+	}
+	if err := f.Chmod(0644); err != nil {
+		return fmt.Errorf("writing output file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("writing output file: %w", err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("writing output file: %w", err)
+	}
+	return nil
+}
+
+// logLocale notes which language is being generated when --locale is set.
+func logLocale(req ai.Request) {
+	if req.Locale != "" {
+		fmt.Fprintf(os.Stderr, "info: generating %s changelog\n", req.Locale)
+	}
+}
+
+// localeList returns the locales to generate: each --locale, or a single ""
+// (the default language) when none were given.
+func localeList(cfg config) []string {
+	if len(cfg.Locales) == 0 {
+		return []string{""}
+	}
+	return cfg.Locales
+}
+
+// localizedPath inserts "."+locale before the extension of path, turning
+// CHANGELOG.md into CHANGELOG.de.md. It returns path unchanged when either
+// is empty.
+func localizedPath(path, locale string) string {
+	if path == "" || locale == "" {
+		return path
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + locale + ext
+}
+
+// generate runs the model for req and returns the complete changelog text
+// after recording it under --debug-dir, applying any post-processing, and
+// running the post-generation checks. Output is streamed to out as it arrives,
+// unless post-processing, format validation, --check-hallucinations, or
+// --explain is enabled, in which case out receives the final text once it is
+// ready and has passed the checks, so that --strict prints nothing it fails.
+func generate(cfg config, req ai.Request, out io.Writer) (string, error) {
+	req.UpgradeNotes = upgradeNotes(cfg, req)
+	if err := preflight(cfg, &req); err != nil {
+		return "", err
+	}
+	if cfg.Profile || verbose {
+		printBreakdown(req)
+	}
+
+	buffered := (postProcessing(cfg) || cfg.ValidateFormat || cfg.CheckHallucinations || req.Explain || len(req.UpgradeNotes) > 0) && !req.Headline
+	stream := out
+	if buffered {
+		stream = io.Discard
+	}
+	text, err := runModel(cfg, req, stream)
+	if err != nil {
+		return "", err
+	}
+	if req.Explain {
+		if text, err = writeExplanation(cfg, req, text); err != nil {
+			return "", err
+		}
+	}
+
+	if cfg.ValidateFormat && !req.Headline {
+		if text, err = validateEntry(cfg, req, text); err != nil {
+			return "", err
+		}
 	}
+	if buffered {
+		if text, err = postProcess(cfg, req, text); err != nil {
+			return "", err
+		}
+	}
+	if err := checkOutput(cfg, text, req); err != nil {
+		return "", err
+	}
+	if buffered {
+		if _, err := io.WriteString(out, render(cfg, cfg.Format, text)); err != nil {
+			return "", err
+		}
+	}
+	return text, nil
 }
 
-func run() error {
-	var cfg config
+// upgradeNotes collects the --upgrade-notes-trailer values of the commits
+// described by req, oldest first, the order to follow them in, and without
+// repeats, for the Upgrade Notes section. Entries without ### sections get
+// none.
+func upgradeNotes(cfg config, req ai.Request) []string {
+	if cfg.UpgradeTrailer == "" || req.Headline || req.Style == ai.StyleNews {
+		return nil
+	}
+	var notes []string
+	commits := inputCommits(req)
+	for i := len(commits) - 1; i >= 0; i-- { // git log lists the newest first
+		c := commits[i]
+		for _, note := range git.Trailer(c.Body, cfg.UpgradeTrailer) {
+			if !slices.Contains(notes, note) {
+				notes = append(notes, note)
+			}
+		}
+	}
+	if len(notes) > 0 {
+		fmt.Fprintf(os.Stderr, "info: %d upgrade note(s) from %s trailers\n", len(notes), cfg.UpgradeTrailer)
+	}
+	return notes
+}
 
-	flag.StringVar(&cfg.Repo, "repo", ".", "Path to git repo")
-	flag.StringVar(&cfg.Repo, "r", ".", "Path to git repo (shorthand)")
-	flag.StringVar(&cfg.Model, "model", defaultModel, "Anthropic model ID")
-	flag.StringVar(&cfg.Model, "m", defaultModel, "Anthropic model ID (shorthand)")
-	flag.StringVar(&cfg.Output, "output", "", "Output file path (default: stdout)")
-	flag.StringVar(&cfg.Output, "o", "", "Output file path (shorthand)")
-	flag.StringVar(&cfg.Version, "version", "", "Release version (e.g. v1.2.0); updates CHANGELOG.md and creates a git tag")
-	flag.StringVar(&cfg.Version, "v", "", "Release version (shorthand)")
-	flag.IntVar(&cfg.MaxDiff, "max-diff", 2000, "Line threshold for full diff inclusion")
-	flag.StringVar(&cfg.APIKey, "api-key", "", "Anthropic API key (default: $ANTHROPIC_API_KEY)")
-	flag.Parse()
+// writeExplanation writes the annotated response text to the --explain file,
+// one per language when several --locale values are given, and returns text
+// with the rationales removed.
+func writeExplanation(cfg config, req ai.Request, text string) (string, error) {
+	path := cfg.Explain
+	if len(cfg.Locales) > 1 {
+		path = localizedPath(path, req.Locale)
+	}
+	if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+		return "", fmt.Errorf("writing --explain file: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "info: wrote annotated changelog to %s\n", path)
+	return ai.StripRationales(text), nil
+}
 
-	// Resolve API key: flag > env var.
-	if cfg.APIKey == "" {
-		cfg.APIKey = os.Getenv("ANTHROPIC_API_KEY")
+// runModel makes one model call for req, streaming the response to out, and
+// records the exchange under --debug-dir. The text it returns is without any
+// fence the model wrapped the whole response in; see ai.StripOutputFence.
+func runModel(cfg config, req ai.Request, out io.Writer) (string, error) {
+	req.Out = out
+	started := time.Now()
+	res, genErr := generator.Generate(context.Background(), req)
+	if cfg.DebugDir != "" {
+		// Record failed runs too; a partial response is often the interesting part.
+		if err := ai.WriteDebug(cfg.DebugDir, req, res.Text, started, time.Since(started)); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: writing debug output: %v\n", err)
+		} else {
+			fmt.Fprintf(os.Stderr, "info: wrote prompt and response to %s\n", cfg.DebugDir)
+		}
 	}
-	if cfg.APIKey == "" {
-		return fmt.Errorf("no API key provided; set --api-key or $ANTHROPIC_API_KEY")
+	if genErr != nil {
+		return "", genErr
 	}
+	verbosef("%s used %d input and %d output token(s), stop reason %s", res.Model, res.InputTokens, res.OutputTokens, res.StopReason)
+	if res.StopReason == "max_tokens" {
+		fmt.Fprintf(os.Stderr, "warning: the response reached the %d-token output limit and is probably cut off\n", ai.MaxTokens)
+	}
+	return ai.StripOutputFence(res.Text), nil
+}
 
-	// Validate repo path.
-	if _, err := os.Stat(cfg.Repo); err != nil {
-		return fmt.Errorf("repo path %q not accessible: %w", cfg.Repo, err)
+// validateEntry checks text against the Keep a Changelog format for
+// --strict-keepachangelog. If it breaks the format, the model is asked once
+// to repair it; violations that remain are warnings, or errors with --strict.
+func validateEntry(cfg config, req ai.Request, text string) (string, error) {
+	vs := ai.ValidateKeepAChangelog(text, req)
+	if len(vs) == 0 {
+		return text, nil
+	}
+	fmt.Fprintf(os.Stderr, "info: entry breaks the Keep a Changelog format in %d place(s); asking the model to repair it\n", len(vs))
+	for _, v := range vs {
+		verbosef("format violation: %s", v)
 	}
 
-	// Get the last release tag. Returns "" when no tags exist yet.
-	lastTag, err := git.LastReleaseTag(cfg.Repo)
+	req.Repair = &ai.Repair{Previous: text, Violations: vs}
+	req.Explain = false // the rationale of the first answer stays in the --explain file
+	if err := preflight(cfg, &req); err != nil {
+		return "", err
+	}
+	text, err := runModel(cfg, req, io.Discard)
 	if err != nil {
-		return fmt.Errorf("getting last release tag: %w", err)
+		return "", err
 	}
 
-	if lastTag == "" {
-		fmt.Fprintln(os.Stderr, "info: no prior release tags found — will diff entire history")
-	} else {
-		fmt.Fprintf(os.Stderr, "info: last release tag: %s\n", lastTag)
+	vs = ai.ValidateKeepAChangelog(text, req)
+	for _, v := range vs {
+		fmt.Fprintf(os.Stderr, "warning: not Keep a Changelog format: %s\n", v)
 	}
+	if cfg.Strict && len(vs) > 0 {
+		return "", fmt.Errorf("%d Keep a Changelog format violation(s) remain after a repair attempt", len(vs))
+	}
+	return text, nil
+}
 
-	// Validate the requested version against the last tag.
-	if cfg.Version != "" {
-		if err := validateNewVersion(cfg.Version, lastTag); err != nil {
-			return err
+// readCommitsFile reads the commit list for --commits-file: one SHA (or other
+// commit-ish) per line, with blank lines and #-comments ignored. Every entry
+// is resolved to a full SHA, and all unknown entries are reported together.
+func readCommitsFile(repo, path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading commits file: %w", err)
+	}
+	var shas, unknown []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		sha, err := git.ResolveCommit(repo, line)
+		if err != nil {
+			unknown = append(unknown, line)
+			continue
 		}
+		shas = append(shas, sha)
 	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("%s: unknown commit(s): %s", path, strings.Join(unknown, ", "))
+	}
+	if len(shas) == 0 {
+		return nil, fmt.Errorf("%s lists no commits", path)
+	}
+	return shas, nil
+}
 
-	// fromGit is empty when there are no prior tags (git functions handle this).
-	// fromDesc is a human-readable label used in the AI prompt.
-	fromGit := lastTag
-	fromDesc := lastTag
-	if lastTag == "" {
-		fromDesc = "the beginning of the repository"
+// ensureFullHistory makes sure repo is not a shallow clone, deepening it when
+// --auto-deepen is set. Shallow history makes tag lookup and range diffs
+// silently wrong, so it is an error otherwise.
+func ensureFullHistory(cfg config, repo string) error {
+	shallow, err := git.IsShallow(repo)
+	if err != nil {
+		return fmt.Errorf("checking for shallow clone: %w", err)
+	}
+	if !shallow {
+		return nil
+	}
+	if !cfg.AutoDeepen {
+		return fmt.Errorf("%s is a shallow clone, so tags and history are incomplete; run `git fetch --unshallow --tags` (in CI, check out with full depth, e.g. fetch-depth: 0) or pass --auto-deepen", repo)
 	}
+	fmt.Fprintf(os.Stderr, "info: %s is a shallow clone — fetching full history\n", repo)
+	return git.Unshallow(repo)
+}
 
-	// Gather git data.
-	commits, err := git.CommitLog(cfg.Repo, fromGit, "HEAD")
+// checkReleaseBranch logs the current and default branches under --verbose
+// and, with --require-branch, fails unless they are the same.
+func checkReleaseBranch(cfg config) error {
+	current, err := git.CurrentBranch(cfg.Repo)
+	if err != nil {
+		return fmt.Errorf("getting current branch: %w", err)
+	}
+	def, err := git.DefaultBranch(cfg.Repo, "origin")
+	if err != nil && !cfg.RequireBranch {
+		verbosef("default branch unknown: %v", err)
+		return nil
+	}
 	if err != nil {
-		return fmt.Errorf("getting commit log: %w", err)
+		return fmt.Errorf("detecting the default branch: %w", err)
+	}
+	verbosef("releasing from branch %q; default branch of origin is %q", current, def)
+	if !cfg.RequireBranch {
+		return nil
+	}
+
+	switch {
+	case def == "":
+		return invalid(fmt.Errorf("--require-branch: cannot determine the default branch of origin; check that origin exists and run `git remote set-head origin --auto`"))
+	case current == "":
+		return invalid(fmt.Errorf("--require-branch: HEAD is detached; check out %s to release", def))
+	case current != def:
+		return invalid(fmt.Errorf("--require-branch: on branch %s, not the default branch %s", current, def))
 	}
+	return nil
+}
 
-	stat, err := git.DiffStat(cfg.Repo, fromGit, "HEAD")
+// checkRepo returns the absolute form of the repository path, so that every
+// message names the same place whatever the working directory, after checking
+// that it is a directory inside a git work tree. Otherwise the first git
+// command would fail far from the flag with a less helpful message.
+func checkRepo(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", invalid(fmt.Errorf("repo path %q not accessible: %w", path, err))
+	}
+	abs, err := filepath.Abs(path)
 	if err != nil {
-		return fmt.Errorf("getting diff stat: %w", err)
+		return "", invalid(fmt.Errorf("resolving repo path %q: %w", path, err))
+	}
+	if !info.IsDir() {
+		return "", invalid(fmt.Errorf("repo path %s is a file, not a directory", abs))
 	}
+	if !git.IsWorkTree(abs) {
+		return "", invalid(fmt.Errorf("path %s is not a git repository (or is a bare one, without a work tree)", abs))
+	}
+	return abs, nil
+}
 
-	// Decide diff strategy.
-	var fullDiff string
-	totalChanged := git.ParseTotalChangedLines(stat)
-	if totalChanged <= cfg.MaxDiff {
-		fullDiff, err = git.FullDiff(cfg.Repo, fromGit, "HEAD")
+// gather collects the commits, diff stat, and (when under --max-diff) the full
+// diff for from..to in repo, for just the --commits-file commits, or for the
+// uncommitted changes on top of from with --working-tree. With
+// --max-parallel-git above 1, the commit log and the diff are read at the same
+// time, unless --ignored-diff exclude makes the diff depend on the log.
+func gather(cfg config, repo, from, to string) (ai.Changes, error) {
+	var c ai.Changes
+	diffOpts := git.DiffOptions{
+		Exclude:          cfg.Not,
+		Only:             cfg.selected,
+		Context:          cfg.DiffContext,
+		FunctionContext:  cfg.FunctionContext,
+		IgnoreWhitespace: cfg.IgnoreWhitespace,
+		Omit:             cfg.omit,
+		NoDiff:           cfg.NoDiffFor,
+		WorkTree:         cfg.WorkingTree,
+		Staged:           cfg.Staged,
+	}
+
+	var ignored []git.Commit
+	readLog := func() error {
+		var err error
+		switch {
+		case cfg.WorkingTree:
+			// Uncommitted changes have no commits; runWorkingTree adds the
+			// prepared message, if any.
+		case len(cfg.selected) > 0:
+			c.Commits, err = git.LookupCommits(repo, cfg.selected)
+		default:
+			c.Commits, err = git.CommitLog(repo, from, to, cfg.Not...)
+		}
+		if err != nil {
+			return fmt.Errorf("getting commit log: %w", err)
+		}
+		if len(cfg.skip) > 0 {
+			c.Commits = slices.DeleteFunc(c.Commits, func(c git.Commit) bool {
+				return slices.ContainsFunc(cfg.skip, func(sha string) bool { return strings.HasPrefix(sha, c.SHA) })
+			})
+		}
+		if len(cfg.IgnoreAuthor) > 0 || cfg.IgnoreBots {
+			c.Commits, ignored = ignoreAuthors(cfg, c.Commits)
+		}
+		return nil
+	}
+	readDiff := func() error {
+		var err error
+		c.DiffStat, c.FullDiff, err = gatherDiff(cfg, repo, from, to, diffOpts)
+		return err
+	}
+
+	excludeIgnored := (len(cfg.IgnoreAuthor) > 0 || cfg.IgnoreBots) && cfg.IgnoredDiff == "exclude"
+	if cfg.MaxParallelGit > 1 && !excludeIgnored {
+		err := runParallel(cfg.MaxParallelGit, readLog, readDiff)
+		if len(ignored) > 0 {
+			fmt.Fprintf(os.Stderr, "info: left out %d commit(s) by ignored authors\n", len(ignored))
+		}
+		if err == nil && c.FullDiff != "" && preferCommits(cfg, c.Commits) {
+			c.FullDiff = ""
+		}
+		return c, err
+	}
+
+	if err := readLog(); err != nil {
+		return c, err
+	}
+	if len(ignored) > 0 {
+		fmt.Fprintf(os.Stderr, "info: left out %d commit(s) by ignored authors\n", len(ignored))
+		if excludeIgnored {
+			if len(c.Commits) == 0 {
+				return c, nil
+			}
+			diffOpts.Only = nil
+			for _, kept := range c.Commits {
+				diffOpts.Only = append(diffOpts.Only, kept.SHA)
+			}
+		}
+	}
+	if err := readDiff(); err != nil {
+		return c, err
+	}
+	if c.FullDiff != "" && preferCommits(cfg, c.Commits) {
+		c.FullDiff = ""
+	}
+	return c, nil
+}
+
+// preferCommits reports whether, with --prefer-commits, commits describe the
+// range well enough to leave out the full diff: at least
+// --prefer-commits-threshold percent of them are descriptive conventional
+// commits. The decision is logged either way.
+func preferCommits(cfg config, commits []git.Commit) bool {
+	if !cfg.PreferCommits || len(commits) == 0 {
+		return false
+	}
+	n := 0
+	for _, c := range commits {
+		if ai.IsDescriptive(c) {
+			n++
+		} else {
+			verbosef("--prefer-commits: %s %q is not a descriptive conventional commit", c.SHA, c.Subject)
+		}
+	}
+	pct := n * 100 / len(commits)
+	if pct < cfg.PreferThreshold {
+		fmt.Fprintf(os.Stderr, "info: --prefer-commits: keeping the full diff; %d of %d commit(s) (%d%%) are descriptive, below %d%%\n", n, len(commits), pct, cfg.PreferThreshold)
+		return false
+	}
+	fmt.Fprintf(os.Stderr, "info: --prefer-commits: leaving out the full diff; %d of %d commit(s) (%d%%) are descriptive\n", n, len(commits), pct)
+	return true
+}
+
+// gatherDiff returns the diff stat of from..to under diffOpts, capped by
+// capStat, and, when the stat shows it is under --max-diff, the full diff. With --max-parallel-git 3
+// or more, the full diff is read alongside the stat and dropped if the stat
+// rules it out, trading some wasted work for time on large ranges.
+func gatherDiff(cfg config, repo, from, to string, diffOpts git.DiffOptions) (stat, full string, err error) {
+	if len(cfg.IncludeExt) > 0 || len(cfg.ExcludeExt) > 0 {
+		files, err := git.ChangedFiles(repo, from, to, diffOpts)
 		if err != nil {
+			return "", "", fmt.Errorf("listing changed files: %w", err)
+		}
+		diffOpts.Paths = filterByExt(files, extSet(cfg.IncludeExt), extSet(cfg.ExcludeExt))
+		fmt.Fprintf(os.Stderr, "info: extension filter kept %d of %d changed file(s)\n", len(diffOpts.Paths), len(files))
+		if len(diffOpts.Paths) == 0 {
+			return "", "", nil // nothing left to diff; the commits still describe the range
+		}
+	}
+
+	readStat := func() error {
+		var err error
+		if stat, err = git.DiffStat(repo, from, to, diffOpts); err != nil {
+			return fmt.Errorf("getting diff stat: %w", err)
+		}
+		stat, err = capStat(cfg, stat, func() (string, error) {
+			return git.DiffNumstat(repo, from, to, diffOpts)
+		})
+		return err
+	}
+	readFull := func() error {
+		var err error
+		if full, err = git.FullDiff(repo, from, to, diffOpts); err != nil {
 			return fmt.Errorf("getting full diff: %w", err)
 		}
-		fmt.Fprintf(os.Stderr, "info: including full diff (%d lines changed)\n", totalChanged)
+		return nil
+	}
+	speculative := cfg.MaxParallelGit >= 3
+	if speculative {
+		err = runParallel(2, readStat, readFull)
 	} else {
+		err = readStat()
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	// Decide diff strategy.
+	totalChanged := git.ParseTotalChangedLines(stat)
+	if cfg.MaxDiffPerDir > 0 {
+		if !speculative {
+			if err := readFull(); err != nil {
+				return "", "", err
+			}
+		}
+		return stat, capDiff(cfg, full, totalChanged), nil
+	}
+	if totalChanged > cfg.MaxDiff {
 		fmt.Fprintf(os.Stderr, "info: stat-only mode (%d lines changed, threshold %d)\n", totalChanged, cfg.MaxDiff)
+		return stat, "", nil
+	}
+	if !speculative {
+		if err := readFull(); err != nil {
+			return "", "", err
+		}
 	}
+	fmt.Fprintf(os.Stderr, "info: including full diff (%d lines changed)\n", totalChanged)
+	return stat, full, nil
+}
 
-	// Build the version header the AI will use.
-	versionHeader := "## [Unreleased]"
-	if cfg.Version != "" {
-		versionHeader = fmt.Sprintf("## [%s] - %s", cfg.Version, time.Now().Format("2006-01-02"))
+// capStat returns stat, or with --max-stat-lines exceeded its roll-up by
+// top-level directory, so that the stat of a huge release still fits in the
+// prompt once the full diff is gone. numstat is read only for the roll-up,
+// which takes its exact line counts.
+func capStat(cfg config, stat string, numstat func() (string, error)) (string, error) {
+	lines := strings.Count(strings.TrimRight(stat, "\n"), "\n") + 1
+	if cfg.MaxStatLines == 0 || stat == "" || lines <= cfg.MaxStatLines {
+		return stat, nil
+	}
+	fmt.Fprintf(os.Stderr, "info: summarizing the diff stat by directory (%d lines, --max-stat-lines %d)\n", lines, cfg.MaxStatLines)
+	counts, err := numstat()
+	if err != nil {
+		return "", fmt.Errorf("getting diff numstat: %w", err)
 	}
+	return git.AggregateStat(stat, counts), nil
+}
 
-	req := ai.Request{
-		APIKey:        cfg.APIKey,
-		Model:         cfg.Model,
-		From:          fromDesc,
-		To:            "HEAD",
-		VersionHeader: versionHeader,
-		Commits:       commits,
-		DiffStat:      stat,
-		FullDiff:      fullDiff,
+// runParallel runs tasks with at most n at a time and waits for all of them.
+// The errors of every failed task are joined, in task order, so that one
+// failure does not hide another.
+func runParallel(n int, tasks ...func() error) error {
+	errs := make([]error, len(tasks))
+	sem := make(chan struct{}, max(n, 1))
+	var wg sync.WaitGroup
+	for i, task := range tasks {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			errs[i] = task()
+		}()
 	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
 
-	if cfg.Version != "" {
-		// Release mode: buffer output → prepend to CHANGELOG.md → create tag.
-		var buf bytes.Buffer
-		req.Out = &buf
-		if err := ai.GenerateChangelog(context.Background(), req); err != nil {
-			return err
+// ignoreAuthors splits commits into those to describe and those whose author
+// matches --ignore-author or, with --ignore-bots, is a bot.
+func ignoreAuthors(cfg config, commits []git.Commit) (kept, ignored []git.Commit) {
+	for _, c := range commits {
+		drop := cfg.IgnoreBots && git.IsBot(c)
+		for _, pattern := range cfg.IgnoreAuthor {
+			drop = drop || git.MatchesAuthor(c, pattern)
 		}
-
-		changelogPath := filepath.Join(cfg.Repo, "CHANGELOG.md")
-		if cfg.Output != "" {
-			changelogPath = cfg.Output
+		if drop {
+			verbosef("ignoring %s %q by %s", c.SHA, c.Subject, c.Author)
+			ignored = append(ignored, c)
+		} else {
+			kept = append(kept, c)
 		}
-		if err := updateChangelogFile(changelogPath, buf.String()); err != nil {
-			return fmt.Errorf("updating %s: %w", changelogPath, err)
+	}
+	return kept, ignored
+}
+
+// capDiff limits each top-level directory of full to --max-diff-per-dir
+// changed lines. --max-diff then applies to what is left, so a single noisy
+// directory cannot force stat-only mode on its own; "" means stat-only.
+func capDiff(cfg config, full string, totalChanged int) string {
+	capped, omitted := git.CapDiffPerDir(full, cfg.MaxDiffPerDir)
+	kept := totalChanged
+	for dir, n := range omitted {
+		kept -= n
+		if dir == "" {
+			dir = "the repository root"
 		}
-		fmt.Fprintf(os.Stderr, "info: updated %s\n", changelogPath)
+		verbosef("--max-diff-per-dir: omitted %d changed line(s) in %s", n, dir)
+	}
+	if len(omitted) > 0 {
+		fmt.Fprintf(os.Stderr, "info: --max-diff-per-dir capped %d director(ies); %d of %d changed lines remain\n", len(omitted), kept, totalChanged)
+	}
+	if kept > cfg.MaxDiff {
+		fmt.Fprintf(os.Stderr, "info: stat-only mode (%d lines changed after the per-directory cap, threshold %d)\n", kept, cfg.MaxDiff)
+		return ""
+	}
+	fmt.Fprintf(os.Stderr, "info: including full diff (%d lines changed)\n", kept)
+	return capped
+}
 
-		if err := git.Commit(cfg.Repo, "Release "+cfg.Version, changelogPath); err != nil {
-			return err
+// noExt names files without an extension in --include-ext and --exclude-ext.
+const noExt = "none"
+
+// extSet normalizes extension flag values, which may be comma-separated and
+// written with or without the leading dot, into a lower-case set.
+func extSet(values []string) map[string]bool {
+	set := map[string]bool{}
+	for _, v := range values {
+		for _, ext := range strings.Split(v, ",") {
+			if ext = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), ".")); ext != "" {
+				set[ext] = true
+			}
 		}
-		fmt.Fprintf(os.Stderr, "info: committed %s\n", changelogPath)
+	}
+	return set
+}
 
-		if err := git.CreateTag(cfg.Repo, cfg.Version, "Release "+cfg.Version); err != nil {
-			return err
+// filterByExt returns the files whose extension is in include (when it is
+// non-empty) and not in exclude. A file without an extension matches only
+// the noExt entry, so it is dropped by any --include-ext that does not list
+// "none" and kept by --exclude-ext unless that lists it.
+func filterByExt(files []string, include, exclude map[string]bool) []string {
+	kept := []string{} // non-nil: an empty result still filters
+	for _, f := range files {
+		ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(f), "."))
+		if ext == "" {
+			ext = noExt
 		}
-		fmt.Fprintf(os.Stderr, "info: created tag %s\n", cfg.Version)
-		fmt.Fprintf(os.Stderr, "next: git push && git push --tags\n")
+		if (len(include) > 0 && !include[ext]) || exclude[ext] {
+			continue
+		}
+		kept = append(kept, f)
+	}
+	return kept
+}
+
+// preflight makes sure the prompt for req fits in the model's context window
+// alongside the reserved output tokens. An oversized prompt first falls back to
+// stat-only mode, as an oversized diff does; if it still does not fit, the run
+// fails before sending anything.
+func preflight(cfg config, req *ai.Request) error {
+	budget := cfg.MaxContext - ai.MaxTokens
+	tokens := promptTokens(*req, budget)
+	if tokens <= budget {
 		return nil
 	}
 
-	// Preview mode: stream directly to stdout or --output file.
-	var out io.Writer = os.Stdout
-	if cfg.Output != "" {
-		f, err := os.Create(cfg.Output)
-		if err != nil {
-			return fmt.Errorf("opening output file: %w", err)
+	if hasFullDiff(*req) {
+		fmt.Fprintf(os.Stderr, "info: prompt is ~%d tokens, over the %d-token budget — switching to stat-only mode\n", tokens, budget)
+		req.FullDiff = ""
+		req.Repos = append([]ai.Changes(nil), req.Repos...) // don't modify the caller's slice
+		for i := range req.Repos {
+			req.Repos[i].FullDiff = ""
+		}
+		if tokens = promptTokens(*req, budget); tokens <= budget {
+			return nil
 		}
-		defer f.Close()
-		out = f
 	}
-	req.Out = out
-	return ai.GenerateChangelog(context.Background(), req)
+	return invalid(fmt.Errorf("prompt is ~%d tokens but only %d fit (context %d minus %d reserved for output); narrow the range or raise --max-context", tokens, budget, cfg.MaxContext, ai.MaxTokens))
+}
+
+// printBreakdown reports the estimated size of each part of req's prompt for
+// --profile, largest first.
+func printBreakdown(req ai.Request) {
+	sections := ai.PromptBreakdown(req)
+	total := 0
+	for _, s := range sections {
+		total += s.Tokens
+	}
+	fmt.Fprintf(os.Stderr, "info: prompt breakdown, ~%d tokens estimated:\n", total)
+	for _, s := range sections {
+		fmt.Fprintf(os.Stderr, "  %-24s %8d  %5.1f%%\n", s.Name, s.Tokens, 100*float64(s.Tokens)/float64(max(total, 1)))
+	}
+}
+
+// preciseCountShare is the share of the token budget, in percent, from which
+// the prompt is counted with the API rather than estimated. Below it, the
+// estimate is trusted, saving a round trip per request for the common small
+// prompt.
+const preciseCountShare = 75
+
+// promptTokens returns the prompt's tokens: the local estimate while it is
+// well under budget, and otherwise the count of the API, which only a prompt
+// near or over the budget needs. It falls back to the estimate when counting
+// is unavailable.
+func promptTokens(req ai.Request, budget int) int {
+	estimate := ai.EstimateTokens(req)
+	if generator.Provider != nil || estimate < budget*preciseCountShare/100 {
+		return estimate
+	}
+	n, err := ai.CountTokens(context.Background(), req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "info: token counting unavailable (%v); using an estimate\n", err)
+		return estimate
+	}
+	return n
+}
+
+// hasFullDiff reports whether req includes any full diff.
+func hasFullDiff(req ai.Request) bool {
+	if req.FullDiff != "" {
+		return true
+	}
+	for _, r := range req.Repos {
+		if r.FullDiff != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// checkOutput runs the enabled post-generation checks on the changelog text.
+// Problems are reported to stderr, and returned as an error under --strict.
+func checkOutput(cfg config, changelog string, req ai.Request) error {
+	if !cfg.CheckHallucinations {
+		return nil
+	}
+	findings := ai.CheckHallucinations(changelog, req)
+	for _, f := range findings {
+		fmt.Fprintf(os.Stderr, "warning: possible hallucination (%s not in input): %s\n", strings.Join(f.Missing, ", "), f.Bullet)
+	}
+	if cfg.Strict && len(findings) > 0 {
+		return fmt.Errorf("%d bullet(s) reference files or identifiers not present in the input", len(findings))
+	}
+	return nil
+}
+
+// stringList is a flag.Value collecting each occurrence of a repeatable flag.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
 }
 
 // semver holds a parsed semantic version.
-type semver struct{ major, minor, patch int }
+type semver struct {
+	major, minor, patch int
+	pre                 string // pre-release identifiers after "-", e.g. "rc.1"; empty for a final release
+}
 
 func parseSemver(v string) (semver, error) {
 	stripped := strings.TrimPrefix(v, "v")
+	if i := strings.IndexByte(stripped, '+'); i != -1 {
+		stripped = stripped[:i] // build metadata does not affect ordering
+	}
+	var sv semver
+	if core, pre, ok := strings.Cut(stripped, "-"); ok {
+		if !prereleaseRe.MatchString(pre) {
+			return semver{}, fmt.Errorf("version %q: invalid pre-release %q", v, pre)
+		}
+		stripped, sv.pre = core, pre
+	}
 	parts := strings.SplitN(stripped, ".", 3)
 	if len(parts) != 3 {
 		return semver{}, fmt.Errorf("version %q must be in vMAJOR.MINOR.PATCH format (e.g. v1.2.0)", v)
 	}
-	var sv semver
 	var err error
 	if sv.major, err = strconv.Atoi(parts[0]); err != nil {
 		return semver{}, fmt.Errorf("version %q: invalid major component", v)
@@ -198,6 +2360,12 @@ func parseSemver(v string) (semver, error) {
 	return sv, nil
 }
 
+// prereleaseRe matches dot-separated semver pre-release identifiers.
+var prereleaseRe = regexp.MustCompile(`^[0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*$`)
+
+// greaterThan orders versions as semver does: a pre-release comes before the
+// final release of the same version, and pre-releases compare identifier by
+// identifier, numerically where both are numbers.
 func (a semver) greaterThan(b semver) bool {
 	if a.major != b.major {
 		return a.major > b.major
@@ -205,12 +2373,116 @@ func (a semver) greaterThan(b semver) bool {
 	if a.minor != b.minor {
 		return a.minor > b.minor
 	}
-	return a.patch > b.patch
+	if a.patch != b.patch {
+		return a.patch > b.patch
+	}
+	if a.pre == "" || b.pre == "" {
+		return a.pre == "" && b.pre != ""
+	}
+	ap, bp := strings.Split(a.pre, "."), strings.Split(b.pre, ".")
+	for i := 0; i < len(ap) && i < len(bp); i++ {
+		if ap[i] == bp[i] {
+			continue
+		}
+		an, aErr := strconv.Atoi(ap[i])
+		bn, bErr := strconv.Atoi(bp[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			return an > bn
+		case aErr == nil || bErr == nil:
+			return bErr == nil // numeric identifiers sort first
+		default:
+			return ap[i] > bp[i]
+		}
+	}
+	return len(ap) > len(bp)
+}
+
+// prereleaseIDRe matches a --prerelease identifier.
+var prereleaseIDRe = regexp.MustCompile(`^[A-Za-z][0-9A-Za-z-]*$`)
+
+// nextPrerelease returns the next pre-release of version with identifier id:
+// version-id.N, numbered one past the highest such tag, starting at 1.
+func nextPrerelease(repo, version, id string) (string, error) {
+	prefix := version + "-" + id + "."
+	tags, err := git.ListTags(repo, prefix+"*")
+	if err != nil {
+		return "", fmt.Errorf("listing pre-release tags: %w", err)
+	}
+	last := 0
+	for _, t := range tags {
+		if n, err := strconv.Atoi(strings.TrimPrefix(t, prefix)); err == nil && n > last {
+			last = n
+		}
+	}
+	return prefix + strconv.Itoa(last+1), nil
+}
+
+// prereleaseHeadingPrefix returns the start of the changelog headings of the
+// pre-releases of version in the given style.
+func prereleaseHeadingPrefix(style ai.Style, version string) string {
+	if style == ai.StyleNews {
+		return newsEntryPrefix + strings.TrimPrefix(version, "v") + "-"
+	}
+	return "## [" + version + "-"
+}
+
+// versionScheme is how release versions are numbered (--versioning).
+type versionScheme string
+
+const (
+	schemeSemver versionScheme = "semver" // vMAJOR.MINOR.PATCH
+	schemeCalVer versionScheme = "calver" // YYYY.MM.MICRO
+)
+
+// parseVersionScheme validates a --versioning value.
+func parseVersionScheme(s string) (versionScheme, error) {
+	switch sc := versionScheme(s); sc {
+	case schemeSemver, schemeCalVer:
+		return sc, nil
+	}
+	return "", fmt.Errorf("unknown versioning %q (want semver or calver)", s)
+}
+
+// calver holds a parsed calendar version such as 2026.02.1: the year and
+// month of the release and a counter within the month.
+type calver struct{ year, month, micro int }
+
+func parseCalVer(v string) (calver, error) {
+	parts := strings.Split(strings.TrimPrefix(v, "v"), ".")
+	if len(parts) != 3 || len(parts[0]) != 4 {
+		return calver{}, fmt.Errorf("version %q must be in YYYY.MM.MICRO format (e.g. 2026.02.0)", v)
+	}
+	var cv calver
+	var err error
+	if cv.year, err = strconv.Atoi(parts[0]); err != nil {
+		return calver{}, fmt.Errorf("version %q: invalid year", v)
+	}
+	if cv.month, err = strconv.Atoi(parts[1]); err != nil || cv.month < 1 || cv.month > 12 {
+		return calver{}, fmt.Errorf("version %q: invalid month", v)
+	}
+	if cv.micro, err = strconv.Atoi(parts[2]); err != nil || cv.micro < 0 {
+		return calver{}, fmt.Errorf("version %q: invalid micro component", v)
+	}
+	return cv, nil
+}
+
+func (a calver) greaterThan(b calver) bool {
+	if a.year != b.year {
+		return a.year > b.year
+	}
+	if a.month != b.month {
+		return a.month > b.month
+	}
+	return a.micro > b.micro
 }
 
-// validateNewVersion ensures newVersion is valid semver and strictly greater
-// than lastTag (if one exists).
-func validateNewVersion(newVersion, lastTag string) error {
+// validateNewVersion ensures newVersion is valid under scheme and strictly
+// greater than lastTag (if one exists).
+func validateNewVersion(scheme versionScheme, newVersion, lastTag string) error {
+	if scheme == schemeCalVer {
+		return validateNewCalVer(newVersion, lastTag)
+	}
 	newSV, err := parseSemver(newVersion)
 	if err != nil {
 		return err
@@ -228,36 +2500,26 @@ func validateNewVersion(newVersion, lastTag string) error {
 	return nil
 }
 
-// updateChangelogFile prepends entry to the Keep a Changelog file at path,
-// creating the file with a standard header if it does not yet exist.
-func updateChangelogFile(path, entry string) error {
-	const fileHeader = "# Changelog\n\nAll notable changes to this project will be documented in this file.\n\nThe format is based on [Keep a Changelog](https://keepachangelog.com/en/1.1.0/),\nand this project adheres to [Semantic Versioning](https://semver.org/spec/v2.0.0.html).\n"
-
-	existing, err := os.ReadFile(path)
-	if err != nil && !errors.Is(err, os.ErrNotExist) {
+// validateNewCalVer is validateNewVersion for calendar versions. A release
+// dated after the current month is rejected as a likely typo.
+func validateNewCalVer(newVersion, lastTag string) error {
+	newCV, err := parseCalVer(newVersion)
+	if err != nil {
 		return err
 	}
-
-	entry = strings.TrimRight(entry, "\n")
-
-	var result string
-	if len(existing) == 0 {
-		result = fileHeader + "\n" + entry + "\n"
-	} else {
-		content := string(existing)
-		// Find the first "## [" section to insert before.
-		idx := strings.Index(content, "\n## [")
-		if idx == -1 {
-			result = strings.TrimRight(content, "\n") + "\n\n" + entry + "\n"
-		} else {
-			before := strings.TrimRight(content[:idx], "\n")
-			after := content[idx+1:] // starts at "## ["
-			result = before + "\n\n" + entry + "\n\n" + after
-			if !strings.HasSuffix(result, "\n") {
-				result += "\n"
-			}
-		}
+	now := time.Now()
+	if (calver{newCV.year, newCV.month, 0}).greaterThan(calver{now.Year(), int(now.Month()), 0}) {
+		return fmt.Errorf("version %s is dated after the current month (%d.%02d)", newVersion, now.Year(), int(now.Month()))
 	}
-
-	return os.WriteFile(path, []byte(result), 0644)
+	if lastTag == "" {
+		return nil
+	}
+	lastCV, err := parseCalVer(lastTag)
+	if err != nil {
+		return fmt.Errorf("last tag %q is not a valid calendar version; cannot compare versions", lastTag)
+	}
+	if !newCV.greaterThan(lastCV) {
+		return fmt.Errorf("version %s must be greater than the last release tag %s", newVersion, lastTag)
+	}
+	return nil
 }
@@ -0,0 +1,457 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMain runs the tool itself when the test binary is started by runTool,
+// so that end-to-end tests go through flag parsing and exit codes.
+func TestMain(m *testing.M) {
+	if os.Getenv("CHANGELOG_TEST_RUN_MAIN") == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// testGitEnv gives git commands in tests an identity and keeps the user's
+// global and system config out.
+func testGitEnv(home string) []string {
+	return append(os.Environ(),
+		"HOME="+home, "XDG_CONFIG_HOME="+filepath.Join(home, ".config"), "GIT_CONFIG_GLOBAL="+filepath.Join(home, ".gitconfig"), "GIT_CONFIG_NOSYSTEM=1",
+		"GIT_AUTHOR_NAME=Test", "GIT_AUTHOR_EMAIL=test@example.com", "GIT_COMMITTER_NAME=Test", "GIT_COMMITTER_EMAIL=test@example.com",
+	)
+}
+
+// newTestRepo creates an empty repository in a temporary directory.
+func newTestRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	runTestGit(t, dir, "init", "-q", "-b", "main")
+	return dir
+}
+
+// runTestGit runs git with args in repo and returns its trimmed output.
+func runTestGit(t *testing.T, repo string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir, cmd.Env = repo, testGitEnv(t.TempDir())
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// commitTestFile writes content to name in repo and commits it.
+func commitTestFile(t *testing.T, repo, name, content, message string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(repo, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runTestGit(t, repo, "add", name)
+	runTestGit(t, repo, "commit", "-q", "-m", message)
+}
+
+// runTool runs the tool with args in repo with the fake provider and returns
+// its stdout and stderr.
+func runTool(t *testing.T, repo string, args ...string) (stdout, stderr string, err error) {
+	t.Helper()
+	return runToolIn(t, repo, repo, args...)
+}
+
+// runToolIn is runTool with dir as the working directory.
+func runToolIn(t *testing.T, dir, repo string, args ...string) (stdout, stderr string, err error) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], append([]string{"--repo", repo, "--provider", "fake"}, args...)...)
+	cmd.Dir = dir
+	cmd.Env = append(testGitEnv(t.TempDir()), "CHANGELOG_TEST_RUN_MAIN=1")
+	var out, errOut bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &errOut
+	err = cmd.Run()
+	return out.String(), errOut.String(), err
+}
+
+func TestFirstCommitWithoutTags(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		args []string
+		want string // in the entry
+	}{
+		{"preview", nil, "## [Unreleased]"},
+		{"release", []string{"--version", "0.1.0", "--yes"}, "## [0.1.0] - "},
+		{"since the last run", []string{"--since-last-run"}, "## [Unreleased]"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := newTestRepo(t)
+			commitTestFile(t, repo, "main.go", "package main\n", "feat: first commit")
+			stdout, stderr, err := runTool(t, repo, tc.args...)
+			if err != nil {
+				t.Fatalf("run failed: %v\n%s", err, stderr)
+			}
+			for _, bad := range []string{"HEAD~1", "describe", "fatal:"} {
+				if strings.Contains(stderr, bad) {
+					t.Errorf("stderr mentions %q:\n%s", bad, stderr)
+				}
+			}
+			entry := stdout
+			if tc.name == "release" {
+				data, err := os.ReadFile(filepath.Join(repo, "CHANGELOG.md"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				entry = string(data)
+			}
+			if !strings.Contains(entry, tc.want) || !strings.Contains(entry, "first commit") {
+				t.Errorf("entry is missing %q or the commit:\n%s", tc.want, entry)
+			}
+		})
+	}
+}
+
+func TestStrictHallucinationCheckFails(t *testing.T) {
+	// The fake provider only repeats the commits, so --post-process adds the
+	// bullet naming a file that is in none of them.
+	addBullet := `cat; echo '- Rewrote the parser in ghost_parser.go'`
+	for _, tc := range []struct {
+		name string
+		args []string
+	}{
+		{"preview", nil},
+		{"release", []string{"--version", "0.2.0", "--yes"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := newTestRepo(t)
+			commitTestFile(t, repo, "main.go", "package main\n", "feat: first commit")
+			args := append([]string{"--check-hallucinations", "--strict", "--post-process", addBullet}, tc.args...)
+			stdout, stderr, err := runTool(t, repo, args...)
+			if exit, ok := err.(*exec.ExitError); !ok || exit.ExitCode() != 1 {
+				t.Fatalf("run error = %v, want exit code 1\n%s", err, stderr)
+			}
+			if !strings.Contains(stderr, "ghost_parser.go not in input") {
+				t.Errorf("stderr does not report the bullet:\n%s", stderr)
+			}
+			if stdout != "" {
+				t.Errorf("failing entry was printed:\n%s", stdout)
+			}
+			if _, err := os.Stat(filepath.Join(repo, "CHANGELOG.md")); !os.IsNotExist(err) {
+				t.Errorf("CHANGELOG.md was written: %v", err)
+			}
+		})
+	}
+}
+
+func TestSplitByTags(t *testing.T) {
+	repo := newTestRepo(t)
+	commitTestFile(t, repo, "README", "widget\n", "chore: start")
+	runTestGit(t, repo, "tag", "v0.9.0")
+	commitTestFile(t, repo, "a.txt", "one\n", "feat: first feature")
+	runTestGit(t, repo, "tag", "v1.0.0")
+	commitTestFile(t, repo, "b.txt", "two\n", "fix: second fix")
+	runTestGit(t, repo, "tag", "v1.1.0")
+	commitTestFile(t, repo, "c.txt", "three\n", "feat: third feature")
+
+	for _, tc := range []struct {
+		name  string
+		args  []string
+		order []string // headings, then the commit of each entry
+	}{
+		{"newest first", nil, []string{"## [Unreleased]", "third feature", "## [v1.1.0] - ", "second fix", "## [v1.0.0] - ", "first feature"}},
+		{"oldest first", []string{"--order", "oldest-first"}, []string{"## [v1.0.0] - ", "first feature", "## [v1.1.0] - ", "second fix", "## [Unreleased]", "third feature"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			stdout, stderr, err := runTool(t, repo, append([]string{"--since-tag", "v0.9.0", "--split-by-tags"}, tc.args...)...)
+			if err != nil {
+				t.Fatalf("run failed: %v\n%s", err, stderr)
+			}
+			rest := stdout
+			for _, want := range tc.order {
+				i := strings.Index(rest, want)
+				if i == -1 {
+					t.Fatalf("output is missing %q after the earlier entries:\n%s", want, stdout)
+				}
+				rest = rest[i+len(want):]
+			}
+			if n := strings.Count(stdout, "## ["); n != 3 {
+				t.Errorf("output has %d entries, want 3:\n%s", n, stdout)
+			}
+		})
+	}
+}
+
+func TestSplitByTagsJSONIsArray(t *testing.T) {
+	repo := newTestRepo(t)
+	commitTestFile(t, repo, "README", "widget\n", "chore: start")
+	runTestGit(t, repo, "tag", "v0.9.0")
+	commitTestFile(t, repo, "a.txt", "one\n", "feat: first feature")
+	runTestGit(t, repo, "tag", "v1.0.0")
+	commitTestFile(t, repo, "b.txt", "two\n", "fix: second fix")
+
+	for _, tc := range []struct {
+		since string
+		want  int // entries
+	}{
+		{"v1.0.0", 1},
+		{"v0.9.0", 2},
+	} {
+		t.Run(tc.since, func(t *testing.T) {
+			stdout, stderr, err := runTool(t, repo, "--since-tag", tc.since, "--split-by-tags", "--format", "json")
+			if err != nil {
+				t.Fatalf("run failed: %v\n%s", err, stderr)
+			}
+			var entries []map[string]any
+			if err := json.Unmarshal([]byte(stdout), &entries); err != nil {
+				t.Fatalf("output is not a JSON array: %v\n%s", err, stdout)
+			}
+			if len(entries) != tc.want {
+				t.Errorf("output has %d entries, want %d:\n%s", len(entries), tc.want, stdout)
+			}
+		})
+	}
+}
+
+func TestReleaseWithoutTerminalFailsEarly(t *testing.T) {
+	repo := newTestRepo(t)
+	commitTestFile(t, repo, "main.go", "package main\n", "feat: first commit")
+	_, stderr, err := runTool(t, repo, "--version", "0.1.0")
+	if exit, ok := err.(*exec.ExitError); !ok || exit.ExitCode() != exitValidation {
+		t.Fatalf("run error = %v, want exit code %d\n%s", err, exitValidation, stderr)
+	}
+	if !strings.Contains(stderr, "needs a terminal") {
+		t.Errorf("stderr does not explain the refusal:\n%s", stderr)
+	}
+	if strings.Contains(stderr, "release tag") {
+		t.Errorf("history was read before the refusal:\n%s", stderr)
+	}
+}
+
+func TestHeadlineRejectsRewrites(t *testing.T) {
+	repo := newTestRepo(t)
+	commitTestFile(t, repo, "main.go", "package main\n", "feat: first commit")
+	for _, args := range [][]string{
+		{"--post-process", "false"},
+		{"--sort-bullets", "alpha"},
+		{"--cite-commits"},
+		{"--allow-sections", "Added"},
+		{"--always-sections", "Security"},
+		{"--theme", "emoji"},
+		{"--jira-base-url", "https://acme.atlassian.net"},
+		{"--full-changelog-link"},
+	} {
+		t.Run(args[0], func(t *testing.T) {
+			stdout, stderr, err := runTool(t, repo, append([]string{"--headline"}, args...)...)
+			if exit, ok := err.(*exec.ExitError); !ok || exit.ExitCode() != exitValidation {
+				t.Fatalf("run error = %v, want exit code %d\n%s", err, exitValidation, stderr)
+			}
+			if stdout != "" {
+				t.Errorf("headline was printed:\n%s", stdout)
+			}
+		})
+	}
+}
+
+func TestFormatRejectedForFragments(t *testing.T) {
+	for _, args := range [][]string{
+		{"--accumulate", "--format", "html"},
+		{"--accumulate", "--format", "json"},
+		{"--single", "HEAD", "--format", "html"},
+	} {
+		t.Run(strings.Join(args, " "), func(t *testing.T) {
+			repo := newTestRepo(t)
+			commitTestFile(t, repo, "main.go", "package main\n", "feat: first commit")
+			_, stderr, err := runTool(t, repo, args...)
+			if exit, ok := err.(*exec.ExitError); !ok || exit.ExitCode() != exitValidation {
+				t.Fatalf("run error = %v, want exit code %d\n%s", err, exitValidation, stderr)
+			}
+			if _, err := os.Stat(filepath.Join(repo, "CHANGELOG.md")); !os.IsNotExist(err) {
+				t.Errorf("CHANGELOG.md was written: %v", err)
+			}
+		})
+	}
+}
+
+func TestPatchRejectsDiffShaping(t *testing.T) {
+	dir := t.TempDir()
+	patch := filepath.Join(dir, "p.diff")
+	diff := "diff --git a/infra/secrets.tf b/infra/secrets.tf\n--- a/infra/secrets.tf\n+++ b/infra/secrets.tf\n@@ -1 +1 @@\n-password=old\n+password=hunter2\n"
+	if err := os.WriteFile(patch, []byte(diff), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"--no-diff-for", "infra/*"},
+		{"--exclude-ext", "tf"},
+		{"--diff-context", "1"},
+	} {
+		t.Run(args[0], func(t *testing.T) {
+			debug := filepath.Join(t.TempDir(), "debug")
+			stdout, stderr, err := runTool(t, dir, append([]string{"--patch", patch, "--debug-dir", debug}, args...)...)
+			if exit, ok := err.(*exec.ExitError); !ok || exit.ExitCode() != exitValidation {
+				t.Fatalf("run error = %v, want exit code %d\n%s", err, exitValidation, stderr)
+			}
+			if strings.Contains(stdout+stderr, "hunter2") {
+				t.Errorf("withheld content was output:\n%s%s", stdout, stderr)
+			}
+			if prompt, err := os.ReadFile(filepath.Join(debug, "prompt.md")); err == nil && strings.Contains(string(prompt), "hunter2") {
+				t.Errorf("withheld content reached the prompt:\n%s", prompt)
+			}
+		})
+	}
+}
+
+func TestAccumulateSkipsChangelogCommits(t *testing.T) {
+	repo := newTestRepo(t)
+	commitTestFile(t, repo, "main.go", "package main\n", "feat: first commit")
+	if _, stderr, err := runTool(t, repo, "--accumulate"); err != nil {
+		t.Fatalf("run failed: %v\n%s", err, stderr)
+	}
+	if subject := runTestGit(t, repo, "log", "-1", "--format=%s"); !strings.HasPrefix(subject, "Update changelog for ") {
+		t.Fatalf("HEAD is %q, want the changelog commit", subject)
+	}
+	want, err := os.ReadFile(filepath.Join(repo, "CHANGELOG.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Run again on the changelog commit, then on a hand edit of the file.
+	for _, step := range []string{"changelog commit", "hand edit"} {
+		if step == "hand edit" {
+			want = append(want, "\nEdited by hand.\n"...)
+			commitTestFile(t, repo, "CHANGELOG.md", string(want), "docs: reword the changelog")
+		}
+		_, stderr, err := runTool(t, repo, "--accumulate")
+		if err != nil {
+			t.Fatalf("%s: run failed: %v\n%s", step, err, stderr)
+		}
+		if !strings.Contains(stderr, "only updates") {
+			t.Errorf("%s: stderr does not say the commit was skipped:\n%s", step, stderr)
+		}
+		got, err := os.ReadFile(filepath.Join(repo, "CHANGELOG.md"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != string(want) {
+			t.Errorf("%s: CHANGELOG.md changed:\n%s", step, got)
+		}
+	}
+}
+
+func TestSupersedeLeavesOutPrereleaseCommits(t *testing.T) {
+	repo := newTestRepo(t)
+	commitTestFile(t, repo, "main.go", "package main\n", "feat: first commit")
+	runTestGit(t, repo, "tag", "v1.0.0")
+	commitTestFile(t, repo, "a.go", "package main\n", "feat: add paging")
+	if _, stderr, err := runTool(t, repo, "--version", "v1.1.0", "--prerelease", "rc", "--yes"); err != nil {
+		t.Fatalf("pre-release failed: %v\n%s", err, stderr)
+	}
+	commitTestFile(t, repo, "b.go", "package main\n", "fix: empty pages")
+
+	debug := filepath.Join(t.TempDir(), "debug")
+	_, stderr, err := runTool(t, repo, "--version", "v1.1.0", "--prerelease-entries", "supersede", "--yes", "--debug-dir", debug)
+	if err != nil {
+		t.Fatalf("release failed: %v\n%s", err, stderr)
+	}
+	prompt, err := os.ReadFile(filepath.Join(debug, "prompt.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"add paging", "empty pages"} {
+		if !strings.Contains(string(prompt), want) {
+			t.Errorf("prompt is missing %q:\n%s", want, prompt)
+		}
+	}
+	for _, bad := range []string{"Release v1.1.0-rc.1", "CHANGELOG.md"} {
+		if strings.Contains(string(prompt), bad) {
+			t.Errorf("prompt mentions %q:\n%s", bad, prompt)
+		}
+	}
+}
+
+func TestRelease(t *testing.T) {
+	repo := newTestRepo(t)
+	commitTestFile(t, repo, "main.go", "package main\n", "feat: first commit")
+	runTestGit(t, repo, "tag", "-a", "v1.1.0", "-m", "Release v1.1.0")
+	commitTestFile(t, repo, "page.go", "package main\n", "feat: add paging")
+	commitTestFile(t, repo, "main.go", "package main\n\nfunc main() {}\n", "fix: exit cleanly")
+	feature := runTestGit(t, repo, "rev-parse", "--short", "HEAD~1")
+
+	stdout, stderr, err := runTool(t, repo, "--version", "v1.2.0", "--yes")
+	if err != nil {
+		t.Fatalf("release failed: %v\n%s", err, stderr)
+	}
+	if stdout != "" {
+		t.Errorf("release printed to stdout:\n%s", stdout)
+	}
+
+	changelog, err := os.ReadFile(filepath.Join(repo, "CHANGELOG.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rest := string(changelog)
+	for _, want := range []string{"## [v1.2.0] - ", "### Added", "- add paging (" + feature + ")", "### Fixed", "- exit cleanly ("} {
+		i := strings.Index(rest, want)
+		if i == -1 {
+			t.Fatalf("CHANGELOG.md is missing %q in order:\n%s", want, changelog)
+		}
+		rest = rest[i+len(want):]
+	}
+	if strings.Contains(string(changelog), "first commit") {
+		t.Errorf("CHANGELOG.md describes a commit of the previous release:\n%s", changelog)
+	}
+
+	if subject := runTestGit(t, repo, "log", "-1", "--format=%s"); subject != "Release v1.2.0" {
+		t.Errorf("release commit subject = %q, want %q", subject, "Release v1.2.0")
+	}
+	if files := runTestGit(t, repo, "show", "--format=", "--name-only", "HEAD"); files != "CHANGELOG.md" {
+		t.Errorf("release commit changes %q, want only CHANGELOG.md", files)
+	}
+	if kind := runTestGit(t, repo, "cat-file", "-t", "v1.2.0"); kind != "tag" {
+		t.Errorf("v1.2.0 is a %s, want an annotated tag", kind)
+	}
+	if tagged, head := runTestGit(t, repo, "rev-parse", "v1.2.0^{commit}"), runTestGit(t, repo, "rev-parse", "HEAD"); tagged != head {
+		t.Errorf("v1.2.0 points at %s, want the release commit %s", tagged, head)
+	}
+	if message := runTestGit(t, repo, "tag", "-l", "--format=%(contents)", "v1.2.0"); message != "Release v1.2.0" {
+		t.Errorf("tag message = %q, want %q", message, "Release v1.2.0")
+	}
+	if status := runTestGit(t, repo, "status", "--porcelain"); status != "" {
+		t.Errorf("release left changes behind:\n%s", status)
+	}
+}
+
+func TestReleaseOutputRelativeToRepo(t *testing.T) {
+	repo := newTestRepo(t)
+	commitTestFile(t, repo, "main.go", "package main\n", "feat: first commit")
+
+	elsewhere := t.TempDir()
+	if _, stderr, err := runToolIn(t, elsewhere, repo, "--version", "v0.1.0", "--output", "NOTES.md", "--yes"); err != nil {
+		t.Fatalf("release failed: %v\n%s", err, stderr)
+	}
+
+	if _, err := os.Stat(filepath.Join(elsewhere, "NOTES.md")); err == nil {
+		t.Error("NOTES.md was written to the working directory")
+	}
+	if files := runTestGit(t, repo, "show", "--format=", "--name-only", "HEAD"); files != "NOTES.md" {
+		t.Errorf("release commit changes %q, want only NOTES.md", files)
+	}
+}
+
+func TestVersionFromRelativeToRepo(t *testing.T) {
+	repo := newTestRepo(t)
+	commitTestFile(t, repo, "VERSION", "# release version\n0.3.0\n", "feat: first commit")
+
+	if _, stderr, err := runToolIn(t, t.TempDir(), repo, "--version-from", "VERSION", "--yes"); err != nil {
+		t.Fatalf("release failed: %v\n%s", err, stderr)
+	}
+	if tags := runTestGit(t, repo, "tag", "-l"); tags != "0.3.0" {
+		t.Errorf("tags = %q, want 0.3.0", tags)
+	}
+}
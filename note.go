@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nealwashere/ai-changelog-generator/internal/git"
+)
+
+// checkGitNote validates --git-note and --git-note-existing. A note replaces
+// the changelog file, so the options that shape or preview that file do not
+// apply.
+func checkGitNote(cfg config) error {
+	switch cfg.GitNoteExisting {
+	case "error", "append", "overwrite":
+	default:
+		return invalid(fmt.Errorf("unknown --git-note-existing %q (want error, append, or overwrite)", cfg.GitNoteExisting))
+	}
+	if cfg.GitNote == "" {
+		return nil
+	}
+	if cfg.Version == "" {
+		return invalid(fmt.Errorf("--git-note requires --version"))
+	}
+	if strings.TrimSpace(cfg.GitNote) != cfg.GitNote || strings.HasPrefix(cfg.GitNote, "-") {
+		return invalid(fmt.Errorf("--git-note %q is not a valid notes ref", cfg.GitNote))
+	}
+	var conflicts []string
+	for _, c := range []struct {
+		set  bool
+		name string
+	}{
+		{cfg.Output != "", "--output"},
+		{cfg.OutputDir != "", "--output-dir"},
+		{cfg.ChangelogDiff, "--changelog-diff"},
+		{cfg.Promote, "--promote"},
+		{cfg.CommitTemplate != "", "--commit-message-template"},
+		{cfg.TOC, "--toc"},
+		{cfg.FromFragments != "", "--from-fragments"},
+		{len(cfg.Locales) > 1, "more than one --locale"},
+	} {
+		if c.set {
+			conflicts = append(conflicts, c.name)
+		}
+	}
+	if len(conflicts) > 0 {
+		return invalid(fmt.Errorf("--git-note writes the entry to a note instead of the changelog file and cannot be combined with: %s", strings.Join(conflicts, ", ")))
+	}
+	return nil
+}
+
+// noteRef returns the full name of the notes ref --git-note names, as git
+// notes --ref resolves it.
+func noteRef(ref string) string {
+	if strings.HasPrefix(ref, "refs/") {
+		return ref
+	}
+	if strings.HasPrefix(ref, "notes/") {
+		return "refs/" + ref
+	}
+	return "refs/notes/" + ref
+}
+
+// writeNote attaches entry to HEAD under the --git-note ref, handling an
+// existing note as --git-note-existing says.
+func writeNote(cfg config, entry string) error {
+	entry = strings.TrimSpace(entry) + "\n"
+	add := git.AddNote
+	switch cfg.GitNoteExisting {
+	case "append":
+		add = git.AppendNote
+	case "overwrite":
+		add = git.ReplaceNote
+	}
+	if err := add(cfg.Repo, cfg.GitNote, "HEAD", entry); err != nil {
+		if cfg.GitNoteExisting == "error" {
+			return fmt.Errorf("%w (see --git-note-existing)", err)
+		}
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "info: added the entry as a note on HEAD under %s\n", noteRef(cfg.GitNote))
+	return nil
+}
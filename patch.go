@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nealwashere/ai-changelog-generator/internal/ai"
+	"github.com/nealwashere/ai-changelog-generator/internal/git"
+)
+
+// runPatch previews the changelog for the --patch file without reading any
+// repository. git format-patch output contributes one commit per message;
+// a plain diff has no commit list, so the model works from the diff alone.
+func runPatch(cfg config, logFormat ai.LogFormat) error {
+	conflicts := conflicting(append(append(rangeFlags(cfg), diffFlags(cfg)...),
+		flagUse{len(cfg.Repos) > 0, "--repos"},
+		flagUse{cfg.Replay != "", "--replay"},
+		flagUse{cfg.GoldenTest != "", "--golden-test"},
+		flagUse{cfg.EnrichLabels, "--enrich-labels"},
+		flagUse{cfg.Plan, "--plan"},
+		flagUse{cfg.GoAPIDiff, "--go-api-diff"},
+		flagUse{cfg.PreviousEntries > 0, "--previous-entries"},
+	)...)
+	if len(conflicts) > 0 {
+		return invalid(fmt.Errorf("--patch reads changes from a file instead of the repository and cannot be combined with: %s", strings.Join(conflicts, ", ")))
+	}
+
+	data, err := os.ReadFile(cfg.Patch)
+	if err != nil {
+		return invalid(fmt.Errorf("reading --patch file: %w", err))
+	}
+	commits, diff := git.ParsePatch(string(data))
+	if strings.TrimSpace(diff) == "" {
+		return fmt.Errorf("%w: %s contains no diff", errNoChanges, cfg.Patch)
+	}
+	if len(commits) == 0 && cfg.CiteCommits {
+		return invalid(fmt.Errorf("--cite-commits needs commits, but %s is a plain diff", cfg.Patch))
+	}
+	if len(commits) > 0 {
+		fmt.Fprintf(os.Stderr, "info: read %d patch(es) from %s\n", len(commits), cfg.Patch)
+	} else {
+		fmt.Fprintf(os.Stderr, "info: %s is a plain diff without commit messages\n", cfg.Patch)
+	}
+
+	req := baseRequest(cfg, logFormat)
+	req.From = "the base of " + cfg.Patch
+	req.To = "the result of applying it"
+	req.VersionHeader = versionHeader(req.Style, "", cfg.UnreleasedLabel, time.Time{})
+	req.Commits = commits
+	req.DiffStat, err = capStat(cfg, git.PatchStat(diff), func() (string, error) {
+		return git.PatchNumstat(diff), nil
+	})
+	if err != nil {
+		return err
+	}
+	switch total := git.ParseTotalChangedLines(req.DiffStat); {
+	case total > cfg.MaxDiff:
+		fmt.Fprintf(os.Stderr, "info: stat-only mode (%d lines changed, threshold %d)\n", total, cfg.MaxDiff)
+	case preferCommits(cfg, commits):
+	default:
+		req.FullDiff = diff
+		fmt.Fprintf(os.Stderr, "info: including full diff (%d lines changed)\n", total)
+	}
+	return preview(cfg, req)
+}
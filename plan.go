@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nealwashere/ai-changelog-generator/internal/ai"
+)
+
+var statSummaryRe = regexp.MustCompile(`(\d+) files? changed|(\d+) insertions?\(\+\)|(\d+) deletions?\(-\)`)
+
+// statTotals sums the files, insertions, and deletions of every summary line
+// in a git diff --stat output; the per-commit forms have one per commit.
+func statTotals(stat string) (files, ins, del int) {
+	for _, m := range statSummaryRe.FindAllStringSubmatch(stat, -1) {
+		f, _ := strconv.Atoi(m[1])
+		i, _ := strconv.Atoi(m[2])
+		d, _ := strconv.Atoi(m[3])
+		files, ins, del = files+f, ins+i, del+d
+	}
+	return files, ins, del
+}
+
+// printPlan writes the --plan summary of req to w: what the prompt would
+// cover and how, using only git and local estimates, so that a wrong range
+// shows up before the model is called.
+func printPlan(w io.Writer, cfg config, req ai.Request) {
+	fmt.Fprintf(w, "Plan for the changes from %s to %s:\n", req.From, req.To)
+
+	byType := map[string]int{}
+	var breaking []string
+	for _, c := range req.Commits {
+		t := "other"
+		if cc, ok := ai.ParseConventional(c.Subject); ok {
+			t = cc.Type
+		}
+		byType[t]++
+		if ai.IsBreaking(c) {
+			breaking = append(breaking, c.SHA+" "+c.Subject)
+		}
+	}
+	var types []string
+	for t, n := range byType {
+		types = append(types, fmt.Sprintf("%d %s", n, t))
+	}
+	sort.Strings(types)
+	if len(types) > 0 {
+		fmt.Fprintf(w, "  commits:          %d (%s)\n", len(req.Commits), strings.Join(types, ", "))
+	} else {
+		fmt.Fprintf(w, "  commits:          0\n")
+	}
+	if len(req.Fragments) > 0 {
+		fmt.Fprintf(w, "  fragments:        %d\n", len(req.Fragments))
+	}
+
+	files, ins, del := statTotals(req.DiffStat)
+	fmt.Fprintf(w, "  files changed:    %d\n", files)
+	fmt.Fprintf(w, "  insertions:       %d\n", ins)
+	fmt.Fprintf(w, "  deletions:        %d\n", del)
+	fmt.Fprintf(w, "  breaking changes: %d\n", len(breaking))
+	for _, b := range breaking {
+		fmt.Fprintf(w, "    %s\n", b)
+	}
+
+	budget := cfg.MaxContext - ai.MaxTokens
+	tokens := ai.EstimateTokens(req)
+	var mode string
+	switch {
+	case len(req.Fragments) > 0:
+		mode = "fragments only, no diff"
+	case req.FullDiff != "":
+		mode = "full diff"
+	case cfg.PreferCommits && ins+del <= cfg.MaxDiff && cfg.MaxDiffPerDir == 0:
+		mode = "stat only (--prefer-commits)"
+	default:
+		mode = fmt.Sprintf("stat only (%d lines changed, --max-diff %d)", ins+del, cfg.MaxDiff)
+	}
+	if tokens > budget && req.FullDiff != "" {
+		req.FullDiff = ""
+		tokens = ai.EstimateTokens(req)
+		mode = "stat only (the full diff would exceed the prompt budget)"
+	}
+	fmt.Fprintf(w, "  diff mode:        %s\n", mode)
+	fmt.Fprintf(w, "  prompt:           ~%d tokens estimated, budget %d\n", tokens, budget)
+	if tokens > budget {
+		fmt.Fprintf(w, "  warning:          the prompt would not fit; narrow the range or raise --max-context\n")
+	}
+}
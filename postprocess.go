@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nealwashere/ai-changelog-generator/internal/ai"
+	"github.com/nealwashere/ai-changelog-generator/internal/git"
+)
+
+// postProcessing reports whether any deterministic rewrite of the model output
+// is enabled. When it is, output is buffered rather than streamed.
+func postProcessing(cfg config) bool {
+	return cfg.Format != "markdown" || cfg.SortBullets != "" || cfg.PostProcess != "" || cfg.CiteCommits || cfg.FixMarkdown ||
+		cfg.StatDetails || cfg.icons != nil || len(cfg.allowed) > 0 || len(cfg.always) > 0 || cfg.link != "" || cfg.Provenance ||
+		cfg.MaxChars > 0 || cfg.JiraBaseURL != ""
+}
+
+// postProcess applies the enabled rewrites to the changelog generated for
+// req, starting with its upgrade notes. The --post-process command runs
+// last, so it sees the final built-in output, including the
+// --include-stat-details block, the --full-changelog-link line, and the
+// --provenance footer. --max-chars limits the entry before those are added.
+func postProcess(cfg config, req ai.Request, text string) (string, error) {
+	if cfg.SortBullets != "" || cfg.CiteCommits || len(cfg.allowed) > 0 || len(cfg.always) > 0 || len(req.UpgradeNotes) > 0 {
+		c := ai.ParseChangelog(text)
+		if len(req.UpgradeNotes) > 0 {
+			c = ai.AddUpgradeNotes(c, req.UpgradeNotes)
+		}
+		if len(cfg.allowed) > 0 {
+			var dropped []ai.Section
+			c, dropped = ai.FilterSections(c, cfg.allowed)
+			for _, s := range dropped {
+				if len(s.Bullets) > 0 || len(s.Prose) > 0 {
+					fmt.Fprintf(os.Stderr, "warning: dropped section %q with %d bullet(s), which --allow-sections does not list\n", s.Title, len(s.Bullets))
+				}
+			}
+		}
+		if len(cfg.always) > 0 {
+			var added []string
+			c, added = ai.EnsureSections(c, cfg.always, cfg.EmptySectionText)
+			for _, title := range added {
+				verbosef("--always-sections: added a placeholder for the empty %s section", title)
+			}
+		}
+		if cfg.CiteCommits {
+			var dropped []string
+			c, dropped = ai.CheckCitations(c, inputCommits(req), cfg.CiteFormat)
+			for _, sha := range dropped {
+				fmt.Fprintf(os.Stderr, "warning: removed citation of %s, which is not among the input commits\n", sha)
+			}
+		}
+		if cfg.SortBullets != "" {
+			c = ai.SortBullets(c, ai.BulletOrder(cfg.SortBullets))
+		}
+		text = c.String()
+	}
+	if cfg.FixMarkdown {
+		text = ai.FixMarkdown(text)
+	}
+	if cfg.icons != nil {
+		text = ai.ApplyTheme(text, cfg.icons)
+	}
+	if cfg.JiraBaseURL != "" {
+		text = ai.LinkJira(text, cfg.JiraBaseURL, cfg.jiraKeys)
+	}
+	if cfg.MaxChars > 0 {
+		var truncated bool
+		text, truncated = ai.TrimToLength(text, cfg.MaxChars)
+		switch n := utf8.RuneCountInString(text); {
+		case n > cfg.MaxChars:
+			// The version header and upgrade notes are never cut.
+			if cfg.Strict {
+				return "", fmt.Errorf("the entry is %d characters, over --max-chars %d: its version header and upgrade notes alone do not fit", n, cfg.MaxChars)
+			}
+			fmt.Fprintf(os.Stderr, "warning: the entry is %d characters, over --max-chars %d: its version header and upgrade notes alone do not fit\n", n, cfg.MaxChars)
+		case truncated:
+			fmt.Fprintf(os.Stderr, "warning: trimmed the entry to %d characters (--max-chars)\n", n)
+		}
+	}
+	if cfg.StatDetails {
+		text = appendStatDetails(text, req)
+	}
+	if cfg.link != "" {
+		text = strings.TrimRight(text, "\n") + "\n\n" + cfg.link + "\n"
+	}
+	if cfg.Provenance {
+		text = strings.TrimRight(text, "\n") + "\n\n" + ai.ProvenanceFooter(req, toolName+" "+toolVersion()) + "\n"
+	}
+	if cfg.PostProcess != "" {
+		var err error
+		if text, err = runPostProcess(cfg.PostProcess, cfg.Repo, text); err != nil {
+			return "", err
+		}
+	}
+	return text, nil
+}
+
+// render converts the final markdown text to format, the --format of the
+// output or one of --formats. The checks and --post-process still see
+// markdown; only what is printed, written to --output, or copied differs.
+// The JSON of --split-by-tags is always an array of entries.
+func render(cfg config, format, text string) string {
+	switch {
+	case format == "html":
+		return ai.RenderHTML(text)
+	case format == "json" && cfg.SplitByTags:
+		return ai.RenderJSONList(text)
+	case format == "json":
+		return ai.RenderJSON(text)
+	}
+	return text
+}
+
+// appendStatDetails adds a collapsed <details> block with req's diff stat
+// after the generated sections, for --include-stat-details. The stat is
+// HTML-escaped inside a <pre> element so that file names cannot break out of
+// it. text is returned unchanged when there is no stat, e.g. for fragments.
+func appendStatDetails(text string, req ai.Request) string {
+	var stats []string
+	if req.DiffStat != "" {
+		stats = append(stats, strings.TrimRight(req.DiffStat, "\n"))
+	}
+	for _, r := range req.Repos {
+		if r.DiffStat != "" {
+			stats = append(stats, r.Repo+":\n"+strings.TrimRight(r.DiffStat, "\n"))
+		}
+	}
+	if len(stats) == 0 {
+		return text
+	}
+	return strings.TrimRight(text, "\n") + "\n\n<details><summary>Changed files</summary>\n\n<pre>\n" +
+		html.EscapeString(strings.Join(stats, "\n\n")) + "\n</pre>\n\n</details>\n"
+}
+
+// inputCommits returns every commit described by req, across repositories.
+func inputCommits(req ai.Request) []git.Commit {
+	commits := req.Commits
+	for _, r := range req.Repos {
+		commits = append(commits, r.Commits...)
+	}
+	return commits
+}
+
+// runPostProcess pipes text through the shell command line command, run in
+// dir, and returns its standard output.
+func runPostProcess(command, dir, text string) (string, error) {
+	shell, flag := "sh", "-c"
+	if runtime.GOOS == "windows" {
+		shell, flag = "cmd", "/C"
+	}
+	cmd := exec.Command(shell, flag, command)
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader(text)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("--post-process %q: %w: %s", command, err, msg)
+		}
+		return "", fmt.Errorf("--post-process %q: %w", command, err)
+	}
+	if strings.TrimSpace(stdout.String()) == "" {
+		return "", fmt.Errorf("--post-process %q produced no output", command)
+	}
+	return stdout.String(), nil
+}
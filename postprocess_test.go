@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/nealwashere/ai-changelog-generator/internal/ai"
+	"github.com/nealwashere/ai-changelog-generator/internal/git"
+)
+
+func TestJiraLinksPassStrictHallucinationCheck(t *testing.T) {
+	cfg := config{
+		JiraBaseURL:         "https://acme.atlassian.net",
+		CheckHallucinations: true,
+		Strict:              true,
+	}
+	req := ai.Request{Commits: []git.Commit{{SHA: "abc1234", Subject: "fix: handle empty input in `parse` (PROJ-12)"}}}
+	text, err := postProcess(cfg, req, "## [1.0.0] - 2026-01-02\n\n### Fixed\n\n- Handle empty input in `parse` (PROJ-12)\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[PROJ-12](https://acme.atlassian.net/browse/PROJ-12)"; !strings.Contains(text, want) {
+		t.Fatalf("postProcess did not link the key:\n%s", text)
+	}
+	if err := checkOutput(cfg, text, req); err != nil {
+		t.Errorf("checkOutput: %v", err)
+	}
+}
+
+func TestMaxCharsOverrunByUpgradeNotes(t *testing.T) {
+	note := "Run `tool migrate` once before starting the new version, then rename `timeout` to `request_timeout` in config.yaml."
+	req := ai.Request{UpgradeNotes: []string{note}}
+	text := "## [2.0.0] - 2026-01-02\n\n### Added\n\n- A new paging cursor for the list endpoints.\n"
+	for _, tc := range []struct {
+		name     string
+		max      int
+		strict   bool
+		wantErr  bool
+		wantOver bool
+	}{
+		{"fits once trimmed", 200, false, false, false},
+		{"over the limit warns", 100, false, false, true},
+		{"over the limit fails with --strict", 100, true, true, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := postProcess(config{MaxChars: tc.max, Strict: tc.strict}, req, text)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("postProcess error = %v, want error %v", err, tc.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !strings.Contains(got, note) {
+				t.Errorf("upgrade note was cut:\n%s", got)
+			}
+			if over := utf8.RuneCountInString(got) > tc.max; over != tc.wantOver {
+				t.Errorf("entry of %d characters for a limit of %d:\n%s", utf8.RuneCountInString(got), tc.max, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+package main
+
+import "runtime/debug"
+
+// toolName identifies this program in --provenance footers.
+const toolName = "ai-changelog-generator"
+
+// toolVersion returns the module version the binary was built from, as go
+// install records it, or "(devel)" for a build from a source checkout.
+func toolVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nealwashere/ai-changelog-generator/internal/ai"
+)
+
+// runReplay sends the prompt saved in the --replay file to the model as is,
+// without reading the repository, and previews the response. A system.md
+// next to the file, as written by --debug-dir, replaces the system prompt.
+func runReplay(cfg config, style ai.Style) error {
+	if conflicts := savedPromptConflicts(cfg); len(conflicts) > 0 {
+		return invalid(fmt.Errorf("--replay sends a saved prompt as is and cannot be combined with options that build or check the prompt from the repository: %s", strings.Join(conflicts, ", ")))
+	}
+
+	req, hasSystem, err := savedPromptRequest(cfg, style, cfg.Replay)
+	if err != nil {
+		return err
+	}
+	req.From = "replay of " + cfg.Replay
+	if hasSystem {
+		fmt.Fprintf(os.Stderr, "info: replaying %s with the system prompt in %s\n", cfg.Replay, filepath.Join(filepath.Dir(cfg.Replay), "system.md"))
+	} else {
+		fmt.Fprintf(os.Stderr, "info: replaying %s with the current system prompt\n", cfg.Replay)
+	}
+	return preview(cfg, req)
+}
+
+// savedPromptConflicts lists the set options that build or check the prompt
+// from the repository, which a saved prompt cannot honor.
+func savedPromptConflicts(cfg config) []string {
+	return conflicting(append(rangeFlags(cfg),
+		flagUse{len(cfg.Repos) > 0, "--repos"},
+		flagUse{len(cfg.Locales) > 0, "--locale"},
+		flagUse{cfg.CiteCommits, "--cite-commits"},
+		flagUse{cfg.ValidateFormat, "--strict-keepachangelog"},
+		flagUse{cfg.Explain != "", "--explain"},
+		flagUse{cfg.CheckHallucinations, "--check-hallucinations"},
+	)...)
+}
+
+// savedPromptRequest reads the prompt saved at path into a request that sends
+// it verbatim. A system.md in the same directory, as written by --debug-dir,
+// replaces the system prompt; hasSystem reports whether there was one.
+func savedPromptRequest(cfg config, style ai.Style, path string) (req ai.Request, hasSystem bool, err error) {
+	prompt, err := os.ReadFile(path)
+	if err != nil {
+		return req, false, invalid(fmt.Errorf("reading saved prompt: %w", err))
+	}
+	if len(prompt) == 0 {
+		return req, false, invalid(fmt.Errorf("saved prompt %s is empty", path))
+	}
+
+	req = ai.Request{
+		APIKey:     cfg.APIKey,
+		Model:      cfg.Model,
+		APIVersion: cfg.APIVersion,
+		Headline:   cfg.Headline,
+		Style:      style,
+		Prompt:     string(prompt),
+	}
+	system, err := os.ReadFile(filepath.Join(filepath.Dir(path), "system.md"))
+	switch {
+	case err == nil:
+		req.System = string(system)
+		return req, true, nil
+	case errors.Is(err, os.ErrNotExist):
+		return req, false, nil
+	default:
+		return req, false, fmt.Errorf("reading saved system prompt: %w", err)
+	}
+}
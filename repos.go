@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nealwashere/ai-changelog-generator/internal/ai"
+	"github.com/nealwashere/ai-changelog-generator/internal/git"
+)
+
+// runRepos previews one changelog covering every --repos path, each diffed
+// from its own last release tag to its HEAD. Repositories without new commits
+// are left out of the prompt.
+func runRepos(cfg config, logFormat ai.LogFormat) error {
+	repos := make([]string, len(cfg.Repos))
+	for i, repo := range cfg.Repos {
+		var err error
+		if repos[i], err = checkRepo(repo); err != nil {
+			return err
+		}
+		if j := slices.Index(repos[:i], repos[i]); j != -1 {
+			return invalid(fmt.Errorf("--repos %s and --repos %s are the same repository", cfg.Repos[j], repo))
+		}
+	}
+	names := repoLabels(repos)
+
+	var all []ai.Changes
+	for i, repo := range repos {
+		name := names[i]
+
+		if err := ensureFullHistory(cfg, repo); err != nil {
+			return err
+		}
+
+		lastTag, err := git.LastReleaseTag(repo)
+		if err != nil {
+			return fmt.Errorf("%s: getting last release tag: %w", name, err)
+		}
+		if lastTag == "" {
+			fmt.Fprintf(os.Stderr, "info: %s: no prior release tags found — will diff entire history\n", name)
+		} else {
+			fmt.Fprintf(os.Stderr, "info: %s: last release tag: %s\n", name, lastTag)
+		}
+
+		changes, err := gather(cfg, repo, lastTag, "HEAD")
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if len(changes.Commits) == 0 {
+			fmt.Fprintf(os.Stderr, "info: %s: no changes — omitted\n", name)
+			continue
+		}
+		changes.Repo = name
+		all = append(all, changes)
+	}
+	if len(all) == 0 {
+		return fmt.Errorf("%w: none of the repositories have changes since their last release tag", errNoChanges)
+	}
+
+	req := baseRequest(cfg, logFormat)
+	req.From = "each repository's last release tag"
+	req.To = "HEAD"
+	req.VersionHeader = versionHeader(req.Style, "", cfg.UnreleasedLabel, time.Time{})
+	req.Repos = all
+	return preview(cfg, req)
+}
+
+// repoLabels names each of the repository paths by its directory name, or,
+// where that is the name of another one too, by as many of its trailing path
+// elements as it takes to tell them apart, such as "backend/api" and
+// "frontend/api".
+func repoLabels(paths []string) []string {
+	elems := make([][]string, len(paths))
+	depth := make([]int, len(paths))
+	for i, p := range paths {
+		p = strings.TrimPrefix(filepath.Clean(p), filepath.VolumeName(p))
+		elems[i] = strings.Split(strings.TrimLeft(filepath.ToSlash(p), "/"), "/")
+		depth[i] = 1
+	}
+	label := func(i int) string {
+		e := elems[i]
+		return strings.Join(e[max(len(e)-depth[i], 0):], "/")
+	}
+	for {
+		var clashing []int
+		for i := range paths {
+			for j := range paths {
+				if i != j && label(i) == label(j) && depth[i] < len(elems[i]) {
+					clashing = append(clashing, i)
+					break
+				}
+			}
+		}
+		if len(clashing) == 0 {
+			break
+		}
+		for _, i := range clashing {
+			depth[i]++
+		}
+	}
+	labels := make([]string, len(paths))
+	for i := range paths {
+		labels[i] = label(i)
+	}
+	return labels
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRepoLabels(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		paths []string
+		want  []string
+	}{
+		{"distinct names", []string{"/src/api", "/src/web"}, []string{"api", "web"}},
+		{"same name", []string{"/src/backend/api", "/src/frontend/api", "/src/cli"}, []string{"backend/api", "frontend/api", "cli"}},
+		{"same parent name", []string{"/a/svc/api", "/b/svc/api"}, []string{"a/svc/api", "b/svc/api"}},
+		{"nested", []string{"/src/api", "/old/src/api"}, []string{"src/api", "old/src/api"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := repoLabels(tc.paths); !slices.Equal(got, tc.want) {
+				t.Errorf("repoLabels(%q) = %q, want %q", tc.paths, got, tc.want)
+			}
+		})
+	}
+}
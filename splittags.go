@@ -0,0 +1,158 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nealwashere/ai-changelog-generator/internal/ai"
+	"github.com/nealwashere/ai-changelog-generator/internal/git"
+)
+
+// release is one entry of a --split-by-tags preview: the changes from the
+// previous boundary up to a tag, or after the last tag.
+type release struct {
+	name string     // the tag, or the unreleased label
+	req  ai.Request // ready to generate, without a locale
+	link string     // its --full-changelog-link line
+}
+
+// runSplitByTags previews the range from fromGit to toGit as one output with
+// an entry for each tag inside it, as if every release had been generated
+// when it was tagged, followed by the unreleased changes after the last tag.
+// Entries are newest first, or oldest first with --order oldest-first.
+func runSplitByTags(cfg config, base ai.Request, style ai.Style, fromGit, fromDesc, toGit string) error {
+	tags, err := git.TagsInRange(cfg.Repo, fromGit, toGit)
+	if err != nil {
+		return fmt.Errorf("listing tags in the range: %w", err)
+	}
+	head, err := git.ResolveCommit(cfg.Repo, toGit)
+	if err != nil {
+		return err
+	}
+	if len(tags) == 0 || tags[len(tags)-1].Commit != head {
+		tags = append(tags, git.RangeTag{Commit: head}) // the unreleased changes
+	}
+
+	var previous string
+	if cfg.PreviousEntries > 0 {
+		if previous, err = readPreviousEntries(cfg, style, cfg.PreviousEntries); err != nil {
+			return err
+		}
+	}
+
+	var releases []release
+	var names []string
+	from, desc := fromGit, fromDesc
+	for _, t := range tags {
+		to, version, date := t.Name, t.Name, time.Now()
+		if t.Name == "" {
+			to, version = toGit, ""
+		} else if d, err := time.Parse(time.DateOnly, t.Date); err == nil {
+			date = d
+		}
+		rel, err := splitRelease(cfg, base, style, from, desc, to, version, date)
+		if err != nil {
+			return err
+		}
+		from, desc = to, to
+		rel.name = cmp.Or(version, cfg.UnreleasedLabel)
+		if len(rel.req.Commits) == 0 {
+			fmt.Fprintf(os.Stderr, "info: --split-by-tags: no commits between %s and %s; leaving %s out\n", rel.req.From, to, rel.name)
+			continue
+		}
+		rel.req.PreviousEntries = previous
+		releases = append(releases, rel)
+		names = append(names, rel.name)
+	}
+	if len(releases) == 0 {
+		return fmt.Errorf("%w: no commits between %s and %s", errNoChanges, fromDesc, toGit)
+	}
+	fmt.Fprintf(os.Stderr, "info: --split-by-tags: %d entries: %s\n", len(releases), strings.Join(names, ", "))
+	if cfg.Order != "oldest-first" {
+		slices.Reverse(releases)
+	}
+
+	// Each language gets every entry in turn, separated by a blank line.
+	// HTML and JSON are rendered from all of them at once, so that JSON is
+	// a single document.
+	gen := func(cfg config, req ai.Request, out io.Writer) (string, error) {
+		entryOut, format := out, cfg.Format
+		if format != "markdown" {
+			entryOut, cfg.Format = io.Discard, "markdown"
+		}
+		texts := make([]string, len(releases))
+		for i, rel := range releases {
+			if i > 0 {
+				if _, err := fmt.Fprintln(entryOut); err != nil {
+					return "", err
+				}
+			}
+			c := cfg
+			c.link = rel.link
+			rel.req.Locale = req.Locale
+			var err error
+			if texts[i], err = generate(c, rel.req, entryOut); err != nil {
+				return "", fmt.Errorf("%s: %w", rel.name, err)
+			}
+		}
+		text := strings.Join(texts, "\n")
+		if format != "markdown" {
+			if _, err := io.WriteString(out, render(cfg, format, text)); err != nil {
+				return "", err
+			}
+		}
+		return text, nil
+	}
+	return previewWith(cfg, base, gen)
+}
+
+// splitRelease prepares the request for one --split-by-tags entry, the
+// changes from from to to headed as version, or as unreleased when version
+// is empty.
+func splitRelease(cfg config, base ai.Request, style ai.Style, from, fromDesc, to, version string, date time.Time) (release, error) {
+	changes, err := gather(cfg, cfg.Repo, from, to)
+	if err != nil {
+		return release{}, err
+	}
+	req := base
+	req.From = fromDesc
+	req.To = to
+	req.VersionHeader = versionHeader(style, version, cfg.UnreleasedLabel, date)
+	req.Commits = changes.Commits
+	req.DiffStat = changes.DiffStat
+	req.FullDiff = changes.FullDiff
+	if len(req.Commits) == 0 {
+		return release{req: req}, nil
+	}
+
+	var rel release
+	if cfg.FullChangelogLink {
+		if rel.link, err = fullChangelogLink(cfg, from, to); err != nil {
+			return release{}, err
+		}
+	}
+	if cfg.EnrichLabels {
+		req.IssueLabels = issueLabels(cfg.Repo, changes.Commits)
+	}
+	if cfg.GoAPIDiff {
+		if req.APIChanges, err = goAPIChanges(cfg.Repo, from, to); err != nil {
+			return release{}, err
+		}
+	}
+	if cfg.PrevTagNotes && from != "" {
+		if _, ok, err := git.LookupTag(cfg.Repo, from); err != nil {
+			return release{}, err
+		} else if ok {
+			if req.PreviousNotes, err = previousTagNotes(cfg.Repo, from); err != nil {
+				return release{}, err
+			}
+		}
+	}
+	rel.req = req
+	return rel, nil
+}
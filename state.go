@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nealwashere/ai-changelog-generator/internal/git"
+)
+
+// stateFileName records, in the repository's git directory, the HEAD that
+// the last --since-last-run preview covered. Keeping it under .git makes it
+// personal to the clone and impossible to commit by accident.
+const stateFileName = ".changelog-state"
+
+func statePath(repo string) (string, error) {
+	dir, err := git.GitDir(repo)
+	if err != nil {
+		return "", fmt.Errorf("locating git directory: %w", err)
+	}
+	return filepath.Join(dir, stateFileName), nil
+}
+
+// readLastRun returns the commit recorded by the previous --since-last-run,
+// or "" on the first run or when that commit no longer exists (for example
+// after a rebase), in which case the caller falls back to the last tag.
+func readLastRun(repo string) (string, error) {
+	path, err := statePath(repo)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("reading %s: %w", path, err)
+	}
+	recorded := strings.TrimSpace(string(data))
+	sha, err := git.ResolveCommit(repo, recorded)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %s records %s, which is no longer in the repository; ignoring it\n", path, recorded)
+		return "", nil
+	}
+	return sha, nil
+}
+
+// writeLastRun records sha as the end of the latest --since-last-run.
+func writeLastRun(repo, sha string) error {
+	path, err := statePath(repo)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(sha+"\n"), 0644); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nealwashere/ai-changelog-generator/internal/git"
+)
+
+// verifyTag checks, for --verify-tag, that the release tag just created is
+// what was asked for: an annotated tag carrying message that points at HEAD,
+// which must be the release commit with the message commitMessage unless that
+// is empty, as when --git-note made no commit. Only the subject is compared,
+// the first paragraph of commitMessage as git log shows it. It returns the
+// SHA of the tag object.
+func verifyTag(repo, tag, message, commitMessage string) (string, error) {
+	fail := func(format string, args ...any) (string, error) {
+		return "", fmt.Errorf("verifying tag %s: %s; inspect the release commit and tag before pushing", tag, fmt.Sprintf(format, args...))
+	}
+
+	t, ok, err := git.LookupTag(repo, tag)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return fail("the tag does not exist")
+	}
+	head, err := git.ResolveCommit(repo, "HEAD")
+	if err != nil {
+		return "", err
+	}
+	if t.Commit != head {
+		return fail("it points at %s, not at HEAD %s", t.Commit, head)
+	}
+	if t.Type != "tag" {
+		return fail("it is a lightweight tag, not an annotated one")
+	}
+	if t.Message != strings.TrimRight(message, "\n") {
+		return fail("its message differs from the requested one")
+	}
+	if commitMessage == "" {
+		return t.Object, nil
+	}
+	commits, err := git.LookupCommits(repo, []string{head})
+	if err != nil {
+		return "", err
+	}
+	para, _, _ := strings.Cut(strings.TrimSpace(commitMessage), "\n\n")
+	subject := strings.Join(strings.Fields(para), " ")
+	if len(commits) != 1 || commits[0].Subject != subject {
+		return fail("HEAD is not the release commit %q", subject)
+	}
+	return t.Object, nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"strings"
+
+	"github.com/nealwashere/ai-changelog-generator/internal/ai"
+)
+
+// themeIcons returns the section icons for --theme, or nil for plain. The
+// --theme-file, one "Section = icon" line each, where blank lines and
+// #-comments are ignored, overrides or extends the emoji defaults.
+func themeIcons(cfg config) (map[string]string, error) {
+	switch cfg.Theme {
+	case "plain":
+		if cfg.ThemeFile != "" {
+			return nil, fmt.Errorf("--theme-file requires --theme emoji")
+		}
+		return nil, nil
+	case "emoji":
+	default:
+		return nil, fmt.Errorf("unknown --theme %q (want plain or emoji)", cfg.Theme)
+	}
+
+	icons := maps.Clone(ai.EmojiIcons)
+	if cfg.ThemeFile == "" {
+		return icons, nil
+	}
+	data, err := os.ReadFile(cfg.ThemeFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading theme file: %w", err)
+	}
+	for i, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		section, icon, ok := strings.Cut(line, "=")
+		section, icon = strings.TrimSpace(section), strings.TrimSpace(icon)
+		if !ok || section == "" || icon == "" {
+			return nil, fmt.Errorf("%s:%d: want \"Section = icon\", got %q", cfg.ThemeFile, i+1, line)
+		}
+		icons[section] = icon
+	}
+	return icons, nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// readVersionFile returns the release version stored in path for
+// --version-from. A go.mod holds it in a "// +version v1.2.0" comment; any
+// other file, such as VERSION, holds it on its first line that is neither
+// blank nor a "#" comment. Surrounding whitespace is dropped.
+func readVersionFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("reading --version-from file: %w", err)
+	}
+	gomod := filepath.Base(path) == "go.mod"
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if gomod {
+			rest, ok := strings.CutPrefix(line, "//")
+			if !ok {
+				continue
+			}
+			if v, ok := strings.CutPrefix(strings.TrimSpace(rest), "+version"); ok && strings.TrimSpace(v) != "" {
+				return strings.TrimSpace(v), nil
+			}
+			continue
+		}
+		if line != "" && !strings.HasPrefix(line, "#") {
+			if strings.ContainsAny(line, " \t") {
+				return "", fmt.Errorf("%s: %q is not a version", path, line)
+			}
+			return line, nil
+		}
+	}
+	if gomod {
+		return "", fmt.Errorf("%s has no \"// +version\" comment", path)
+	}
+	return "", fmt.Errorf("%s contains no version", path)
+}
+
+// matchTagPrefix writes version with a leading "v" when lastTag has one and
+// without it when lastTag has none, so that a VERSION file holding 1.2.0
+// produces the tag v1.2.0 in a repository tagged v1.1.0. Without a last tag,
+// version is kept as written.
+func matchTagPrefix(version, lastTag string) string {
+	if lastTag == "" {
+		return version
+	}
+	bare := strings.TrimPrefix(version, "v")
+	if strings.HasPrefix(lastTag, "v") {
+		return "v" + bare
+	}
+	return bare
+}
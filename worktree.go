@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nealwashere/ai-changelog-generator/internal/ai"
+	"github.com/nealwashere/ai-changelog-generator/internal/git"
+)
+
+// uncommittedSHA stands in for the hash of the pseudo-commit that carries
+// the prepared message in --working-tree mode.
+const uncommittedSHA = "uncommitted"
+
+// runWorkingTree previews the changelog for the changes not yet committed:
+// git diff HEAD, or git diff --cached HEAD with --staged. There is no commit
+// in this range, so the model works from the diff and, when a merge or squash
+// merge has left one, the message git prepared for the next commit.
+func runWorkingTree(cfg config, logFormat ai.LogFormat) error {
+	conflicts := conflicting(append(rangeFlags(cfg),
+		flagUse{len(cfg.Not) > 0, "--not"},
+		flagUse{cfg.CiteCommits, "--cite-commits"},
+		flagUse{cfg.EnrichLabels, "--enrich-labels"},
+		flagUse{cfg.Plan, "--plan"},
+		flagUse{cfg.GoAPIDiff, "--go-api-diff"},
+		flagUse{cfg.FullChangelogLink, "--full-changelog-link"},
+	)...)
+	if len(conflicts) > 0 {
+		return invalid(fmt.Errorf("--working-tree previews uncommitted changes and cannot be combined with: %s", strings.Join(conflicts, ", ")))
+	}
+
+	// Before the first commit there is no HEAD; diff against the empty tree.
+	from := "HEAD"
+	if _, err := git.ResolveCommit(cfg.Repo, "HEAD"); err != nil {
+		from = ""
+	}
+	changes, err := gather(cfg, cfg.Repo, from, "")
+	if err != nil {
+		return err
+	}
+	what := "uncommitted"
+	if cfg.Staged {
+		what = "staged"
+	}
+	if strings.TrimSpace(changes.DiffStat) == "" {
+		return fmt.Errorf("%w: no %s changes to tracked files", errNoChanges, what)
+	}
+
+	message, err := git.PreparedMessage(cfg.Repo)
+	if err != nil {
+		return fmt.Errorf("reading the prepared commit message: %w", err)
+	}
+	if message != "" {
+		subject, body, _ := strings.Cut(message, "\n")
+		changes.Commits = []git.Commit{{
+			SHA:     uncommittedSHA,
+			Subject: strings.TrimSpace(subject),
+			Author:  git.UserName(cfg.Repo),
+			Date:    time.Now().Format("2006-01-02"),
+			Body:    strings.TrimSpace(body),
+		}}
+		fmt.Fprintf(os.Stderr, "info: describing %s changes with the prepared commit message %q\n", what, changes.Commits[0].Subject)
+	} else {
+		fmt.Fprintf(os.Stderr, "info: describing %s changes from the diff alone\n", what)
+	}
+
+	req := baseRequest(cfg, logFormat)
+	req.From = "HEAD"
+	if from == "" {
+		req.From = "the beginning of the repository"
+	}
+	req.To = "the working tree"
+	if cfg.Staged {
+		req.To = "the index (staged changes)"
+	}
+	req.VersionHeader = versionHeader(req.Style, "", cfg.UnreleasedLabel, time.Time{})
+	req.Commits = changes.Commits
+	req.DiffStat = changes.DiffStat
+	req.FullDiff = changes.FullDiff
+	if cfg.PreviousEntries > 0 {
+		if req.PreviousEntries, err = readPreviousEntries(cfg, req.Style, cfg.PreviousEntries); err != nil {
+			return err
+		}
+	}
+	return preview(cfg, req)
+}